@@ -2,33 +2,540 @@ package groups
 
 import (
   "fmt"
+  "net/http"
 
   "github.com/Unknwon/com"
   "github.com/astaxie/beego/validation"
-  "github.com/casbin/casbin"
   "github.com/gin-gonic/gin"
 
   "github.com/Chalin-Shi/gout/libs/e"
   "github.com/Chalin-Shi/gout/libs/logging"
-  // "github.com/Chalin-Shi/gout/libs/util"
+  "github.com/Chalin-Shi/gout/libs/util"
+  "github.com/Chalin-Shi/gout/middlewares"
   "github.com/Chalin-Shi/gout/models"
 )
 
+// Parent nests a group into the group ParentId
+type Parent struct {
+  ParentId int `json:"parentId"`
+}
+
+// orgGroup returns the group if it is in the organization of the request
+func orgGroup(c *gin.Context, id int) (models.Group, bool) {
+  maid := c.GetStringMap("Maid")
+  org := maid["Org"].(models.Organization)
+  group := models.GetGroup(id)
+  return group, group.ID > 0 && group.OrgId == org.ID
+}
+
+/**
+  * @api {get} /groups GET_GROUPS
+  * @apiName GET_GROUPS
+  * @apiGroup Groups
+  * @apiPermission Authorization User
+  *
+  * @apiDescription Groups of the organization of the request. Filters are
+  * written field=value with the operators = != > >= < <= and ~= for
+  * "contains", on id, name, parentId, requireMfa, createdAt and updatedAt.
+  *
+  * @apiParam {Number} [start=0] Offset.
+  * @apiParam {Number} [limit=10] Page size, at most MAX_PAGE_SIZE.
+  * @apiParam {String} [cursor] Walk the list by id instead of start, empty for the first page and then data.pagination.next.
+  * @apiParam {String} [sort] Fields to sort by, e.g. name,-createdAt.
+  * @apiParam (Authorization) {String} token Only admin group can post this.
+  * @apiParamExample {json} Request-Example:
+    GET /api/groups?start=0&limit=10
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data.pagination Group pagination.
+  * @apiSuccess {Number} data.pagination.total Group total.
+  * @apiSuccess {Number} data.pagination.start Group start.
+  * @apiSuccess {Number} data.pagination.limit Group limit.
+  * @apiSuccess {Object[]} data.list Group list.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "pagination": {
+          "total": 1,
+          "start": 0,
+          "limit": 10
+        },
+        "list": [
+          {
+            "id": 2,
+            "orgId": 1,
+            "parentId": 0,
+            "name": "engineering",
+            "desc": "Engineering",
+            "requireMfa": false,
+            "createdAt": 1521113735000,
+            "updatedAt": 1521113735000
+          }
+        ]
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func GetGroups(c *gin.Context) {
+  code := e.INVALID_PARAMS
+  data := make(map[string]interface{})
+
+  defer func() {
+    response := map[string]interface{}{
+      "status": code,
+      "data":   data,
+    }
+    c.Set("response", response)
+  }()
+
+  q, err := util.GetQuery(c, models.GroupFields, "-updatedAt")
+  if err != nil {
+    logging.Info("query", err)
+    return
+  }
+
+  maid := c.GetStringMap("Maid")
+  org := maid["Org"].(models.Organization)
+  groups, page, err := models.GetGroups(q, map[string]interface{}{"org_id": org.ID})
+  if err != nil {
+    logging.Error("groups", err)
+    code = e.DATABASE_ERROR
+    return
+  }
+
+  data["list"] = groups
+  data["pagination"] = page
+  code = e.SUCCESS
+}
+
+/**
+  * @api {post} /groups POST_GROUPS
+  * @apiName POST_GROUPS
+  * @apiGroup Groups
+  * @apiPermission Authorization User
+  *
+  * @apiDescription Creates a group in the organization of the request, it
+  * gets the default group permissions.
+  *
+  * @apiParam {String} name Group name, unique within the organization.
+  * @apiParam {String} [desc] Group description.
+  * @apiParam {Number} [parentId] Group to nest the new group in.
+  * @apiParam {Boolean} [requireMfa=false] Members must use MFA.
+  * @apiParam (Authorization) {String} token Only admin group can post this.
+  * @apiParamExample {json} Request-Example:
+    {
+      "name": "backend",
+      "desc": "Backend developers",
+      "parentId": 2
+    }
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result.
+  * @apiSuccess {Number} data.id Group id.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "id": 3
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func AddGroup(c *gin.Context) {
+  var form models.Group
+  maid := c.GetStringMap("Maid")
+  org := maid["Org"].(models.Organization)
+  code := e.INVALID_PARAMS
+  data := make(map[string]interface{})
+
+  defer func() {
+    response := map[string]interface{}{
+      "status": code,
+      "data":   data,
+    }
+    c.Set("response", response)
+  }()
+
+  if err := c.ShouldBindJSON(&form); err != nil {
+    return
+  }
+
+  valid := validation.Validation{}
+  valid.Required(form.Name, "name").Message("Name is required")
+  valid.MaxSize(form.Name, 100, "name").Message("Name must be at most 100 characters")
+  valid.Min(form.ParentId, 0, "parentId").Message("Parent ID must not be negative")
+
+  if valid.HasErrors() {
+    for _, err := range valid.Errors {
+      logging.Info(err.Key, err.Message)
+    }
+    return
+  }
+
+  if models.GetOrgGroupIdByName(org.ID, form.Name) > 0 {
+    code = e.RECORD_HAS_EXISTED
+    return
+  }
+  if form.ParentId != 0 {
+    if _, ok := orgGroup(c, form.ParentId); !ok {
+      code = e.RECORD_NOT_EXIST
+      return
+    }
+  }
+
+  group := models.Group{
+    OrgId:      org.ID,
+    ParentId:   form.ParentId,
+    Name:       form.Name,
+    Desc:       form.Desc,
+    RequireMfa: form.RequireMfa,
+  }
+  switch err := models.CreateGroup(&group); err {
+  case nil:
+  case models.ErrGroupDepth:
+    logging.Info("parentId", err)
+    code = e.VALIDATION_ERROR
+    return
+  default:
+    logging.Error("add group", err)
+    code = e.DATABASE_ERROR
+    return
+  }
+  if err := middlewares.ReloadPolicy(); err != nil {
+    logging.Error("reload policy", err)
+  }
+
+  data["id"] = group.ID
+  code = e.SUCCESS
+}
+
 /**
-  * @api {get} /groups/:id/users GET_GROUPS_ID_USERS
-  * @apiName GET_GROUPS_ID_USERS
+  * @api {get} /groups/:groupId GET_GROUPS_GROUPID
+  * @apiName GET_GROUPS_GROUPID
   * @apiGroup Groups
+  * @apiPermission Authorization User
   *
+  * @apiHeader {String} [If-None-Match] ETag of the group the client has, answered with 304 when it is current.
   * @apiParam (Authorization) {String} token Only admin group can post this.
   * @apiParamExample {json} Request-Example:
     {}
   *
   * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Group.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "id": 3,
+        "orgId": 1,
+        "parentId": 2,
+        "name": "backend",
+        "desc": "Backend developers",
+        "requireMfa": false,
+        "createdAt": 1521113735000,
+        "updatedAt": 1521113735000
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func GetGroup(c *gin.Context) {
+  groupId := com.StrTo(c.Param("groupId")).MustInt()
+  code := e.INVALID_PARAMS
+  httpStatus := http.StatusOK
+  var data interface{}
+
+  defer func() {
+    response := map[string]interface{}{
+      "status":     code,
+      "data":       data,
+      "httpStatus": httpStatus,
+    }
+    c.Set("response", response)
+  }()
+
+  valid := validation.Validation{}
+  valid.Min(groupId, 1, "groupId").Message("ID must greater than 0")
+
+  if valid.HasErrors() {
+    for _, err := range valid.Errors {
+      logging.Info(err.Key, err.Message)
+    }
+    return
+  }
+
+  group, ok := orgGroup(c, groupId)
+  if !ok {
+    code = e.RECORD_NOT_EXIST
+    return
+  }
+
+  etag := util.ETag(group.ID, group.Version)
+  c.Header("ETag", etag)
+  if util.IfNoneMatch(c, etag) {
+    code, httpStatus = e.SUCCESS, http.StatusNotModified
+    return
+  }
+
+  data = group
+  code = e.SUCCESS
+}
+
+/**
+  * @api {put} /groups/:groupId PUT_GROUPS_GROUPID
+  * @apiName PUT_GROUPS_GROUPID
+  * @apiGroup Groups
+  * @apiPermission Authorization User
+  *
+  * @apiDescription Renames a group or changes its description and MFA
+  * requirement. Groups mirrored from LDAP keep the directory's name.
+  *
+  * @apiParam {String} name Group name, unique within the organization.
+  * @apiParam {String} [desc] Group description.
+  * @apiParam {Boolean} [requireMfa=false] Members must use MFA.
+  * @apiHeader {String} [If-Match] ETag of GET /groups/:groupId, 412 when the group changed since.
+  * @apiParam (Authorization) {String} token Only admin group can post this.
+  * @apiParamExample {json} Request-Example:
+    {
+      "name": "platform",
+      "desc": "Platform team",
+      "requireMfa": true
+    }
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result.
+  * @apiSuccess {String} data.id Group id.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "id": 3
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func EditGroup(c *gin.Context) {
+  var form models.Group
+  groupId := com.StrTo(c.Param("groupId")).MustInt()
+  code := e.INVALID_PARAMS
+  httpStatus := http.StatusOK
+
+  defer func() {
+    response := map[string]interface{}{
+      "status":     code,
+      "data":       map[string]int{"id": groupId},
+      "httpStatus": httpStatus,
+    }
+    c.Set("response", response)
+  }()
+
+  if err := c.ShouldBindJSON(&form); err != nil {
+    return
+  }
+
+  valid := validation.Validation{}
+  valid.Min(groupId, 1, "groupId").Message("ID must greater than 0")
+  valid.Required(form.Name, "name").Message("Name is required")
+  valid.MaxSize(form.Name, 100, "name").Message("Name must be at most 100 characters")
+
+  if valid.HasErrors() {
+    for _, err := range valid.Errors {
+      logging.Info(err.Key, err.Message)
+    }
+    return
+  }
+
+  group, ok := orgGroup(c, groupId)
+  if !ok {
+    code = e.RECORD_NOT_EXIST
+    return
+  }
+  if !util.IfMatch(c, util.ETag(group.ID, group.Version)) {
+    code, httpStatus = e.PRECONDITION_FAILED, http.StatusPreconditionFailed
+    return
+  }
+  if form.Name != group.Name {
+    if group.LdapDn != "" {
+      logging.Info("name", "group is managed by ldap")
+      code = e.VALIDATION_ERROR
+      return
+    }
+    if models.GetOrgGroupIdByName(group.OrgId, form.Name) > 0 {
+      code = e.RECORD_HAS_EXISTED
+      return
+    }
+  }
+
+  err := models.EditGroupIfUnmodified(groupId, group.Version, map[string]interface{}{
+    "name":        form.Name,
+    "desc":        form.Desc,
+    "require_mfa": form.RequireMfa,
+  })
+  if err == models.ErrModified {
+    code, httpStatus = e.PRECONDITION_FAILED, http.StatusPreconditionFailed
+    return
+  }
+  if err != nil {
+    logging.Error("edit group", err)
+    code = e.DATABASE_ERROR
+    return
+  }
+  code = e.SUCCESS
+}
+
+/**
+  * @api {delete} /groups/:groupId DELETE_GROUPS_GROUPID
+  * @apiName DELETE_GROUPS_GROUPID
+  * @apiGroup Groups
+  * @apiPermission Authorization User
+  *
+  * @apiDescription Deletes a group with its policies. Members move to the
+  * group reassign, or are detached when it is left out. Groups nested in
+  * the deleted group move up to its parent. Groups mirrored from LDAP come
+  * back on the next sync while they are in the directory.
+  *
+  * @apiParam {Number} [reassign] Group the members move to.
+  * @apiHeader {String} [If-Match] ETag of GET /groups/:groupId, 412 when the group changed since.
+  * @apiParam (Authorization) {String} token Only admin group can post this.
+  * @apiParamExample {json} Request-Example:
+    DELETE /api/groups/3?reassign=2
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result.
+  * @apiSuccess {String} data.id Group id.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "id": 3
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func DeleteGroup(c *gin.Context) {
+  maid := c.GetStringMap("Maid")
+  admin := maid["User"].(models.User)
+  groupId := com.StrTo(c.Param("groupId")).MustInt()
+  reassign := com.StrTo(c.DefaultQuery("reassign", "0")).MustInt()
+  code := e.INVALID_PARAMS
+  httpStatus := http.StatusOK
+
+  defer func() {
+    response := map[string]interface{}{
+      "status":     code,
+      "data":       map[string]int{"id": groupId},
+      "httpStatus": httpStatus,
+    }
+    c.Set("response", response)
+  }()
+
+  valid := validation.Validation{}
+  valid.Min(groupId, 1, "groupId").Message("ID must greater than 0")
+  valid.Min(reassign, 0, "reassign").Message("Reassign must not be negative")
+
+  if valid.HasErrors() {
+    for _, err := range valid.Errors {
+      logging.Info(err.Key, err.Message)
+    }
+    return
+  }
+  if reassign == groupId {
+    logging.Info("reassign", "members cannot move to the deleted group")
+    return
+  }
+
+  group, ok := orgGroup(c, groupId)
+  if !ok {
+    code = e.RECORD_NOT_EXIST
+    return
+  }
+  if !util.IfMatch(c, util.ETag(group.ID, group.Version)) {
+    code, httpStatus = e.PRECONDITION_FAILED, http.StatusPreconditionFailed
+    return
+  }
+  if reassign != 0 {
+    if _, ok := orgGroup(c, reassign); !ok {
+      code = e.RECORD_NOT_EXIST
+      return
+    }
+  }
+
+  if err := models.DeleteGroup(groupId, reassign, group.Version); err == models.ErrModified {
+    code, httpStatus = e.PRECONDITION_FAILED, http.StatusPreconditionFailed
+    return
+  } else if err != nil {
+    logging.Error("delete group", err)
+    code = e.DATABASE_ERROR
+    return
+  }
+  if err := middlewares.ReloadPolicy(); err != nil {
+    logging.Error("reload policy", err)
+  }
+  models.AddAudit(models.Audit{
+    UserId: admin.ID,
+    Action: "group.delete",
+    Target: fmt.Sprintf("g_%d", groupId),
+    IP:     c.ClientIP(),
+    Detail: fmt.Sprintf("reassign=%d", reassign),
+  })
+  code = e.SUCCESS
+}
+
+/**
+  * @api {get} /groups/:groupId/users GET_GROUPS_GROUPID_USERS
+  * @apiName GET_GROUPS_GROUPID_USERS
+  * @apiGroup Groups
+  * @apiPermission Authorization User
+  *
+  * @apiDescription Direct members of the group, filtered and sorted like
+  * GET /users.
+  *
+  * @apiParam {Number} [start=0] Offset.
+  * @apiParam {Number} [limit=10] Page size, at most MAX_PAGE_SIZE.
+  * @apiParam {String} [cursor] Walk the list by id instead of start, empty for the first page and then data.pagination.next.
+  * @apiParam {String} [sort] Fields to sort by, e.g. username,-createdAt.
+  * @apiParam (Authorization) {String} token Only admin group can post this.
+  * @apiParamExample {json} Request-Example:
+    GET /api/groups/2/users?start=0&limit=10
+  *
+  * @apiSuccess {String} status Status code.
   * @apiSuccess {Object} data Data result.
-  * @apiSuccess {String} data.id User unique id.
-  * @apiSuccess {Object[]} data.list User history post list.
-  * @apiSuccess {Number} data.list.id User history post id.
-  * @apiSuccess {String} data.list.name User history post name.
+  * @apiSuccess {String} data.id Group id.
+  * @apiSuccess {Object} data.pagination Member pagination.
+  * @apiSuccess {Object[]} data.list Members.
+  * @apiSuccess {Number} data.list.id User id.
+  * @apiSuccess {String} data.list.email User email.
+  * @apiSuccess {String} data.list.username User name.
   * @apiSuccess {Object} message Descrpition within status code.
   * @apiSuccess {String} message.desc Detail descrption.
   *
@@ -37,13 +544,19 @@ import (
       "status": "100000",
       "data": {
         "id": 2,
+        "pagination": {
+          "total": 1,
+          "start": 0,
+          "limit": 10
+        },
         "list": [{
-          "id": 1,
-          "name": "1.0.0"
-         },
-         {
-          "id": 2,
-          "name": "1.1.0"
+          "id": 4,
+          "email": "Justin@123.com",
+          "username": "Justin",
+          "groupId": 2,
+          "mfaEnabled": false,
+          "createdAt": 1521113735000,
+          "updatedAt": 1521113735000
         }]
       },
       "message": {
@@ -53,9 +566,9 @@ import (
   *
 */
 func GetGroupUsers(c *gin.Context) {
-  id := com.StrTo(c.Param("id")).MustInt()
+  groupId := com.StrTo(c.Param("groupId")).MustInt()
   code := e.INVALID_PARAMS
-  var data = map[string]interface{}{"id": id}
+  var data = map[string]interface{}{"id": groupId}
 
   defer func() {
     response := map[string]interface{}{
@@ -66,7 +579,7 @@ func GetGroupUsers(c *gin.Context) {
   }()
 
   valid := validation.Validation{}
-  valid.Min(id, 1, "id").Message("ID must greater than 0")
+  valid.Min(groupId, 1, "groupId").Message("ID must greater than 0")
 
   if valid.HasErrors() {
     for _, err := range valid.Errors {
@@ -75,12 +588,24 @@ func GetGroupUsers(c *gin.Context) {
     return
   }
 
-  // if !models.ExistGroupByID(id) {
-  //   code = e.RECORD_NOT_EXIST
-  //   return
-  // }
+  if _, ok := orgGroup(c, groupId); !ok {
+    code = e.RECORD_NOT_EXIST
+    return
+  }
 
-  // data["list"] = models.GetUsersByGroupId(id)
+  q, err := util.GetQuery(c, models.UserFields, "id")
+  if err != nil {
+    logging.Info("query", err)
+    return
+  }
+  users, page, err := models.GetGroupUsers(groupId, q)
+  if err != nil {
+    logging.Error("group users", err)
+    code = e.DATABASE_ERROR
+    return
+  }
+  data["list"] = users
+  data["pagination"] = page
   code = e.SUCCESS
 }
 
@@ -95,12 +620,10 @@ func GetGroupUsers(c *gin.Context) {
     {}
   *
   * @apiSuccess {String} status Status code.
-  * @apiSuccess {Object} data Data result.
-  * @apiSuccess {String} data.id User unique id.
-  * @apiSuccess {String} data.name User name.
-  * @apiSuccess {Object} data.post User post.
-  * @apiSuccess {String} data.post.current User current post.
-  * @apiSuccess {String} data.post.latest User latest post.
+  * @apiSuccess {Object} data Member of the group.
+  * @apiSuccess {Number} data.id User id.
+  * @apiSuccess {String} data.email User email.
+  * @apiSuccess {String} data.username User name.
   * @apiSuccess {Object} message Descrpition within status code.
   * @apiSuccess {String} message.desc Detail descrption.
   *
@@ -108,13 +631,13 @@ func GetGroupUsers(c *gin.Context) {
     {
       "status": "100000",
       "data": {
-        "id": 1,
-        "name": "1.0.0",
-        "status": 1,
-        "desc": "Redis is an in-memory database open-source software project sponsored by Redis Labs.\n It is networked, in-memory, and stores keys with optional durability.",
-        "groupDesc": "Redis is an in-memory database open-source software project sponsored by Redis Labs.\n It is networked, in-memory, and stores keys with optional durability.",
-        "link": "http://192.168.1.2:8000/linktime-mysql-1.3.0.tar.gz",
-        "updatedAt": 1526977135
+        "id": 4,
+        "email": "Justin@123.com",
+        "username": "Justin",
+        "groupId": 2,
+        "mfaEnabled": false,
+        "createdAt": 1521113735000,
+        "updatedAt": 1521113735000
       },
       "message": {
         "desc": "Success"
@@ -126,7 +649,7 @@ func GetGroupUser(c *gin.Context) {
   groupId := com.StrTo(c.Param("groupId")).MustInt()
   id := com.StrTo(c.Param("id")).MustInt()
 
-  var data = make(map[string]interface{})
+  var data interface{}
   code := e.INVALID_PARAMS
 
   defer func() {
@@ -148,28 +671,14 @@ func GetGroupUser(c *gin.Context) {
     return
   }
 
-  if !models.ExistGroupByID(id) {
+  if _, ok := orgGroup(c, groupId); !ok || !models.IsGroupMember(groupId, id) {
     code = e.RECORD_NOT_EXIST
     return
   }
 
-  // chan1 := make(chan models.User)
-  // chan2 := make(chan models.Group)
-  // go func() {
-  //   chan1 <- models.GetUser(groupId)
-  // }()
-  // go func() {
-  //   chan2 <- models.GetGroupByUserId(groupId, id)
-  // }()
-  // group := <-chan1
-  // post := <-chan2
-  // data["groupId"] = group.ID
-  // data["groupname"] = group.Username
-  // data["id"] = post.ID
-  // data["title"] = post.Name
-  // data["content"] = post.Content
-  // data["desc"] = post.Desc
-  // data["updatedAt"] = post.UpdatedAt
+  user := models.GetUser(id)
+  user.Password = ""
+  data = user
   code = e.SUCCESS
 }
 
@@ -211,6 +720,8 @@ func GetGroupUser(c *gin.Context) {
   *
 */
 func AddGroupUser(c *gin.Context) {
+  maid := c.GetStringMap("Maid")
+  org := maid["Org"].(models.Organization)
   groupId := com.StrTo(c.Param("groupId")).MustInt()
   id := com.StrTo(c.Param("id")).MustInt()
 
@@ -236,74 +747,69 @@ func AddGroupUser(c *gin.Context) {
     return
   }
 
-  if !models.ExistGroupByID(groupId) {
+  if _, ok := orgGroup(c, groupId); !ok || !models.IsOrgMember(org.ID, id) {
     code = e.RECORD_NOT_EXIST
     return
   }
 
-  models.EditUser(id, map[string]int{"group_id": groupId})
-
-  var enforcer *casbin.Enforcer
-  if en, ok := c.Get("Enforcer"); ok {
-    enforcer = en.(*casbin.Enforcer)
+  if err := models.AddUserGroup(id, groupId); err != nil {
+    logging.Error("group user", err)
+    code = e.DATABASE_ERROR
+    return
+  }
+  if err := middlewares.ReloadPolicy(); err != nil {
+    logging.Error("reload policy", err)
   }
-  enforcer.AddGroupingPolicy(fmt.Sprintf("u_%d", id), fmt.Sprintf("g_%d", groupId))
 
   code = e.SUCCESS
 }
 
 /**
-  * @api {put} /groups/:groupId/users/:id PUT_GROUPS_GROUPID_USERS_ID
-  * @apiName PUT_GROUPS_GROUPID_USERS_ID
+  * @api {delete} /groups/:groupId/users/:id DELETE_GROUPS_GROUPID_USERS_ID
+  * @apiName DELETE_GROUPS_GROUPID_USERS_ID
   * @apiGroup Groups
   * @apiPermission Authorization User
   *
-  * @apiParam {String} name User post name.
-  * @apiParam {String} link User sourcelink.
-  * @apiParam {String} desc User post desc.
-  * @apiParam {String} groupDesc User desc.
+  * @apiDescription Takes the user out of the group, groups nesting it are
+  * left too unless the user is their member by another group.
+  *
   * @apiParam (Authorization) {String} token Only admin group can post this.
   * @apiParamExample {json} Request-Example:
-    {
-      "status": 0,
-      "link": "http://192.168.1.2:8000/linktime-mysql-1.3.0.tar.gz",
-      "desc": "It is networked, in-memory, and stores keys with optional durability.",
-      "groupDesc": "It is networked, in-memory, and stores keys with optional durability."
-    }
+    {}
   *
   * @apiSuccess {String} status Status code.
   * @apiSuccess {Object} data Data result.
-  * @apiSuccess {String} data.id User post unique id.
   * @apiSuccess {Object} message Descrpition within status code.
   * @apiSuccess {String} message.desc Detail descrption.
   *
   * @apiSuccessExample {json} Success-Response:
     {
       "status": "100000",
-      "data": {
-        "id": 3
-      },
+      "data": {},
       "message": {
         "desc": "Success"
       }
     }
   *
 */
-func EditGroup(c *gin.Context) {
+func DeleteGroupUser(c *gin.Context) {
+  groupId := com.StrTo(c.Param("groupId")).MustInt()
   id := com.StrTo(c.Param("id")).MustInt()
+
+  var data = make(map[string]interface{})
   code := e.INVALID_PARAMS
 
   defer func() {
     response := map[string]interface{}{
       "status": code,
-      "data":   map[string]int{"id": id},
+      "data":   data,
     }
     c.Set("response", response)
   }()
 
-  name := c.Param("name")
   valid := validation.Validation{}
-  valid.Required(name, "name").Message("Name is required")
+  valid.Min(groupId, 1, "groupId").Message("ID must greater than 0")
+  valid.Min(id, 1, "id").Message("ID must greater than 0")
 
   if valid.HasErrors() {
     for _, err := range valid.Errors {
@@ -312,33 +818,44 @@ func EditGroup(c *gin.Context) {
     return
   }
 
-  // if !models.ExistGroupByUserId(id, name) {
-  //   code = e.RECORD_NOT_EXIST
-  //   return
-  // }
+  if _, ok := orgGroup(c, groupId); !ok || !models.IsGroupMember(groupId, id) {
+    code = e.RECORD_NOT_EXIST
+    return
+  }
 
-  // var post models.Group
-  // if err := c.ShouldBindJSON(&post); err != nil {
-  //   return
-  // }
+  if err := models.RemoveUserGroup(id, groupId); err != nil {
+    logging.Error("group user", err)
+    code = e.DATABASE_ERROR
+    return
+  }
+  if err := middlewares.ReloadPolicy(); err != nil {
+    logging.Error("reload policy", err)
+  }
 
-  // models.EditGroupByUserId(id, post)
   code = e.SUCCESS
 }
 
 /**
-  * @api {delete} /groups/:groupId/users/:id DELETE_GROUPS_GROUPID_USERS_ID
-  * @apiName DELETE_GROUPS_GROUPID_USERS_ID
+  * @api {put} /groups/:groupId/parent PUT_GROUPS_GROUPID_PARENT
+  * @apiName PUT_GROUPS_GROUPID_PARENT
   * @apiGroup Groups
   * @apiPermission Authorization User
   *
+  * @apiDescription Nests the group into another group of the organization,
+  * its members inherit the policies of the parent and of the groups the
+  * parent is nested in. A parentId of 0 makes it a top level group.
+  *
+  * @apiParam {Number} parentId Parent group id.
   * @apiParam (Authorization) {String} token Only admin group can post this.
   * @apiParamExample {json} Request-Example:
-    {}
+    {
+      "parentId": 2
+    }
   *
   * @apiSuccess {String} status Status code.
   * @apiSuccess {Object} data Data result.
-  * @apiSuccess {String} data.id User unique id.
+  * @apiSuccess {Number} data.id Group id.
+  * @apiSuccess {Number} data.parentId Parent group id.
   * @apiSuccess {Object} message Descrpition within status code.
   * @apiSuccess {String} message.desc Detail descrption.
   *
@@ -346,7 +863,8 @@ func EditGroup(c *gin.Context) {
     {
       "status": "100000",
       "data": {
-        "id": 3
+        "id": 3,
+        "parentId": 2
       },
       "message": {
         "desc": "Success"
@@ -354,21 +872,26 @@ func EditGroup(c *gin.Context) {
     }
   *
 */
-func DeleteGroup(c *gin.Context) {
-  id := com.StrTo(c.Param("id")).MustInt()
+func EditGroupParent(c *gin.Context) {
+  var parent Parent
+  groupId := com.StrTo(c.Param("groupId")).MustInt()
   code := e.INVALID_PARAMS
 
   defer func() {
     response := map[string]interface{}{
       "status": code,
-      "data":   map[string]int{"id": id},
+      "data":   map[string]int{"id": groupId, "parentId": parent.ParentId},
     }
     c.Set("response", response)
   }()
 
-  name := c.Param("name")
+  if err := c.ShouldBindJSON(&parent); err != nil {
+    return
+  }
+
   valid := validation.Validation{}
-  valid.Required(name, "name").Message("Name is required")
+  valid.Min(groupId, 1, "groupId").Message("ID must greater than 0")
+  valid.Min(parent.ParentId, 0, "parentId").Message("Parent ID must not be negative")
 
   if valid.HasErrors() {
     for _, err := range valid.Errors {
@@ -377,11 +900,31 @@ func DeleteGroup(c *gin.Context) {
     return
   }
 
-  // if !models.ExistGroupByUserId(id, name) {
-  //   code = e.RECORD_NOT_EXIST
-  //   return
-  // }
+  if _, ok := orgGroup(c, groupId); !ok {
+    code = e.RECORD_NOT_EXIST
+    return
+  }
+  if parent.ParentId != 0 {
+    if _, ok := orgGroup(c, parent.ParentId); !ok {
+      code = e.RECORD_NOT_EXIST
+      return
+    }
+  }
+
+  switch err := models.SetGroupParent(groupId, parent.ParentId); err {
+  case nil:
+  case models.ErrGroupCycle, models.ErrGroupDepth:
+    logging.Info("parentId", err)
+    code = e.VALIDATION_ERROR
+    return
+  default:
+    logging.Error("group parent", err)
+    code = e.DATABASE_ERROR
+    return
+  }
+  if err := middlewares.ReloadPolicy(); err != nil {
+    logging.Error("reload policy", err)
+  }
 
-  // models.DeleteGroupByUserId(id, name)
   code = e.SUCCESS
 }
@@ -0,0 +1,470 @@
+package orgs
+
+import (
+  "fmt"
+  "regexp"
+
+  "github.com/Unknwon/com"
+  "github.com/astaxie/beego/validation"
+  "github.com/gin-gonic/gin"
+
+  "github.com/Chalin-Shi/gout/libs/e"
+  "github.com/Chalin-Shi/gout/libs/logging"
+  "github.com/Chalin-Shi/gout/middlewares"
+  "github.com/Chalin-Shi/gout/models"
+)
+
+var regexpRole = regexp.MustCompile(`^(admin|member)$`)
+
+type Member struct {
+  UserId int    `json:"userId"`
+  Role   string `json:"role"`
+}
+
+/**
+  * @api {post} /orgs POST_ORGS
+  * @apiName POST_ORGS
+  * @apiGroup Orgs
+  * @apiPermission Root
+  *
+  * @apiParam {String} name Organization unique name.
+  * @apiParam {String} [desc] Organization description.
+  * @apiParam (Authorization) {String} token Only root can post this.
+  * @apiParamExample {json} Request-Example:
+    {
+      "name": "ops",
+      "desc": "Operations"
+    }
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Result of organization.
+  * @apiSuccess {Number} data.id Organization id.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": {
+        "id": 2
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func AddOrganization(c *gin.Context) {
+  var org models.Organization
+  code := e.INVALID_PARAMS
+  data := make(map[string]interface{})
+
+  defer func() {
+    response := map[string]interface{}{
+      "status": code,
+      "data":   data,
+    }
+    c.Set("response", response)
+  }()
+
+  // a policy granting the route to someone else is not enough
+  if !isRoot(c) {
+    code = e.PERMISSION_DENIED
+    return
+  }
+
+  if err := c.ShouldBindJSON(&org); err != nil {
+    return
+  }
+
+  valid := validation.Validation{}
+  valid.Required(org.Name, "name").Message("Name is required")
+  valid.MaxSize(org.Name, 100, "name").Message("Name must be at most 100 characters")
+
+  if valid.HasErrors() {
+    for _, err := range valid.Errors {
+      logging.Info(err.Key, err.Message)
+    }
+    return
+  }
+
+  if models.ExistOrganizationByName(org.Name) {
+    code = e.RECORD_HAS_EXISTED
+    return
+  }
+
+  org.ID = 0
+  if !models.AddOrganization(&org) {
+    code = e.DATABASE_ERROR
+    return
+  }
+  data["id"] = org.ID
+  code = e.SUCCESS
+}
+
+/**
+  * @api {get} /orgs GET_ORGS
+  * @apiName GET_ORGS
+  * @apiGroup Orgs
+  * @apiPermission Root
+  *
+  * @apiParam (Authorization) {String} token Only root can post this.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object[]} data Organizations.
+  * @apiSuccess {Number} data.id Organization id.
+  * @apiSuccess {String} data.name Organization name.
+  * @apiSuccess {String} data.desc Organization description.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": [{
+        "id": 1,
+        "name": "default",
+        "desc": "",
+        "createdAt": 1552896000000,
+        "updatedAt": 1552896000000
+      }],
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func GetOrganizations(c *gin.Context) {
+  if !isRoot(c) {
+    c.Set("response", map[string]interface{}{
+      "status": e.PERMISSION_DENIED,
+      "data":   []models.Organization{},
+    })
+    return
+  }
+
+  response := map[string]interface{}{
+    "status": e.SUCCESS,
+    "data":   models.GetOrganizations(),
+  }
+  c.Set("response", response)
+}
+
+/**
+  * @api {get} /org/members GET_ORG_MEMBERS
+  * @apiName GET_ORG_MEMBERS
+  * @apiGroup Orgs
+  * @apiPermission Org Admin
+  *
+  * @apiDescription Members of the organization of the request, chosen with
+  * the X-Org-Id header.
+  *
+  * @apiParam (Authorization) {String} token Only organization admins can post this.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object[]} data Members.
+  * @apiSuccess {Number} data.userId User id.
+  * @apiSuccess {String} data.role admin or member.
+  * @apiSuccess {Object} data.user User of the membership.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": [{
+        "id": 1,
+        "orgId": 1,
+        "userId": 2,
+        "role": "admin",
+        "user": {"id": 2, "email": "Justin@123.com", "username": "Justin"}
+      }],
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func GetOrgMembers(c *gin.Context) {
+  maid := c.GetStringMap("Maid")
+  org := maid["Org"].(models.Organization)
+
+  response := map[string]interface{}{
+    "status": e.SUCCESS,
+    "data":   models.GetOrgMembers(org.ID),
+  }
+  c.Set("response", response)
+}
+
+/**
+  * @api {post} /org/members POST_ORG_MEMBERS
+  * @apiName POST_ORG_MEMBERS
+  * @apiGroup Orgs
+  * @apiPermission Root
+  * @apiDescription Adds an existing user to the organization of the
+  * request. Users are pulled in from other organizations this way, so only
+  * root can do it, organization admins create the users of their
+  * organization with POST /users.
+  *
+  * @apiParam {Number} userId User id.
+  * @apiParam {String="admin","member"} [role=member] Role in the organization.
+  * @apiParam (Authorization) {String} token Only root can post this.
+  * @apiParamExample {json} Request-Example:
+    {
+      "userId": 3,
+      "role": "member"
+    }
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Result of member.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": {
+        "userId": 3
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func AddOrgMember(c *gin.Context) {
+  var member Member
+  code := e.INVALID_PARAMS
+
+  defer func() {
+    response := map[string]interface{}{
+      "status": code,
+      "data":   map[string]int{"userId": member.UserId},
+    }
+    c.Set("response", response)
+  }()
+
+  if err := c.ShouldBindJSON(&member); err != nil {
+    return
+  }
+  if member.Role == "" {
+    member.Role = models.OrgRoleMember
+  }
+
+  valid := validation.Validation{}
+  valid.Min(member.UserId, 1, "userId").Message("User ID must greater than 0")
+  valid.Match(member.Role, regexpRole, "role").Message("Role must be admin or member")
+
+  if valid.HasErrors() {
+    for _, err := range valid.Errors {
+      logging.Info(err.Key, err.Message)
+    }
+    return
+  }
+
+  if !isRoot(c) {
+    code = e.PERMISSION_DENIED
+    return
+  }
+
+  maid := c.GetStringMap("Maid")
+  org := maid["Org"].(models.Organization)
+  if !models.ExistUserByID(member.UserId) {
+    code = e.RECORD_NOT_EXIST
+    return
+  }
+  if models.IsOrgMember(org.ID, member.UserId) {
+    code = e.RECORD_HAS_EXISTED
+    return
+  }
+
+  code = setMember(c, org, member, "org.member_add")
+}
+
+/**
+  * @api {put} /org/members/:userId PUT_ORG_MEMBERS_USERID
+  * @apiName PUT_ORG_MEMBERS_USERID
+  * @apiGroup Orgs
+  * @apiPermission Org Admin
+  *
+  * @apiParam {String="admin","member"} role Role in the organization.
+  * @apiParam (Authorization) {String} token Only organization admins can post this.
+  * @apiParamExample {json} Request-Example:
+    {
+      "role": "admin"
+    }
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Result of member.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": {
+        "userId": 3
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func EditOrgMember(c *gin.Context) {
+  var member Member
+  userId := com.StrTo(c.Param("userId")).MustInt()
+  code := e.INVALID_PARAMS
+
+  defer func() {
+    response := map[string]interface{}{
+      "status": code,
+      "data":   map[string]int{"userId": userId},
+    }
+    c.Set("response", response)
+  }()
+
+  if err := c.ShouldBindJSON(&member); err != nil {
+    return
+  }
+  member.UserId = userId
+
+  valid := validation.Validation{}
+  valid.Min(member.UserId, 1, "userId").Message("User ID must greater than 0")
+  valid.Match(member.Role, regexpRole, "role").Message("Role must be admin or member")
+
+  if valid.HasErrors() {
+    for _, err := range valid.Errors {
+      logging.Info(err.Key, err.Message)
+    }
+    return
+  }
+
+  maid := c.GetStringMap("Maid")
+  org := maid["Org"].(models.Organization)
+  if !models.IsOrgMember(org.ID, userId) {
+    code = e.RECORD_NOT_EXIST
+    return
+  }
+
+  code = setMember(c, org, member, "org.member_role")
+}
+
+/**
+  * @api {delete} /org/members/:userId DELETE_ORG_MEMBERS_USERID
+  * @apiName DELETE_ORG_MEMBERS_USERID
+  * @apiGroup Orgs
+  * @apiPermission Org Admin
+  *
+  * @apiDescription Takes the user out of the organization, together with
+  * its groups in the organization.
+  *
+  * @apiParam (Authorization) {String} token Only organization admins can post this.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Result of member.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": {
+        "userId": 3
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func DeleteOrgMember(c *gin.Context) {
+  maid := c.GetStringMap("Maid")
+  admin := maid["User"].(models.User)
+  org := maid["Org"].(models.Organization)
+  userId := com.StrTo(c.Param("userId")).MustInt()
+  code := e.INVALID_PARAMS
+
+  defer func() {
+    response := map[string]interface{}{
+      "status": code,
+      "data":   map[string]int{"userId": userId},
+    }
+    c.Set("response", response)
+  }()
+
+  valid := validation.Validation{}
+  valid.Min(userId, 1, "userId").Message("User ID must greater than 0")
+
+  if valid.HasErrors() {
+    for _, err := range valid.Errors {
+      logging.Info(err.Key, err.Message)
+    }
+    return
+  }
+
+  if !models.IsOrgMember(org.ID, userId) {
+    code = e.RECORD_NOT_EXIST
+    return
+  }
+
+  if err := models.RemoveOrgMember(org.ID, userId); err != nil {
+    logging.Error("org member", err)
+    code = e.DATABASE_ERROR
+    return
+  }
+  if err := middlewares.ReloadPolicy(); err != nil {
+    logging.Error("reload policy", err)
+  }
+  models.AddAudit(models.Audit{
+    UserId: admin.ID,
+    Action: "org.member_remove",
+    Target: fmt.Sprintf("u_%d", userId),
+    IP:     c.ClientIP(),
+    Detail: models.OrgDomain(org.ID),
+  })
+  code = e.SUCCESS
+}
+
+// setMember saves the membership, reloads the policy for the admin role
+// and records the change
+func setMember(c *gin.Context, org models.Organization, member Member, action string) string {
+  maid := c.GetStringMap("Maid")
+  admin := maid["User"].(models.User)
+
+  if err := models.SetOrgMember(org.ID, member.UserId, member.Role); err != nil {
+    logging.Error("org member", err)
+    return e.DATABASE_ERROR
+  }
+  if err := middlewares.ReloadPolicy(); err != nil {
+    logging.Error("reload policy", err)
+  }
+  models.AddAudit(models.Audit{
+    UserId: admin.ID,
+    Action: action,
+    Target: fmt.Sprintf("u_%d", member.UserId),
+    IP:     c.ClientIP(),
+    Detail: fmt.Sprintf("%s role=%s", models.OrgDomain(org.ID), member.Role),
+  })
+  return e.SUCCESS
+}
+
+// isRoot reports whether root makes the request, organizations and the
+// members coming from other organizations are left to root
+func isRoot(c *gin.Context) bool {
+  maid := c.GetStringMap("Maid")
+  user := maid["User"].(models.User)
+  return user.Username == "root"
+}
@@ -0,0 +1,57 @@
+package policy
+
+import (
+  "github.com/gin-gonic/gin"
+
+  "github.com/Chalin-Shi/gout/libs/e"
+  "github.com/Chalin-Shi/gout/middlewares"
+)
+
+/**
+  * @api {get} /permissions GET_PERMISSIONS
+  * @apiName GET_PERMISSIONS
+  * @apiGroup Policy
+  * @apiPermission Admin Policy
+  *
+  * @apiDescription Catalog of the routes policies can grant, read from the
+  * registered routes. Path and method are what POST /policy expects.
+  *
+  * @apiParam (Authorization) {String} token Only admin policy can post this.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object[]} data Permissions.
+  * @apiSuccess {String} data.name Permission name, used by DEFAULT_GROUP_PERMISSIONS.
+  * @apiSuccess {String} data.group Controller of the route.
+  * @apiSuccess {String} data.desc What the route does.
+  * @apiSuccess {String} data.path Path pattern.
+  * @apiSuccess {String} data.method Method.
+  * @apiSuccess {Boolean} data.global Route reaches beyond the organization, only root grants it.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": [{
+        "name": "GET_USERS_ID",
+        "group": "users",
+        "desc": "Get user by id",
+        "path": "/api/users/:id",
+        "method": "GET"
+      }],
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func GetPermissions(c *gin.Context) {
+  response := map[string]interface{}{
+    "status": e.SUCCESS,
+    "data":   middlewares.Catalog(),
+  }
+  c.Set("response", response)
+}
@@ -4,13 +4,16 @@ import (
   "fmt"
 
   "github.com/astaxie/beego/validation"
-  "github.com/casbin/casbin"
   "github.com/gin-gonic/gin"
 
   "github.com/Chalin-Shi/gout/libs/e"
   "github.com/Chalin-Shi/gout/libs/logging"
+  "github.com/Chalin-Shi/gout/middlewares"
+  "github.com/Chalin-Shi/gout/models"
 )
 
+// Policy grants the group ID a path and method in the organization of the
+// request, they have to match a route of the permission catalog
 type Policy struct {
   ID     int    `json:"id"`
   Path   string `json:"path"`
@@ -22,13 +25,18 @@ type Policy struct {
   * @apiName POST_POLICY
   * @apiGroup Policy
   * @apiPermission Admin Policy
+  * @apiDescription Grants the group id a route. Only root grants routes
+  * that reach beyond the organization, see global in /permissions. The
+  * policy subject is
+  * "g_<id>", the subject of the group's grouping policies; policies stored
+  * with a bare "<id>" subject are renamed once on startup.
   *
   * @apiParam {String} email Policy unique email.
   * @apiParam {String} [password=123456] Policy password.
   * @apiParam (Authorization) {String} token Only admin policy can post this.
   * @apiParamExample {json} Request-Example:
     {
-      "id": "g_1",
+      "id": 1,
       "path": "/api/users/:id",
       "method": "GET"
     }
@@ -81,11 +89,28 @@ func AddPolicy(c *gin.Context) {
     return
   }
 
-  var enforcer *casbin.Enforcer
-  if en, ok := c.Get("Enforcer"); ok {
-    enforcer = en.(*casbin.Enforcer)
+  if !middlewares.CatalogCovers(path, method) {
+    logging.Info("policy", "no route matches "+method+" "+path)
+    code = e.VALIDATION_ERROR
+    return
+  }
+
+  maid := c.GetStringMap("Maid")
+  user := maid["User"].(models.User)
+  org := maid["Org"].(models.Organization)
+  if user.Username != "root" && !middlewares.OrgCovers(path, method) {
+    logging.Info("policy", "global route in "+method+" "+path)
+    code = e.PERMISSION_DENIED
+    return
+  }
+  group := models.GetGroup(id)
+  if group.ID == 0 || group.OrgId != org.ID {
+    code = e.RECORD_NOT_EXIST
+    return
   }
-  enforcer.AddPolicy(fmt.Sprintf("%d", id), path, method)
+
+  enforcer := getEnforcer(c)
+  enforcer.AddPolicy(fmt.Sprintf("g_%d", id), getDomain(c), path, method)
 
   code = e.SUCCESS
 }
@@ -101,7 +126,7 @@ func AddPolicy(c *gin.Context) {
   * @apiParam (Authorization) {String} token Only admin policy can post this.
   * @apiParamExample {json} Request-Example:
     {
-      "id": "g_1",
+      "id": 1,
       "path": "/api/users/:id",
       "method": "GET"
     }
@@ -154,11 +179,8 @@ func DelPolicy(c *gin.Context) {
     return
   }
 
-  var enforcer *casbin.Enforcer
-  if en, ok := c.Get("Enforcer"); ok {
-    enforcer = en.(*casbin.Enforcer)
-  }
-  enforcer.RemovePolicy(fmt.Sprintf("%d", id), path, method)
+  enforcer := getEnforcer(c)
+  enforcer.RemovePolicy(fmt.Sprintf("g_%d", id), getDomain(c), path, method)
 
   code = e.SUCCESS
 }
@@ -0,0 +1,342 @@
+package policy
+
+import (
+  "github.com/astaxie/beego/validation"
+  "github.com/casbin/casbin"
+  "github.com/casbin/casbin/util"
+  "github.com/gin-gonic/gin"
+
+  "github.com/Chalin-Shi/gout/libs/e"
+  "github.com/Chalin-Shi/gout/libs/logging"
+  "github.com/Chalin-Shi/gout/models"
+)
+
+type Rule struct {
+  Sub string `json:"sub"`
+  Dom string `json:"dom"`
+  Obj string `json:"obj"`
+  Act string `json:"act"`
+  // Via is the role the rule reached the subject through
+  Via string `json:"via,omitempty"`
+}
+
+type Grouping struct {
+  Sub  string `json:"sub"`
+  Role string `json:"role"`
+  Dom  string `json:"dom"`
+}
+
+type Explain struct {
+  Sub    string `json:"sub"`
+  Path   string `json:"path"`
+  Method string `json:"method"`
+}
+
+func getEnforcer(c *gin.Context) *casbin.SyncedEnforcer {
+  var enforcer *casbin.SyncedEnforcer
+  if en, ok := c.Get("Enforcer"); ok {
+    enforcer = en.(*casbin.SyncedEnforcer)
+  }
+  return enforcer
+}
+
+// getDomain is the casbin domain of the organization of the request
+func getDomain(c *gin.Context) string {
+  maid := c.GetStringMap("Maid")
+  org := maid["Org"].(models.Organization)
+  return models.OrgDomain(org.ID)
+}
+
+// roleChain walks the grouping policies of dom up from sub, every role
+// reachable is mapped to the subject or role it was inherited from
+func roleChain(enforcer *casbin.SyncedEnforcer, sub string, dom string) ([]string, map[string]string) {
+  var roles []string
+  from := map[string]string{sub: ""}
+  queue := []string{sub}
+  for len(queue) > 0 {
+    current := queue[0]
+    queue = queue[1:]
+    for _, rule := range enforcer.GetFilteredGroupingPolicy(0, current, "", dom) {
+      role := rule[1]
+      if _, seen := from[role]; seen {
+        continue
+      }
+      from[role] = current
+      roles = append(roles, role)
+      queue = append(queue, role)
+    }
+  }
+  return roles, from
+}
+
+// rulesInDomain are the rules of sub in dom, including the ones granted in
+// every domain
+func rulesInDomain(enforcer *casbin.SyncedEnforcer, sub string, dom string) [][]string {
+  rules := enforcer.GetFilteredPolicy(0, sub, dom)
+  return append(rules, enforcer.GetFilteredPolicy(0, sub, "*")...)
+}
+
+// matchRule is the obj and act part of the matcher in conf/authz.conf
+func matchRule(path string, method string, rule []string) bool {
+  return util.KeyMatch2(path, rule[2]) && util.RegexMatch(method, rule[3])
+}
+
+/**
+  * @api {get} /policy GET_POLICY
+  * @apiName GET_POLICY
+  * @apiGroup Policy
+  * @apiPermission Admin Policy
+  *
+  * @apiDescription Rules of the organization of the request.
+  *
+  * @apiParam {String} [sub] Only rules of this subject, e.g. g_1 or u_2.
+  * @apiParam {String} [obj] A request path, only rules whose pattern covers it, or the exact pattern.
+  * @apiParam {String} [act] A request method, only rules allowing it.
+  * @apiParam (Authorization) {String} token Only admin policy can post this.
+  * @apiParamExample {json} Request-Example:
+    GET /api/policy?sub=g_1&obj=/api/users/2&act=GET
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Result of policy.
+  * @apiSuccess {Object[]} data.policies Permission rules.
+  * @apiSuccess {Object[]} data.groupings Grouping rules, subject sub inherits role.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": {
+        "policies": [{"sub": "g_1", "dom": "o_1", "obj": "/api/users/:id", "act": "GET"}],
+        "groupings": [{"sub": "u_2", "role": "g_1", "dom": "o_1"}]
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func GetPolicies(c *gin.Context) {
+  enforcer := getEnforcer(c)
+  dom := getDomain(c)
+  sub := c.Query("sub")
+  obj := c.Query("obj")
+  act := c.Query("act")
+
+  policies := make([]Rule, 0)
+  for _, rule := range enforcer.GetFilteredPolicy(1, dom) {
+    if sub != "" && rule[0] != sub {
+      continue
+    }
+    if obj != "" && rule[2] != obj && !util.KeyMatch2(obj, rule[2]) {
+      continue
+    }
+    if act != "" && !util.RegexMatch(act, rule[3]) {
+      continue
+    }
+    policies = append(policies, Rule{Sub: rule[0], Dom: rule[1], Obj: rule[2], Act: rule[3]})
+  }
+
+  groupings := make([]Grouping, 0)
+  for _, rule := range enforcer.GetFilteredGroupingPolicy(2, dom) {
+    if sub != "" && rule[0] != sub && rule[1] != sub {
+      continue
+    }
+    groupings = append(groupings, Grouping{Sub: rule[0], Role: rule[1], Dom: rule[2]})
+  }
+
+  response := map[string]interface{}{
+    "status": e.SUCCESS,
+    "data": map[string]interface{}{
+      "policies":  policies,
+      "groupings": groupings,
+    },
+  }
+  c.Set("response", response)
+}
+
+/**
+  * @api {get} /subjects/:sub/permissions GET_SUBJECTS_SUB_PERMISSIONS
+  * @apiName GET_SUBJECTS_SUB_PERMISSIONS
+  * @apiGroup Policy
+  * @apiPermission Admin Policy
+  *
+  * @apiDescription Effective permissions of a user or group in the
+  * organization of the request, including the ones inherited through its
+  * roles. Root is allowed everything.
+  *
+  * @apiParam {String} sub Subject, e.g. u_2 or g_1.
+  * @apiParam (Authorization) {String} token Only admin policy can post this.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Result of policy.
+  * @apiSuccess {String} data.sub Subject.
+  * @apiSuccess {Boolean} data.all Subject is allowed everything.
+  * @apiSuccess {String[]} data.roles Roles of the subject, direct and inherited.
+  * @apiSuccess {Object[]} data.permissions Rules granted to the subject or its roles.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": {
+        "sub": "u_2",
+        "all": false,
+        "roles": ["g_1"],
+        "permissions": [{"sub": "g_1", "dom": "o_1", "obj": "/api/users/:id", "act": "GET", "via": "g_1"}]
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func GetSubjectPermissions(c *gin.Context) {
+  enforcer := getEnforcer(c)
+  dom := getDomain(c)
+  sub := c.Param("sub")
+
+  roles, _ := roleChain(enforcer, sub, dom)
+  permissions := make([]Rule, 0)
+  for _, subject := range append([]string{sub}, roles...) {
+    for _, rule := range rulesInDomain(enforcer, subject, dom) {
+      permission := Rule{Sub: rule[0], Dom: rule[1], Obj: rule[2], Act: rule[3]}
+      if subject != sub {
+        permission.Via = subject
+      }
+      permissions = append(permissions, permission)
+    }
+  }
+  if roles == nil {
+    roles = make([]string, 0)
+  }
+
+  response := map[string]interface{}{
+    "status": e.SUCCESS,
+    "data": map[string]interface{}{
+      "sub":         sub,
+      "all":         sub == "root",
+      "roles":       roles,
+      "permissions": permissions,
+    },
+  }
+  c.Set("response", response)
+}
+
+/**
+  * @api {post} /policy/explain POST_POLICY_EXPLAIN
+  * @apiName POST_POLICY_EXPLAIN
+  * @apiGroup Policy
+  * @apiPermission Admin Policy
+  *
+  * @apiDescription Dry run of the authorization of a request in the
+  * organization of the request, nothing is changed. The decision is the
+  * enforcer's, matched lists every rule the conf/authz.conf matcher accepts
+  * for it. Scopes of personal access tokens and ownership rules are not
+  * taken into account.
+  *
+  * @apiParam {String} sub Subject, e.g. u_2.
+  * @apiParam {String} path Request path.
+  * @apiParam {String} method Request method.
+  * @apiParam (Authorization) {String} token Only admin policy can post this.
+  * @apiParamExample {json} Request-Example:
+    {
+      "sub": "u_2",
+      "path": "/api/users/3",
+      "method": "GET"
+    }
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Result of policy.
+  * @apiSuccess {Boolean} data.allowed Decision.
+  * @apiSuccess {String} data.reason root, policy or no matching policy.
+  * @apiSuccess {String[]} data.roles Roles of the subject, direct and inherited.
+  * @apiSuccess {Object[]} data.matched Rules allowing the request.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": {
+        "allowed": true,
+        "reason": "policy",
+        "roles": ["g_1"],
+        "matched": [{"sub": "g_1", "dom": "o_1", "obj": "/api/users/:id", "act": "GET", "via": "g_1"}]
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func ExplainPolicy(c *gin.Context) {
+  var explain Explain
+  code := e.INVALID_PARAMS
+  data := make(map[string]interface{})
+
+  defer func() {
+    response := map[string]interface{}{
+      "status": code,
+      "data":   data,
+    }
+    c.Set("response", response)
+  }()
+
+  if err := c.ShouldBindJSON(&explain); err != nil {
+    return
+  }
+
+  valid := validation.Validation{}
+  valid.Required(explain.Sub, "sub").Message("Sub is required")
+  valid.Required(explain.Path, "path").Message("Path is required")
+  valid.Required(explain.Method, "method").Message("Method is required")
+
+  if valid.HasErrors() {
+    for _, err := range valid.Errors {
+      logging.Info(err.Key, err.Message)
+    }
+    return
+  }
+
+  enforcer := getEnforcer(c)
+  dom := getDomain(c)
+  roles, _ := roleChain(enforcer, explain.Sub, dom)
+  matched := make([]Rule, 0)
+  for _, subject := range append([]string{explain.Sub}, roles...) {
+    for _, rule := range rulesInDomain(enforcer, subject, dom) {
+      if !matchRule(explain.Path, explain.Method, rule) {
+        continue
+      }
+      permission := Rule{Sub: rule[0], Dom: rule[1], Obj: rule[2], Act: rule[3]}
+      if subject != explain.Sub {
+        permission.Via = subject
+      }
+      matched = append(matched, permission)
+    }
+  }
+  if roles == nil {
+    roles = make([]string, 0)
+  }
+
+  allowed := enforcer.Enforce(explain.Sub, dom, explain.Path, explain.Method)
+  reason := "no matching policy"
+  switch {
+  case explain.Sub == "root":
+    reason = "root"
+  case len(matched) > 0:
+    reason = "policy"
+  }
+
+  data["allowed"] = allowed
+  data["reason"] = reason
+  data["roles"] = roles
+  data["matched"] = matched
+  code = e.SUCCESS
+}
@@ -0,0 +1,220 @@
+package policy
+
+import (
+  "fmt"
+  "io/ioutil"
+  "net/http"
+  "regexp"
+  "strings"
+
+  "github.com/astaxie/beego/validation"
+  "github.com/gin-gonic/gin"
+
+  "github.com/Chalin-Shi/gout/libs/e"
+  "github.com/Chalin-Shi/gout/libs/logging"
+  "github.com/Chalin-Shi/gout/libs/util"
+  "github.com/Chalin-Shi/gout/middlewares"
+  "github.com/Chalin-Shi/gout/models"
+)
+
+var regexpMode = regexp.MustCompile(`^(merge|replace)$`)
+
+var policyContentTypes = map[string]string{
+  "csv":  "text/csv; charset=utf-8",
+  "yaml": "application/x-yaml; charset=utf-8",
+}
+
+/**
+  * @api {get} /policy/export GET_POLICY_EXPORT
+  * @apiName GET_POLICY_EXPORT
+  * @apiGroup Policy
+  * @apiPermission Admin Policy
+  *
+  * @apiDescription Downloads every p and g rule of the organization of the
+  * request, sorted so exports of the same policy are identical and can be
+  * kept in git.
+  *
+  * @apiParam {String="csv","yaml"} [format=yaml] File format.
+  * @apiParam (Authorization) {String} token Only admin policy can post this.
+  * @apiParamExample {json} Request-Example:
+    GET /api/policy/export?format=csv
+  *
+  * @apiSuccessExample {csv} Success-Response:
+    HTTP/1.1 200 OK
+    Content-Disposition: attachment; filename="policy.csv"
+
+    p,g_1,o_1,/api/users/:id,GET
+    g,u_2,g_1,o_1
+  *
+*/
+func ExportPolicy(c *gin.Context) {
+  format := c.DefaultQuery("format", "yaml")
+  data, err := util.MarshalPolicy(format, models.GetDomainPolicySet(getDomain(c)))
+  if err != nil {
+    logging.Info("format", err)
+    c.Set("response", map[string]interface{}{
+      "status": e.INVALID_PARAMS,
+      "data":   make(map[string]interface{}),
+    })
+    return
+  }
+
+  c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="policy.%s"`, format))
+  c.Data(http.StatusOK, policyContentTypes[format], data)
+}
+
+/**
+  * @api {post} /policy/import POST_POLICY_IMPORT
+  * @apiName POST_POLICY_IMPORT
+  * @apiGroup Policy
+  * @apiPermission Admin Policy
+  *
+  * @apiDescription Applies a policy file as exported by /policy/export, sent
+  * as the request body or as the multipart field file. Every rule must be of
+  * the organization of the request and rules added must grant routes of
+  * /permissions, only root adds rules granting global routes. Merge adds the
+  * rules missing, replace also removes every rule of the organization not in
+  * the file. All changes are applied in one transaction, with dryRun only the
+  * diff is returned.
+  *
+  * @apiParam {String="merge","replace"} [mode=merge] Import mode.
+  * @apiParam {String="csv","yaml"} [format] File format, guessed from the file name or content type if left out.
+  * @apiParam {Boolean} [dryRun=false] Only preview the changes.
+  * @apiParam (Authorization) {String} token Only admin policy can post this.
+  * @apiParamExample {json} Request-Example:
+    POST /api/policy/import?mode=replace&dryRun=true
+    Content-Type: application/x-yaml
+
+    p:
+    - [g_1, o_1, /api/users/:id, GET]
+    g:
+    - [u_2, g_1, o_1]
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Result of policy.
+  * @apiSuccess {Object} data.added Rules added, by section.
+  * @apiSuccess {Object} data.removed Rules removed, by section.
+  * @apiSuccess {Boolean} data.dryRun Whether the changes were only previewed.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": {
+        "mode": "replace",
+        "dryRun": true,
+        "added": {"p": [["g_1", "o_1", "/api/users/:id", "GET"]], "g": []},
+        "removed": {"p": [], "g": [["u_3", "g_1", "o_1"]]}
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func ImportPolicy(c *gin.Context) {
+  maid := c.GetStringMap("Maid")
+  admin := maid["User"].(models.User)
+  code := e.INVALID_PARAMS
+  data := make(map[string]interface{})
+
+  defer func() {
+    response := map[string]interface{}{
+      "status": code,
+      "data":   data,
+    }
+    c.Set("response", response)
+  }()
+
+  mode := c.DefaultQuery("mode", "merge")
+  dryRun := c.Query("dryRun") == "true"
+  format := c.Query("format")
+
+  valid := validation.Validation{}
+  valid.Match(mode, regexpMode, "mode").Message("Mode must be merge or replace")
+
+  if valid.HasErrors() {
+    for _, err := range valid.Errors {
+      logging.Info(err.Key, err.Message)
+    }
+    return
+  }
+
+  var body []byte
+  var err error
+  if strings.HasPrefix(c.ContentType(), "multipart/") {
+    file, header, ferr := c.Request.FormFile("file")
+    if ferr != nil {
+      return
+    }
+    defer file.Close()
+    if format == "" {
+      format = util.PolicyFormat(header.Filename)
+    }
+    body, err = ioutil.ReadAll(file)
+  } else {
+    if format == "" {
+      format = util.PolicyFormat(c.ContentType())
+    }
+    body, err = c.GetRawData()
+  }
+  if err != nil {
+    return
+  }
+
+  desired, err := util.ParsePolicy(format, body)
+  if err != nil {
+    logging.Info("policy", err)
+    code = e.VALIDATION_ERROR
+    return
+  }
+
+  domain := getDomain(c)
+  if !desired.InDomain(domain) {
+    logging.Info("policy", "rules outside of domain "+domain)
+    code = e.VALIDATION_ERROR
+    return
+  }
+
+  added, removed := util.DiffPolicy(models.GetDomainPolicySet(domain), desired, mode == "replace")
+  // rules added must grant routes like POST /policy does, the dry run
+  // refuses the same files the import would
+  for _, rule := range added.P {
+    if !middlewares.CatalogCovers(rule[2], rule[3]) {
+      logging.Info("policy", "no route matches "+rule[3]+" "+rule[2])
+      code = e.VALIDATION_ERROR
+      return
+    }
+    if admin.Username != "root" && !middlewares.OrgCovers(rule[2], rule[3]) {
+      logging.Info("policy", "global route in "+rule[3]+" "+rule[2])
+      code = e.PERMISSION_DENIED
+      return
+    }
+  }
+  data["mode"] = mode
+  data["dryRun"] = dryRun
+  data["added"] = added
+  data["removed"] = removed
+  if dryRun || added.Len()+removed.Len() == 0 {
+    code = e.SUCCESS
+    return
+  }
+
+  if err := models.ApplyPolicyDiff(added, removed); err != nil {
+    logging.Error("policy import", err)
+    code = e.DATABASE_ERROR
+    return
+  }
+  if err := middlewares.ReloadPolicy(); err != nil {
+    logging.Error("reload policy", err)
+  }
+  models.AddAudit(models.Audit{
+    UserId: admin.ID,
+    Action: "policy.import",
+    IP:     c.ClientIP(),
+    Detail: fmt.Sprintf("dom=%s mode=%s added=%d removed=%d", domain, mode, added.Len(), removed.Len()),
+  })
+  code = e.SUCCESS
+}
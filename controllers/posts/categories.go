@@ -0,0 +1,468 @@
+package posts
+
+import (
+	"strings"
+
+	"github.com/Unknwon/com"
+	"github.com/astaxie/beego/validation"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Chalin-Shi/gout/libs/e"
+	"github.com/Chalin-Shi/gout/libs/logging"
+	"github.com/Chalin-Shi/gout/libs/util"
+	"github.com/Chalin-Shi/gout/models"
+)
+
+// Parent nests a category into the category ParentId
+type Parent struct {
+	ParentId int `json:"parentId"`
+}
+
+// orgCategory finds a category of the organization of the request
+func orgCategory(c *gin.Context, id int) (models.Category, bool) {
+	maid := c.GetStringMap("Maid")
+	org := maid["Org"].(models.Organization)
+	category := models.GetCategory(id)
+	return category, category.ID > 0 && category.OrgId == org.ID
+}
+
+/**
+  * @api {get} /categories GET_CATEGORIES
+  * @apiName GET_CATEGORIES
+  * @apiGroup Categories
+  * @apiPermission Authorization User
+  *
+  * @apiDescription Categories of the organization of the request. Filters
+  * are written field=value with the operators = != > >= < <= and ~= for
+  * "contains", on id, name, parentId, createdAt and updatedAt.
+  *
+  * @apiParam {Number} [start=0] Offset.
+  * @apiParam {Number} [limit=10] Page size, at most MAX_PAGE_SIZE.
+  * @apiParam {String} [cursor] Walk the list by id instead of start, empty for the first page and then data.pagination.next.
+  * @apiParam {String} [sort] Fields to sort by, e.g. name,-createdAt.
+  * @apiParam (Authorization) {String} token Only admin user can post this.
+  * @apiParamExample {json} Request-Example:
+    GET /api/categories?parentId=0
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data.pagination Category pagination.
+  * @apiSuccess {Object[]} data.list Category list.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "pagination": {
+          "total": 1,
+          "start": 0,
+          "limit": 10
+        },
+        "list": [
+          {
+            "id": 1,
+            "orgId": 1,
+            "parentId": 0,
+            "name": "news",
+            "desc": "Company news",
+            "createdAt": 1526977135000,
+            "updatedAt": 1526977135000
+          }
+        ]
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func GetCategories(c *gin.Context) {
+	listTopics(c, models.CategoryFields, func(q util.Query, maps map[string]interface{}) (interface{}, util.Pagination, error) {
+		return models.GetCategories(q, maps)
+	})
+}
+
+/**
+  * @api {post} /categories POST_CATEGORIES
+  * @apiName POST_CATEGORIES
+  * @apiGroup Categories
+  * @apiPermission Authorization User
+  *
+  * @apiDescription Creates a category in the organization of the request.
+  *
+  * @apiParam {String} name Category name, unique within the organization.
+  * @apiParam {String} [desc] Category description.
+  * @apiParam {Number} [parentId] Category to nest the new category in.
+  * @apiParam (Authorization) {String} token Only admin user can post this.
+  * @apiParamExample {json} Request-Example:
+    {
+      "name": "releases",
+      "desc": "Release notes",
+      "parentId": 1
+    }
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result.
+  * @apiSuccess {Number} data.id Category id.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "id": 2
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func AddCategory(c *gin.Context) {
+	var form models.Category
+	maid := c.GetStringMap("Maid")
+	org := maid["Org"].(models.Organization)
+	code := e.INVALID_PARAMS
+	data := make(map[string]interface{})
+
+	defer func() {
+		response := map[string]interface{}{
+			"status": code,
+			"data":   data,
+		}
+		c.Set("response", response)
+	}()
+
+	if err := c.ShouldBindJSON(&form); err != nil {
+		return
+	}
+
+	form.Name = strings.TrimSpace(form.Name)
+	valid := validation.Validation{}
+	validCategoryName(&valid, form.Name)
+	valid.Min(form.ParentId, 0, "parentId").Message("Parent ID must not be negative")
+
+	if valid.HasErrors() {
+		for _, err := range valid.Errors {
+			logging.Info(err.Key, err.Message)
+		}
+		return
+	}
+
+	if models.GetOrgCategoryIdByName(org.ID, form.Name) > 0 {
+		code = e.RECORD_HAS_EXISTED
+		return
+	}
+	if form.ParentId != 0 {
+		if _, ok := orgCategory(c, form.ParentId); !ok {
+			code = e.RECORD_NOT_EXIST
+			return
+		}
+	}
+
+	category := models.Category{
+		OrgId:    org.ID,
+		ParentId: form.ParentId,
+		Name:     form.Name,
+		Desc:     form.Desc,
+	}
+	if err := models.CreateCategory(&category); err != nil {
+		logging.Error("add category", err)
+		code = e.DATABASE_ERROR
+		return
+	}
+
+	data["id"] = category.ID
+	code = e.SUCCESS
+}
+
+/**
+  * @api {get} /categories/:categoryId GET_CATEGORIES_CATEGORYID
+  * @apiName GET_CATEGORIES_CATEGORYID
+  * @apiGroup Categories
+  * @apiPermission Authorization User
+  *
+  * @apiParam (Authorization) {String} token Only admin user can post this.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Category.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "id": 2,
+        "orgId": 1,
+        "parentId": 1,
+        "name": "releases",
+        "desc": "Release notes",
+        "createdAt": 1526977135000,
+        "updatedAt": 1526977135000
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func GetCategory(c *gin.Context) {
+	categoryId := com.StrTo(c.Param("categoryId")).MustInt()
+	code := e.INVALID_PARAMS
+	var data interface{}
+
+	defer func() {
+		response := map[string]interface{}{
+			"status": code,
+			"data":   data,
+		}
+		c.Set("response", response)
+	}()
+
+	valid := validation.Validation{}
+	valid.Min(categoryId, 1, "categoryId").Message("ID must greater than 0")
+
+	if valid.HasErrors() {
+		for _, err := range valid.Errors {
+			logging.Info(err.Key, err.Message)
+		}
+		return
+	}
+
+	category, ok := orgCategory(c, categoryId)
+	if !ok {
+		code = e.RECORD_NOT_EXIST
+		return
+	}
+
+	data = category
+	code = e.SUCCESS
+}
+
+/**
+  * @api {put} /categories/:categoryId PUT_CATEGORIES_CATEGORYID
+  * @apiName PUT_CATEGORIES_CATEGORYID
+  * @apiGroup Categories
+  * @apiPermission Authorization User
+  *
+  * @apiDescription Renames a category or changes its description, the posts
+  * in it change with it.
+  *
+  * @apiParam {String} name Category name, unique within the organization.
+  * @apiParam {String} [desc] Category description.
+  * @apiParam (Authorization) {String} token Only admin user can post this.
+  * @apiParamExample {json} Request-Example:
+    {
+      "name": "release notes",
+      "desc": "What is new"
+    }
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result.
+  * @apiSuccess {Number} data.id Category id.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "id": 2
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func EditCategory(c *gin.Context) {
+	var form models.Category
+	categoryId := com.StrTo(c.Param("categoryId")).MustInt()
+	code := e.INVALID_PARAMS
+
+	defer func() {
+		response := map[string]interface{}{
+			"status": code,
+			"data":   map[string]int{"id": categoryId},
+		}
+		c.Set("response", response)
+	}()
+
+	if err := c.ShouldBindJSON(&form); err != nil {
+		return
+	}
+
+	form.Name = strings.TrimSpace(form.Name)
+	valid := validation.Validation{}
+	valid.Min(categoryId, 1, "categoryId").Message("ID must greater than 0")
+	validCategoryName(&valid, form.Name)
+
+	if valid.HasErrors() {
+		for _, err := range valid.Errors {
+			logging.Info(err.Key, err.Message)
+		}
+		return
+	}
+
+	category, ok := orgCategory(c, categoryId)
+	if !ok {
+		code = e.RECORD_NOT_EXIST
+		return
+	}
+	if id := models.GetOrgCategoryIdByName(category.OrgId, form.Name); id > 0 && id != categoryId {
+		code = e.RECORD_HAS_EXISTED
+		return
+	}
+
+	err := models.EditCategory(categoryId, map[string]interface{}{
+		"name": form.Name,
+		"desc": form.Desc,
+	})
+	if err != nil {
+		logging.Error("edit category", err)
+		code = e.DATABASE_ERROR
+		return
+	}
+	code = e.SUCCESS
+}
+
+/**
+  * @api {put} /categories/:categoryId/parent PUT_CATEGORIES_CATEGORYID_PARENT
+  * @apiName PUT_CATEGORIES_CATEGORYID_PARENT
+  * @apiGroup Categories
+  * @apiPermission Authorization User
+  *
+  * @apiDescription Nests the category into another category of the
+  * organization, lists of the parent include its posts then. A parentId of
+  * 0 makes it a top level category.
+  *
+  * @apiParam {Number} parentId Parent category id.
+  * @apiParam (Authorization) {String} token Only admin user can post this.
+  * @apiParamExample {json} Request-Example:
+    {
+      "parentId": 1
+    }
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result.
+  * @apiSuccess {Number} data.id Category id.
+  * @apiSuccess {Number} data.parentId Parent category id.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "id": 2,
+        "parentId": 1
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func EditCategoryParent(c *gin.Context) {
+	var parent Parent
+	categoryId := com.StrTo(c.Param("categoryId")).MustInt()
+	code := e.INVALID_PARAMS
+
+	defer func() {
+		response := map[string]interface{}{
+			"status": code,
+			"data":   map[string]int{"id": categoryId, "parentId": parent.ParentId},
+		}
+		c.Set("response", response)
+	}()
+
+	if err := c.ShouldBindJSON(&parent); err != nil {
+		return
+	}
+
+	valid := validation.Validation{}
+	valid.Min(categoryId, 1, "categoryId").Message("ID must greater than 0")
+	valid.Min(parent.ParentId, 0, "parentId").Message("Parent ID must not be negative")
+
+	if valid.HasErrors() {
+		for _, err := range valid.Errors {
+			logging.Info(err.Key, err.Message)
+		}
+		return
+	}
+
+	if _, ok := orgCategory(c, categoryId); !ok {
+		code = e.RECORD_NOT_EXIST
+		return
+	}
+	if parent.ParentId != 0 {
+		if _, ok := orgCategory(c, parent.ParentId); !ok {
+			code = e.RECORD_NOT_EXIST
+			return
+		}
+	}
+
+	switch err := models.SetCategoryParent(categoryId, parent.ParentId); err {
+	case nil:
+	case models.ErrCategoryCycle:
+		logging.Info("parentId", err)
+		code = e.VALIDATION_ERROR
+		return
+	default:
+		logging.Error("category parent", err)
+		code = e.DATABASE_ERROR
+		return
+	}
+
+	code = e.SUCCESS
+}
+
+/**
+  * @api {delete} /categories/:categoryId DELETE_CATEGORIES_CATEGORYID
+  * @apiName DELETE_CATEGORIES_CATEGORYID
+  * @apiGroup Categories
+  * @apiPermission Authorization User
+  *
+  * @apiDescription Deletes a category. Its posts and the categories nested
+  * in it move up to its parent.
+  *
+  * @apiParam (Authorization) {String} token Only admin user can post this.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result.
+  * @apiSuccess {Number} data.id Category id.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "id": 2
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func DeleteCategory(c *gin.Context) {
+	deleteTopic(c, "categoryId", "category", func(id int) bool {
+		_, ok := orgCategory(c, id)
+		return ok
+	}, models.DeleteCategory)
+}
+
+// validCategoryName checks a category name of the request, names are
+// trimmed before
+func validCategoryName(valid *validation.Validation, name string) {
+	valid.Required(name, "name").Message("Name is required")
+	valid.MaxSize(name, 100, "name").Message("Name must be at most 100 characters")
+}
@@ -1,7 +1,8 @@
 package posts
 
 import (
-	"time"
+	"net/http"
+	"strings"
 
 	"github.com/Unknwon/com"
 	"github.com/astaxie/beego/validation"
@@ -10,24 +11,72 @@ import (
 	"github.com/Chalin-Shi/gout/libs/e"
 	"github.com/Chalin-Shi/gout/libs/logging"
 	"github.com/Chalin-Shi/gout/libs/util"
+	"github.com/Chalin-Shi/gout/middlewares"
 	"github.com/Chalin-Shi/gout/models"
 )
 
+// Draft is the body of PUT and PATCH /users/:id/posts/:postId, fields left
+// out are kept by PATCH while PUT requires title and content
+type Draft struct {
+	Title      *string   `json:"title"`
+	Desc       *string   `json:"desc"`
+	Content    *string   `json:"content"`
+	CategoryId *int      `json:"categoryId"`
+	Tags       *[]string `json:"tags"`
+}
+
+// orgUser reports whether the user of the path is a member of the
+// organization of the request
+func orgUser(c *gin.Context, userId int) bool {
+	maid := c.GetStringMap("Maid")
+	org := maid["Org"].(models.Organization)
+
+	return models.IsOrgMember(org.ID, userId)
+}
+
+// postTopic reads the tag and category lists of posts are narrowed to
+func postTopic(c *gin.Context) models.PostTopic {
+	maid := c.GetStringMap("Maid")
+	org := maid["Org"].(models.Organization)
+
+	return models.PostTopic{OrgId: org.ID, Tag: c.Query("tag"), Category: c.Query("category")}
+}
+
+// validTags checks the names of the tags a post is given
+func validTags(valid *validation.Validation, tags []string) {
+	for _, tag := range tags {
+		validTagName(valid, strings.TrimSpace(tag), "tags")
+	}
+}
+
 /**
-  * @api {get} /users/:userId/posts GET_USERS_USERID_POSTS
-  * @apiName GET_USERS_USERID_POSTS
+  * @api {get} /users/:id/posts GET_USERS_UID_POSTS
+  * @apiName GET_USERS_UID_POSTS
   * @apiGroup Posts
+  * @apiPermission Authorization User
   *
+  * @apiDescription Other users see published posts only, unless they may
+  * approve the posts of the user.
+  *
+  * @apiParam {String} id User unique id.
+  * @apiParam {String} [tag] Posts with the tag of this name only.
+  * @apiParam {String} [category] Posts in the category of this name or a category nested in it only.
+  * @apiParam {Number} [start=0] Offset.
+  * @apiParam {Number} [limit=10] Page size, at most MAX_PAGE_SIZE.
+  * @apiParam {String} [cursor] Walk the list by id instead of start, empty for the first page and then data.pagination.next.
+  * @apiParam {String} [sort] Fields to sort by, e.g. title,-createdAt.
+  * @apiParam {String} [filters] field=value with = != > >= < <= or ~= on id, title, status, publishAt, categoryId, createdAt and updatedAt.
   * @apiParam (Authorization) {String} token Only admin user can post this.
   * @apiParamExample {json} Request-Example:
-    {}
+    GET /api/users/2/posts?title~=release&sort=-createdAt
   *
   * @apiSuccess {String} status Status code.
   * @apiSuccess {Object} data Data result.
   * @apiSuccess {String} data.id User unique id.
-  * @apiSuccess {Object[]} data.list User history post list.
-  * @apiSuccess {Number} data.list.id User history post id.
-  * @apiSuccess {String} data.list.name User history post name.
+  * @apiSuccess {Object} data.pagination Post pagination.
+  * @apiSuccess {Object[]} data.list User post list.
+  * @apiSuccess {Number} data.list.id Post unique id.
+  * @apiSuccess {String} data.list.title Post title.
   * @apiSuccess {Object} message Descrpition within status code.
   * @apiSuccess {String} message.desc Detail descrption.
   *
@@ -36,13 +85,24 @@ import (
       "status": "100000",
       "data": {
         "id": 2,
+        "pagination": {
+          "total": 1,
+          "start": 0,
+          "limit": 10
+        },
         "list": [{
           "id": 1,
-          "name": "1.0.0"
-         },
-         {
-          "id": 2,
-          "name": "1.1.0"
+          "title": "Release 1.0.0",
+          "desc": "What is new",
+          "content": "Redis is an in-memory database open-source software project sponsored by Redis Labs.",
+          "userId": 2,
+          "status": "published",
+          "publishAt": 0,
+          "publishedAt": 1526977135000,
+          "categoryId": 2,
+          "tags": ["release"],
+          "createdAt": 1526977135000,
+          "updatedAt": 1526977135000
         }]
       },
       "message": {
@@ -74,32 +134,151 @@ func GetUserPosts(c *gin.Context) {
 		return
 	}
 
-	if !models.ExistUserByID(id) {
+	if !orgUser(c, id) || !models.ExistUserByID(id) {
 		code = e.RECORD_NOT_EXIST
 		return
 	}
 
-	data["list"] = models.GetPostsByUserId(id)
+	q, err := util.GetQuery(c, models.PostFields, "-updatedAt")
+	if err != nil {
+		logging.Info("query", err)
+		return
+	}
+	maps := map[string]interface{}{"user_id": id}
+	if !middlewares.CanSeeUnpublished(c, id) {
+		maps["status"] = models.PostPublished
+	}
+	posts, page, err := models.GetPosts(q, maps, postTopic(c))
+	if err != nil {
+		logging.Error("posts", err)
+		code = e.DATABASE_ERROR
+		return
+	}
+
+	data["list"] = posts
+	data["pagination"] = page
+	code = e.SUCCESS
+}
+
+/**
+  * @api {get} /posts GET_POSTS
+  * @apiName GET_POSTS
+  * @apiGroup Posts
+  * @apiPermission Authorization User
+  *
+  * @apiDescription Published posts of the members of the organization of
+  * the request, narrowed to a tag and a category of the organization.
+  *
+  * @apiParam {String} [tag] Posts with the tag of this name only.
+  * @apiParam {String} [category] Posts in the category of this name or a category nested in it only.
+  * @apiParam {Number} [start=0] Offset.
+  * @apiParam {Number} [limit=10] Page size, at most MAX_PAGE_SIZE.
+  * @apiParam {String} [cursor] Walk the list by id instead of start, empty for the first page and then data.pagination.next.
+  * @apiParam {String} [sort] Fields to sort by, e.g. title,-createdAt.
+  * @apiParam {String} [filters] field=value with = != > >= < <= or ~= on id, title, publishAt, categoryId, createdAt and updatedAt.
+  * @apiParam (Authorization) {String} token Only admin user can post this.
+  * @apiParamExample {json} Request-Example:
+    GET /api/posts?tag=release&category=news
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result.
+  * @apiSuccess {Object} data.pagination Post pagination.
+  * @apiSuccess {Object[]} data.list Post list.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "pagination": {
+          "total": 1,
+          "start": 0,
+          "limit": 10
+        },
+        "list": [{
+          "id": 1,
+          "title": "Release 1.0.0",
+          "desc": "What is new",
+          "content": "Redis is an in-memory database open-source software project sponsored by Redis Labs.",
+          "userId": 2,
+          "status": "published",
+          "publishAt": 0,
+          "publishedAt": 1526977135000,
+          "categoryId": 2,
+          "tags": ["release"],
+          "createdAt": 1526977135000,
+          "updatedAt": 1526977135000
+        }]
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func GetPosts(c *gin.Context) {
+	code := e.INVALID_PARAMS
+	data := make(map[string]interface{})
+
+	defer func() {
+		response := map[string]interface{}{
+			"status": code,
+			"data":   data,
+		}
+		c.Set("response", response)
+	}()
+
+	q, err := util.GetQuery(c, models.PostFields, "-updatedAt")
+	if err != nil {
+		logging.Info("query", err)
+		return
+	}
+
+	maid := c.GetStringMap("Maid")
+	org := maid["Org"].(models.Organization)
+	maps := map[string]interface{}{"status": models.PostPublished}
+	posts, page, err := models.GetOrgPosts(org.ID, q, maps, postTopic(c))
+	if err != nil {
+		logging.Error("posts", err)
+		code = e.DATABASE_ERROR
+		return
+	}
+
+	data["list"] = posts
+	data["pagination"] = page
 	code = e.SUCCESS
 }
 
 /**
-  * @api {get} /users/:userId/posts/:id GET_USERS_USERID_POSTS_ID
-  * @apiName GET_USERS_USERID_POSTS_ID
+  * @api {get} /users/:id/posts/:postId GET_USERS_UID_POSTS_POSTID
+  * @apiName GET_USERS_UID_POSTS_POSTID
   * @apiGroup Posts
   * @apiPermission Authorization User
   *
+  * @apiDescription Posts that are not published are found by their author
+  * and by those who may approve them only.
+  *
+  * @apiParam {String} id User unique id.
+  * @apiParam {String} postId Post unique id.
+  * @apiHeader {String} [If-None-Match] ETag of the post the client has, answered with 304 when it is current.
   * @apiParam (Authorization) {String} token Only admin user can post this.
   * @apiParamExample {json} Request-Example:
     {}
   *
   * @apiSuccess {String} status Status code.
   * @apiSuccess {Object} data Data result.
-  * @apiSuccess {String} data.id User unique id.
-  * @apiSuccess {String} data.name User name.
-  * @apiSuccess {Object} data.post User post.
-  * @apiSuccess {String} data.post.current User current post.
-  * @apiSuccess {String} data.post.latest User latest post.
+  * @apiSuccess {Number} data.id Post unique id.
+  * @apiSuccess {String} data.title Post title.
+  * @apiSuccess {String} data.desc Post desc.
+  * @apiSuccess {String} data.content Post content.
+  * @apiSuccess {Number} data.userId Author unique id.
+  * @apiSuccess {String} data.username Author name.
+  * @apiSuccess {String} data.status draft, review, scheduled, published or archived.
+  * @apiSuccess {Timestamp} data.publishAt When a scheduled post goes live.
+  * @apiSuccess {Timestamp} data.publishedAt When the post went live.
+  * @apiSuccess {Number} data.categoryId Category of the post, 0 for none.
+  * @apiSuccess {String[]} data.tags Tag names.
   * @apiSuccess {Object} message Descrpition within status code.
   * @apiSuccess {String} message.desc Detail descrption.
   *
@@ -108,12 +287,17 @@ func GetUserPosts(c *gin.Context) {
       "status": "100000",
       "data": {
         "id": 1,
-        "name": "1.0.0",
-        "status": 1,
-        "desc": "Redis is an in-memory database open-source software project sponsored by Redis Labs.\n It is networked, in-memory, and stores keys with optional durability.",
-        "userDesc": "Redis is an in-memory database open-source software project sponsored by Redis Labs.\n It is networked, in-memory, and stores keys with optional durability.",
-        "link": "http://192.168.1.2:8000/linktime-mysql-1.3.0.tar.gz",
-        "updatedAt": 1526977135
+        "title": "Release 1.0.0",
+        "desc": "What is new",
+        "content": "Redis is an in-memory database open-source software project sponsored by Redis Labs.\n It is networked, in-memory, and stores keys with optional durability.",
+        "userId": 2,
+        "username": "Justin",
+        "status": "published",
+        "publishAt": 0,
+        "publishedAt": 1526977135000,
+        "categoryId": 2,
+        "tags": ["release"],
+        "updatedAt": 1526977135000
       },
       "message": {
         "desc": "Success"
@@ -122,23 +306,25 @@ func GetUserPosts(c *gin.Context) {
   *
 */
 func GetUserPost(c *gin.Context) {
-	userId := com.StrTo(c.Param("userId")).MustInt()
-	id := com.StrTo(c.Param("id")).MustInt()
+	userId := com.StrTo(c.Param("id")).MustInt()
+	id := com.StrTo(c.Param("postId")).MustInt()
 
 	var data = make(map[string]interface{})
 	code := e.INVALID_PARAMS
+	httpStatus := http.StatusOK
 
 	defer func() {
 		response := map[string]interface{}{
-			"status": code,
-			"data":   data,
+			"status":     code,
+			"data":       data,
+			"httpStatus": httpStatus,
 		}
 		c.Set("response", response)
 	}()
 
 	valid := validation.Validation{}
-	valid.Min(userId, 1, "userId").Message("ID must greater than 0")
-	valid.Min(id, 1, "id").Message("ID must greater than 0")
+	valid.Min(userId, 1, "id").Message("ID must greater than 0")
+	valid.Min(id, 1, "postId").Message("ID must greater than 0")
 
 	if valid.HasErrors() {
 		for _, err := range valid.Errors {
@@ -147,7 +333,7 @@ func GetUserPost(c *gin.Context) {
 		return
 	}
 
-	if !models.ExistUserByID(id) {
+	if !orgUser(c, userId) {
 		code = e.RECORD_NOT_EXIST
 		return
 	}
@@ -158,42 +344,69 @@ func GetUserPost(c *gin.Context) {
 		chan1 <- models.GetUser(userId)
 	}()
 	go func() {
-		chan2 <- models.GetPostByUserId(userId, id)
+		chan2 <- models.GetUserPost(userId, id)
 	}()
 	user := <-chan1
 	post := <-chan2
+	if user.ID == 0 || post.ID == 0 {
+		code = e.RECORD_NOT_EXIST
+		return
+	}
+	if post.Status != models.PostPublished && !middlewares.CanSeeUnpublished(c, userId) {
+		code = e.RECORD_NOT_EXIST
+		return
+	}
+	etag := util.ETag(post.ID, post.Version)
+	c.Header("ETag", etag)
+	if util.IfNoneMatch(c, etag) {
+		code, httpStatus = e.SUCCESS, http.StatusNotModified
+		return
+	}
 	data["userId"] = user.ID
 	data["username"] = user.Username
 	data["id"] = post.ID
-	data["title"] = post.Name
+	data["title"] = post.Title
 	data["content"] = post.Content
 	data["desc"] = post.Desc
+	data["status"] = post.Status
+	data["publishAt"] = post.PublishAt
+	data["publishedAt"] = post.PublishedAt
+	data["categoryId"] = post.CategoryId
+	data["tags"] = models.GetPostTagNames(post.ID)
 	data["updatedAt"] = post.UpdatedAt
 	code = e.SUCCESS
 }
 
 /**
-  * @api {post} /users/:userId/posts POST_USERS_USERID_POSTS
-  * @apiName POST_USERS_USERID_POSTS
+  * @api {post} /users/:id/posts POST_USERS_UID_POSTS
+  * @apiName POST_USERS_UID_POSTS
   * @apiGroup Posts
   * @apiPermission Authorization User
   *
-  * @apiParam {String} name User post name.
-  * @apiParam {String} link User sourcelink.
-  * @apiParam {String} desc User post desc.
-  * @apiParam {String} userDesc User desc.
+  * @apiDescription Users post as themselves only, titles are unique per user.
+  * New posts are drafts. Tags of the organization that don't exist yet are
+  * created.
+  *
+  * @apiParam {String} id User unique id.
+  * @apiParam {String} title Post title.
+  * @apiParam {String} [desc] Post desc.
+  * @apiParam {String} content Post content.
+  * @apiParam {Number} [categoryId] Category of the post.
+  * @apiParam {String[]} [tags] Tag names.
   * @apiParam (Authorization) {String} token Only admin user can post this.
   * @apiParamExample {json} Request-Example:
     {
-      "name": "1.0.0",
-      "link": "http://192.168.1.2:8000/linktime-mysql-1.3.0.tar.gz",
-      "desc": "It is networked, in-memory, and stores keys with optional durability.",
-      "userDesc": "It is networked, in-memory, and stores keys with optional durability."
+      "title": "Release 1.0.0",
+      "desc": "What is new",
+      "content": "It is networked, in-memory, and stores keys with optional durability.",
+      "categoryId": 2,
+      "tags": ["release"]
     }
   *
   * @apiSuccess {String} status Status code.
   * @apiSuccess {Object} data Data result.
-  * @apiSuccess {String} data.id User post unique id.
+  * @apiSuccess {Number} data.id Post unique id.
+  * @apiSuccess {Number} data.userId User unique id.
   * @apiSuccess {Object} message Descrpition within status code.
   * @apiSuccess {String} message.desc Detail descrption.
   *
@@ -201,7 +414,8 @@ func GetUserPost(c *gin.Context) {
     {
       "status": "100000",
       "data": {
-        "id": 3
+        "id": 3,
+        "userId": 2
       },
       "message": {
         "desc": "Success"
@@ -210,28 +424,34 @@ func GetUserPost(c *gin.Context) {
   *
 */
 func AddUserPost(c *gin.Context) {
-	userId := com.StrTo(c.Param("userId")).MustInt()
+	var post models.Post
+	userId := com.StrTo(c.Param("id")).MustInt()
 	code := e.INVALID_PARAMS
 
 	defer func() {
 		response := map[string]interface{}{
 			"status": code,
-			"data":   map[string]int{"userId": userId},
+			"data":   map[string]int{"id": post.ID, "userId": userId},
 		}
 		c.Set("response", response)
 	}()
 
-	var post models.Post
 	if err := c.ShouldBindJSON(&post); err != nil {
 		return
 	}
 
 	title := post.Title
 	content := post.Content
+	post.ID = 0
 	post.UserId = userId
+	post.Status = models.PostDraft
+	post.PublishAt, post.PublishedAt = 0, 0
 	valid := validation.Validation{}
+	valid.Min(userId, 1, "id").Message("ID must greater than 0")
 	valid.Required(title, "title").Message("Title is required")
 	valid.Required(content, "content").Message("Content is required")
+	valid.Min(post.CategoryId, 0, "categoryId").Message("Category ID must not be negative")
+	validTags(&valid, post.Tags)
 
 	if valid.HasErrors() {
 		for _, err := range valid.Errors {
@@ -240,37 +460,61 @@ func AddUserPost(c *gin.Context) {
 		return
 	}
 
-	if models.ExistPostByUserId(userId, title) {
+	if !orgUser(c, userId) || !models.ExistUserByID(userId) {
+		code = e.RECORD_NOT_EXIST
+		return
+	}
+	if post.CategoryId != 0 {
+		if _, ok := orgCategory(c, post.CategoryId); !ok {
+			code = e.RECORD_NOT_EXIST
+			return
+		}
+	}
+	if models.ExistPostByTitle(userId, title) {
 		code = e.RECORD_HAS_EXISTED
 		return
 	}
 
-	models.AddPost(post)
+	maid := c.GetStringMap("Maid")
+	org := maid["Org"].(models.Organization)
+	if !models.AddPost(&post, org.ID) {
+		code = e.DATABASE_ERROR
+		return
+	}
 	code = e.SUCCESS
 }
 
 /**
-  * @api {put} /users/:userId/posts/:id PUT_USERS_USERID_POSTS_ID
-  * @apiName PUT_USERS_USERID_POSTS_ID
+  * @api {put} /users/:id/posts/:postId PUT_USERS_UID_POSTS_POSTID
+  * @apiName PUT_USERS_UID_POSTS_POSTID
   * @apiGroup Posts
   * @apiPermission Authorization User
   *
-  * @apiParam {String} name User post name.
-  * @apiParam {String} link User sourcelink.
-  * @apiParam {String} desc User post desc.
-  * @apiParam {String} userDesc User desc.
+  * @apiDescription Users edit their own posts only. PUT requires title and
+  * content, PATCH only changes the fields it is given. Every change is kept
+  * as a revision of the post. With If-Match the post is only changed while
+  * it still has that ETag. Tags replace the tags of the post. The title,
+  * desc and content only change while the post is a draft, 409 otherwise,
+  * withdraw or reopen it first.
+  *
+  * @apiParam {String} id User unique id.
+  * @apiParam {String} postId Post unique id.
+  * @apiHeader {String} [If-Match] ETag of the post, 412 when it changed since.
+  * @apiParam {String} title Post title.
+  * @apiParam {String} [desc] Post desc.
+  * @apiParam {String} content Post content.
+  * @apiParam {Number} [categoryId] Category of the post, 0 for none.
+  * @apiParam {String[]} [tags] Tag names.
   * @apiParam (Authorization) {String} token Only admin user can post this.
   * @apiParamExample {json} Request-Example:
     {
-      "status": 0,
-      "link": "http://192.168.1.2:8000/linktime-mysql-1.3.0.tar.gz",
-      "desc": "It is networked, in-memory, and stores keys with optional durability.",
-      "userDesc": "It is networked, in-memory, and stores keys with optional durability."
+      "title": "Release 1.0.1",
+      "content": "It is networked, in-memory, and stores keys with optional durability."
     }
   *
   * @apiSuccess {String} status Status code.
   * @apiSuccess {Object} data Data result.
-  * @apiSuccess {String} data.id User post unique id.
+  * @apiSuccess {Number} data.id Post unique id.
   * @apiSuccess {Object} message Descrpition within status code.
   * @apiSuccess {String} message.desc Detail descrption.
   *
@@ -286,21 +530,45 @@ func AddUserPost(c *gin.Context) {
     }
   *
 */
-func EditPost(c *gin.Context) {
-	id := com.StrTo(c.Param("id")).MustInt()
+func EditUserPost(c *gin.Context) {
+	var draft Draft
+	userId := com.StrTo(c.Param("id")).MustInt()
+	id := com.StrTo(c.Param("postId")).MustInt()
 	code := e.INVALID_PARAMS
+	httpStatus := http.StatusOK
 
 	defer func() {
 		response := map[string]interface{}{
-			"status": code,
-			"data":   map[string]int{"id": id},
+			"status":     code,
+			"data":       map[string]int{"id": id},
+			"httpStatus": httpStatus,
 		}
 		c.Set("response", response)
 	}()
 
-	name := c.Param("name")
+	if err := c.ShouldBindJSON(&draft); err != nil {
+		return
+	}
+
 	valid := validation.Validation{}
-	valid.Required(name, "name").Message("Name is required")
+	valid.Min(userId, 1, "id").Message("ID must greater than 0")
+	valid.Min(id, 1, "postId").Message("ID must greater than 0")
+	if c.Request.Method == http.MethodPut {
+		valid.Required(draft.Title != nil, "title").Message("Title is required")
+		valid.Required(draft.Content != nil, "content").Message("Content is required")
+	}
+	if draft.Title != nil {
+		valid.Required(*draft.Title, "title").Message("Title is required")
+	}
+	if draft.Content != nil {
+		valid.Required(*draft.Content, "content").Message("Content is required")
+	}
+	if draft.CategoryId != nil {
+		valid.Min(*draft.CategoryId, 0, "categoryId").Message("Category ID must not be negative")
+	}
+	if draft.Tags != nil {
+		validTags(&valid, *draft.Tags)
+	}
 
 	if valid.HasErrors() {
 		for _, err := range valid.Errors {
@@ -309,33 +577,84 @@ func EditPost(c *gin.Context) {
 		return
 	}
 
-	if !models.ExistPostByUserId(id, name) {
+	post := models.GetUserPost(userId, id)
+	if !orgUser(c, userId) || post.ID == 0 {
 		code = e.RECORD_NOT_EXIST
 		return
 	}
+	if !util.IfMatch(c, util.ETag(post.ID, post.Version)) {
+		code, httpStatus = e.PRECONDITION_FAILED, http.StatusPreconditionFailed
+		return
+	}
 
-	var post models.Post
-	if err := c.ShouldBindJSON(&post); err != nil {
+	data := make(map[string]interface{})
+	if draft.Title != nil && *draft.Title != post.Title {
+		if models.ExistPostByTitle(userId, *draft.Title) {
+			code = e.RECORD_HAS_EXISTED
+			return
+		}
+		data["title"] = *draft.Title
+	}
+	if draft.Desc != nil && *draft.Desc != post.Desc {
+		data["desc"] = *draft.Desc
+	}
+	if draft.Content != nil && *draft.Content != post.Content {
+		data["content"] = *draft.Content
+	}
+	if len(data) > 0 && !inStatus(post.Status, textStatuses) {
+		logging.Info("edit post", post.Status)
+		code, httpStatus = e.STATUS_CONFLICT, http.StatusConflict
 		return
 	}
+	if draft.CategoryId != nil && *draft.CategoryId != post.CategoryId {
+		if *draft.CategoryId != 0 {
+			if _, ok := orgCategory(c, *draft.CategoryId); !ok {
+				code = e.RECORD_NOT_EXIST
+				return
+			}
+		}
+		data["category_id"] = *draft.CategoryId
+	}
 
-	models.EditPostByUserId(id, post)
+	maid := c.GetStringMap("Maid")
+	user := maid["User"].(models.User)
+	org := maid["Org"].(models.Organization)
+	var tags []string
+	if draft.Tags != nil {
+		tags = *draft.Tags
+	}
+	// unchanged posts don't get a new revision
+	if len(data) > 0 || tags != nil {
+		if err := models.EditPost(id, user.ID, org.ID, post.Version, data, tags); err == models.ErrModified {
+			code, httpStatus = e.PRECONDITION_FAILED, http.StatusPreconditionFailed
+			return
+		} else if err != nil {
+			logging.Error("edit post", err)
+			code = e.DATABASE_ERROR
+			return
+		}
+	}
 	code = e.SUCCESS
 }
 
 /**
-  * @api {delete} /users/:userId/posts/:id DELETE_USERS_USERID_POSTS_ID
-  * @apiName DELETE_USERS_USERID_POSTS_ID
+  * @api {delete} /users/:id/posts/:postId DELETE_USERS_UID_POSTS_POSTID
+  * @apiName DELETE_USERS_UID_POSTS_POSTID
   * @apiGroup Posts
   * @apiPermission Authorization User
   *
+  * @apiDescription Users delete their own posts only.
+  *
+  * @apiParam {String} id User unique id.
+  * @apiParam {String} postId Post unique id.
+  * @apiHeader {String} [If-Match] ETag of the post, 412 when it changed since.
   * @apiParam (Authorization) {String} token Only admin user can post this.
   * @apiParamExample {json} Request-Example:
     {}
   *
   * @apiSuccess {String} status Status code.
   * @apiSuccess {Object} data Data result.
-  * @apiSuccess {String} data.id User unique id.
+  * @apiSuccess {Number} data.id Post unique id.
   * @apiSuccess {Object} message Descrpition within status code.
   * @apiSuccess {String} message.desc Detail descrption.
   *
@@ -351,21 +670,24 @@ func EditPost(c *gin.Context) {
     }
   *
 */
-func DeletePost(c *gin.Context) {
-	id := com.StrTo(c.Param("id")).MustInt()
+func DeleteUserPost(c *gin.Context) {
+	userId := com.StrTo(c.Param("id")).MustInt()
+	id := com.StrTo(c.Param("postId")).MustInt()
 	code := e.INVALID_PARAMS
+	httpStatus := http.StatusOK
 
 	defer func() {
 		response := map[string]interface{}{
-			"status": code,
-			"data":   map[string]int{"id": id},
+			"status":     code,
+			"data":       map[string]int{"id": id},
+			"httpStatus": httpStatus,
 		}
 		c.Set("response", response)
 	}()
 
-	name := c.Param("name")
 	valid := validation.Validation{}
-	valid.Required(name, "name").Message("Name is required")
+	valid.Min(userId, 1, "id").Message("ID must greater than 0")
+	valid.Min(id, 1, "postId").Message("ID must greater than 0")
 
 	if valid.HasErrors() {
 		for _, err := range valid.Errors {
@@ -374,11 +696,23 @@ func DeletePost(c *gin.Context) {
 		return
 	}
 
-	if !models.ExistPostByUserId(id, name) {
+	post := models.GetUserPost(userId, id)
+	if !orgUser(c, userId) || post.ID == 0 {
 		code = e.RECORD_NOT_EXIST
 		return
 	}
+	if !util.IfMatch(c, util.ETag(post.ID, post.Version)) {
+		code, httpStatus = e.PRECONDITION_FAILED, http.StatusPreconditionFailed
+		return
+	}
 
-	models.DeletePostByUserId(id, name)
+	if err := models.DeletePost(id, post.Version); err == models.ErrModified {
+		code, httpStatus = e.PRECONDITION_FAILED, http.StatusPreconditionFailed
+		return
+	} else if err != nil {
+		logging.Error("delete post", err)
+		code = e.DATABASE_ERROR
+		return
+	}
 	code = e.SUCCESS
 }
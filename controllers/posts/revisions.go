@@ -0,0 +1,417 @@
+package posts
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Unknwon/com"
+	"github.com/astaxie/beego/validation"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Chalin-Shi/gout/libs/e"
+	"github.com/Chalin-Shi/gout/libs/logging"
+	"github.com/Chalin-Shi/gout/libs/util"
+	"github.com/Chalin-Shi/gout/middlewares"
+	"github.com/Chalin-Shi/gout/models"
+)
+
+// revisedPost finds the post of the request for its revision history, which
+// is open to those who may see the post unpublished only
+func revisedPost(c *gin.Context, userId int, id int) (models.Post, bool) {
+	if !orgUser(c, userId) || !middlewares.CanSeeUnpublished(c, userId) {
+		return models.Post{}, false
+	}
+	post := models.GetUserPost(userId, id)
+
+	return post, post.ID > 0
+}
+
+/**
+  * @api {get} /users/:id/posts/:postId/revisions GET_USERS_UID_POSTS_POSTID_REVISIONS
+  * @apiName GET_USERS_UID_POSTS_POSTID_REVISIONS
+  * @apiGroup Posts
+  * @apiPermission Authorization User
+  *
+  * @apiDescription Revisions of a post, the latest first. Open to the author
+  * and to those who may approve its posts.
+  *
+  * @apiParam {String} id User unique id.
+  * @apiParam {String} postId Post unique id.
+  * @apiParam {Number} [start=0] Offset.
+  * @apiParam {Number} [limit=10] Page size, at most MAX_PAGE_SIZE.
+  * @apiParam {String} [sort] Fields to sort by: id, number, userId or createdAt.
+  * @apiParamExample {json} Request-Example:
+    GET /api/users/2/posts/3/revisions?userId=2
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result.
+  * @apiSuccess {Number} data.id Post unique id.
+  * @apiSuccess {Object} data.pagination Revision pagination.
+  * @apiSuccess {Object[]} data.list Revisions.
+  * @apiSuccess {Number} data.list.number Revision number within the post.
+  * @apiSuccess {Number} data.list.userId Who made the revision.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "id": 3,
+        "pagination": {
+          "total": 2,
+          "start": 0,
+          "limit": 10
+        },
+        "list": [{
+          "id": 8,
+          "postId": 3,
+          "number": 2,
+          "userId": 2,
+          "title": "Release 1.0.1",
+          "desc": "What is new",
+          "content": "It is networked, in-memory, and stores keys with optional durability.",
+          "createdAt": 1526977135000,
+          "updatedAt": 1526977135000
+        }]
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func GetPostRevisions(c *gin.Context) {
+	userId := com.StrTo(c.Param("id")).MustInt()
+	id := com.StrTo(c.Param("postId")).MustInt()
+	code := e.INVALID_PARAMS
+	var data = map[string]interface{}{"id": id}
+
+	defer func() {
+		response := map[string]interface{}{
+			"status": code,
+			"data":   data,
+		}
+		c.Set("response", response)
+	}()
+
+	valid := validation.Validation{}
+	valid.Min(userId, 1, "id").Message("ID must greater than 0")
+	valid.Min(id, 1, "postId").Message("ID must greater than 0")
+
+	if valid.HasErrors() {
+		for _, err := range valid.Errors {
+			logging.Info(err.Key, err.Message)
+		}
+		return
+	}
+
+	if _, ok := revisedPost(c, userId, id); !ok {
+		code = e.RECORD_NOT_EXIST
+		return
+	}
+
+	q, err := util.GetQuery(c, models.RevisionFields, "-number")
+	if err != nil {
+		logging.Info("query", err)
+		return
+	}
+	revisions, page, err := models.GetPostRevisions(id, q)
+	if err != nil {
+		logging.Error("post revisions", err)
+		code = e.DATABASE_ERROR
+		return
+	}
+
+	data["list"] = revisions
+	data["pagination"] = page
+	code = e.SUCCESS
+}
+
+/**
+  * @api {get} /users/:id/posts/:postId/revisions/:number GET_USERS_UID_POSTS_POSTID_REVISIONS_NUMBER
+  * @apiName GET_USERS_UID_POSTS_POSTID_REVISIONS_NUMBER
+  * @apiGroup Posts
+  * @apiPermission Authorization User
+  *
+  * @apiParam {String} id User unique id.
+  * @apiParam {String} postId Post unique id.
+  * @apiParam {String} number Revision number.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data The revision, see GET /users/:id/posts/:postId/revisions.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "id": 7,
+        "postId": 3,
+        "number": 1,
+        "userId": 2,
+        "title": "Release 1.0.0",
+        "desc": "What is new",
+        "content": "It is networked and in-memory.",
+        "createdAt": 1526977135000,
+        "updatedAt": 1526977135000
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func GetPostRevision(c *gin.Context) {
+	var revision models.PostRevision
+	userId := com.StrTo(c.Param("id")).MustInt()
+	id := com.StrTo(c.Param("postId")).MustInt()
+	number := com.StrTo(c.Param("number")).MustInt()
+	code := e.INVALID_PARAMS
+
+	defer func() {
+		response := map[string]interface{}{
+			"status": code,
+			"data":   revision,
+		}
+		c.Set("response", response)
+	}()
+
+	valid := validation.Validation{}
+	valid.Min(userId, 1, "id").Message("ID must greater than 0")
+	valid.Min(id, 1, "postId").Message("ID must greater than 0")
+	valid.Min(number, 1, "number").Message("Number must greater than 0")
+
+	if valid.HasErrors() {
+		for _, err := range valid.Errors {
+			logging.Info(err.Key, err.Message)
+		}
+		return
+	}
+
+	if _, ok := revisedPost(c, userId, id); !ok {
+		code = e.RECORD_NOT_EXIST
+		return
+	}
+	if revision = models.GetPostRevision(id, number); revision.ID == 0 {
+		code = e.RECORD_NOT_EXIST
+		return
+	}
+	code = e.SUCCESS
+}
+
+/**
+  * @api {get} /users/:id/posts/:postId/diff GET_USERS_UID_POSTS_POSTID_DIFF
+  * @apiName GET_USERS_UID_POSTS_POSTID_DIFF
+  * @apiGroup Posts
+  * @apiPermission Authorization User
+  *
+  * @apiDescription Line by line differences between two revisions of a
+  * post. Lines are kept (=), removed (-) or added (+) on the way from the
+  * from revision to the to revision.
+  *
+  * @apiParam {String} id User unique id.
+  * @apiParam {String} postId Post unique id.
+  * @apiParam {Number} from Revision number to compare from.
+  * @apiParam {Number} [to] Revision number to compare to, the latest by default.
+  * @apiParamExample {json} Request-Example:
+    GET /api/users/2/posts/3/diff?from=1&to=2
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result.
+  * @apiSuccess {Number} data.from From revision number.
+  * @apiSuccess {Number} data.to To revision number.
+  * @apiSuccess {Object[]} data.title Diff of the title.
+  * @apiSuccess {Object[]} data.desc Diff of the desc.
+  * @apiSuccess {Object[]} data.content Diff of the content.
+  * @apiSuccess {String} data.content.op =, - or +.
+  * @apiSuccess {String} data.content.text The line.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "from": 1,
+        "to": 2,
+        "title": [
+          {"op": "-", "text": "Release 1.0.0"},
+          {"op": "+", "text": "Release 1.0.1"}
+        ],
+        "desc": [
+          {"op": "=", "text": "What is new"}
+        ],
+        "content": [
+          {"op": "=", "text": "It is networked,"},
+          {"op": "-", "text": "in-memory."},
+          {"op": "+", "text": "in-memory, and stores keys with optional durability."}
+        ]
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func GetPostDiff(c *gin.Context) {
+	userId := com.StrTo(c.Param("id")).MustInt()
+	id := com.StrTo(c.Param("postId")).MustInt()
+	from := com.StrTo(c.Query("from")).MustInt()
+	to := com.StrTo(c.DefaultQuery("to", "0")).MustInt()
+	code := e.INVALID_PARAMS
+	data := make(map[string]interface{})
+
+	defer func() {
+		response := map[string]interface{}{
+			"status": code,
+			"data":   data,
+		}
+		c.Set("response", response)
+	}()
+
+	valid := validation.Validation{}
+	valid.Min(userId, 1, "id").Message("ID must greater than 0")
+	valid.Min(id, 1, "postId").Message("ID must greater than 0")
+	valid.Min(from, 1, "from").Message("From must greater than 0")
+	valid.Min(to, 0, "to").Message("To must not be negative")
+
+	if valid.HasErrors() {
+		for _, err := range valid.Errors {
+			logging.Info(err.Key, err.Message)
+		}
+		return
+	}
+
+	if _, ok := revisedPost(c, userId, id); !ok {
+		code = e.RECORD_NOT_EXIST
+		return
+	}
+	old := models.GetPostRevision(id, from)
+	cur := models.GetPostRevision(id, to)
+	if old.ID == 0 || cur.ID == 0 {
+		code = e.RECORD_NOT_EXIST
+		return
+	}
+
+	data["from"] = old.Number
+	data["to"] = cur.Number
+	data["title"] = util.DiffLines(old.Title, cur.Title)
+	data["desc"] = util.DiffLines(old.Desc, cur.Desc)
+	data["content"] = util.DiffLines(old.Content, cur.Content)
+	code = e.SUCCESS
+}
+
+/**
+  * @api {post} /users/:id/posts/:postId/revisions/:number/restore POST_USERS_UID_POSTS_POSTID_REVISIONS_NUMBER_RESTORE
+  * @apiName POST_USERS_UID_POSTS_POSTID_REVISIONS_NUMBER_RESTORE
+  * @apiGroup Posts
+  * @apiPermission Authorization User
+  *
+  * @apiDescription The author brings a post back to an old revision, which
+  * is kept as a new revision. Fails when another post of the author has
+  * taken the title of the old revision meanwhile, and with 409 unless the
+  * post is a draft.
+  *
+  * @apiParam {String} id User unique id.
+  * @apiParam {String} postId Post unique id.
+  * @apiParam {String} number Revision number to restore.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result.
+  * @apiSuccess {Number} data.id Post unique id.
+  * @apiSuccess {Number} data.number The restored revision.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "id": 3,
+        "number": 1
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func RestorePostRevision(c *gin.Context) {
+	maid := c.GetStringMap("Maid")
+	user := maid["User"].(models.User)
+	userId := com.StrTo(c.Param("id")).MustInt()
+	id := com.StrTo(c.Param("postId")).MustInt()
+	number := com.StrTo(c.Param("number")).MustInt()
+	code := e.INVALID_PARAMS
+	httpStatus := http.StatusOK
+
+	defer func() {
+		response := map[string]interface{}{
+			"status":     code,
+			"data":       map[string]int{"id": id, "number": number},
+			"httpStatus": httpStatus,
+		}
+		c.Set("response", response)
+	}()
+
+	valid := validation.Validation{}
+	valid.Min(userId, 1, "id").Message("ID must greater than 0")
+	valid.Min(id, 1, "postId").Message("ID must greater than 0")
+	valid.Min(number, 1, "number").Message("Number must greater than 0")
+
+	if valid.HasErrors() {
+		for _, err := range valid.Errors {
+			logging.Info(err.Key, err.Message)
+		}
+		return
+	}
+
+	post, ok := revisedPost(c, userId, id)
+	if !ok {
+		code = e.RECORD_NOT_EXIST
+		return
+	}
+	revision := models.GetPostRevision(id, number)
+	if revision.ID == 0 {
+		code = e.RECORD_NOT_EXIST
+		return
+	}
+	if !inStatus(post.Status, textStatuses) {
+		logging.Info("restore post revision", post.Status)
+		code, httpStatus = e.STATUS_CONFLICT, http.StatusConflict
+		return
+	}
+	if revision.Title != post.Title && models.ExistPostByTitle(userId, revision.Title) {
+		code = e.RECORD_HAS_EXISTED
+		return
+	}
+
+	data := map[string]interface{}{
+		"title":   revision.Title,
+		"desc":    revision.Desc,
+		"content": revision.Content,
+	}
+	// the post may have left the draft status since it was read
+	if err := models.EditPost(id, user.ID, 0, post.Version, data, nil); err == models.ErrModified {
+		code, httpStatus = e.PRECONDITION_FAILED, http.StatusPreconditionFailed
+		return
+	} else if err != nil {
+		logging.Error("restore post revision", err)
+		code = e.DATABASE_ERROR
+		return
+	}
+	models.AddAudit(models.Audit{
+		UserId: user.ID,
+		Action: "post.restore",
+		Target: fmt.Sprintf("post_%d", id),
+		IP:     c.ClientIP(),
+		Detail: fmt.Sprintf("revision %d", number),
+	})
+	code = e.SUCCESS
+}
@@ -0,0 +1,328 @@
+package posts
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Unknwon/com"
+	"github.com/astaxie/beego/validation"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Chalin-Shi/gout/libs/e"
+	"github.com/Chalin-Shi/gout/libs/logging"
+	"github.com/Chalin-Shi/gout/models"
+)
+
+// Approval is the optional body of POST /users/:id/posts/:postId/approve
+type Approval struct {
+	PublishAt int64 `json:"publishAt"`
+}
+
+/**
+  * @api {post} /users/:id/posts/:postId/submit POST_USERS_UID_POSTS_POSTID_SUBMIT
+  * @apiName POST_USERS_UID_POSTS_POSTID_SUBMIT
+  * @apiGroup Posts
+  * @apiPermission Authorization User
+  *
+  * @apiDescription The author sends a draft to review. Like every route of
+  * the workflow it answers 409 Conflict for posts in another status.
+  *
+  * @apiParam {String} id User unique id.
+  * @apiParam {String} postId Post unique id.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result.
+  * @apiSuccess {Number} data.id Post unique id.
+  * @apiSuccess {String} data.status New status of the post.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "id": 3,
+        "status": "review"
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func SubmitPost(c *gin.Context) {
+	transitPost(c, "post.submit", models.PostReview, models.PostDraft)
+}
+
+/**
+  * @api {post} /users/:id/posts/:postId/withdraw POST_USERS_UID_POSTS_POSTID_WITHDRAW
+  * @apiName POST_USERS_UID_POSTS_POSTID_WITHDRAW
+  * @apiGroup Posts
+  * @apiPermission Authorization User
+  *
+  * @apiDescription The author takes a post in review or a scheduled post back
+  * to draft.
+  *
+  * @apiParam {String} id User unique id.
+  * @apiParam {String} postId Post unique id.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result, see submit.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "id": 3,
+        "status": "draft"
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func WithdrawPost(c *gin.Context) {
+	transitPost(c, "post.withdraw", models.PostDraft, models.PostReview, models.PostScheduled)
+}
+
+/**
+  * @api {post} /users/:id/posts/:postId/approve POST_USERS_UID_POSTS_POSTID_APPROVE
+  * @apiName POST_USERS_UID_POSTS_POSTID_APPROVE
+  * @apiGroup Posts
+  * @apiPermission Authorization User
+  *
+  * @apiDescription A reviewer publishes a post in review, or schedules it
+  * when publishAt is in the future. Scheduled posts are published by the
+  * scheduler once they are due, a scheduled post can also be approved again
+  * to publish it right away.
+  *
+  * @apiParam {String} id User unique id.
+  * @apiParam {String} postId Post unique id.
+  * @apiParam {Timestamp} [publishAt] When the post goes live, in ms.
+  * @apiParamExample {json} Request-Example:
+    {
+      "publishAt": 1553000000000
+    }
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result, see submit.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "id": 3,
+        "status": "scheduled"
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func ApprovePost(c *gin.Context) {
+	transitPost(c, "post.approve", models.PostPublished, models.PostReview, models.PostScheduled)
+}
+
+/**
+  * @api {post} /users/:id/posts/:postId/reject POST_USERS_UID_POSTS_POSTID_REJECT
+  * @apiName POST_USERS_UID_POSTS_POSTID_REJECT
+  * @apiGroup Posts
+  * @apiPermission Authorization User
+  *
+  * @apiDescription A reviewer sends a post in review back to draft.
+  *
+  * @apiParam {String} id User unique id.
+  * @apiParam {String} postId Post unique id.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result, see submit.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "id": 3,
+        "status": "draft"
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func RejectPost(c *gin.Context) {
+	transitPost(c, "post.reject", models.PostDraft, models.PostReview)
+}
+
+/**
+  * @api {post} /users/:id/posts/:postId/archive POST_USERS_UID_POSTS_POSTID_ARCHIVE
+  * @apiName POST_USERS_UID_POSTS_POSTID_ARCHIVE
+  * @apiGroup Posts
+  * @apiPermission Authorization User
+  *
+  * @apiDescription Takes a published post or a draft off.
+  *
+  * @apiParam {String} id User unique id.
+  * @apiParam {String} postId Post unique id.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result, see submit.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "id": 3,
+        "status": "archived"
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func ArchivePost(c *gin.Context) {
+	transitPost(c, "post.archive", models.PostArchived, models.PostDraft, models.PostPublished)
+}
+
+/**
+  * @api {post} /users/:id/posts/:postId/reopen POST_USERS_UID_POSTS_POSTID_REOPEN
+  * @apiName POST_USERS_UID_POSTS_POSTID_REOPEN
+  * @apiGroup Posts
+  * @apiPermission Authorization User
+  *
+  * @apiDescription The author turns an archived post into a draft again.
+  *
+  * @apiParam {String} id User unique id.
+  * @apiParam {String} postId Post unique id.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result, see submit.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "id": 3,
+        "status": "draft"
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func ReopenPost(c *gin.Context) {
+	transitPost(c, "post.reopen", models.PostDraft, models.PostArchived)
+}
+
+// transitPost moves the post of the request to status, the routes calling
+// it are what the policies grant. Each route moves posts from the statuses
+// from only, so withdrawing can't take a published post back to draft.
+// Approving with a publishAt in the future schedules the post instead of
+// publishing it.
+func transitPost(c *gin.Context, action string, status string, from ...string) {
+	var approval Approval
+	maid := c.GetStringMap("Maid")
+	user := maid["User"].(models.User)
+	userId := com.StrTo(c.Param("id")).MustInt()
+	id := com.StrTo(c.Param("postId")).MustInt()
+	code := e.INVALID_PARAMS
+	httpStatus := http.StatusOK
+
+	defer func() {
+		response := map[string]interface{}{
+			"status":     code,
+			"data":       map[string]interface{}{"id": id, "status": status},
+			"httpStatus": httpStatus,
+		}
+		c.Set("response", response)
+	}()
+
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&approval); err != nil {
+			return
+		}
+	}
+
+	valid := validation.Validation{}
+	valid.Min(userId, 1, "id").Message("ID must greater than 0")
+	valid.Min(id, 1, "postId").Message("ID must greater than 0")
+
+	if valid.HasErrors() {
+		for _, err := range valid.Errors {
+			logging.Info(err.Key, err.Message)
+		}
+		return
+	}
+
+	post := models.GetUserPost(userId, id)
+	if !orgUser(c, userId) || post.ID == 0 {
+		code = e.RECORD_NOT_EXIST
+		return
+	}
+
+	if !inStatus(post.Status, from) {
+		logging.Info(action, post.Status, "->", status)
+		code, httpStatus = e.STATUS_CONFLICT, http.StatusConflict
+		return
+	}
+	if status == models.PostPublished && post.Status == models.PostReview &&
+		approval.PublishAt > time.Now().UnixNano()/1000000 {
+		status = models.PostScheduled
+	}
+	if err := models.TransitPost(id, post.Status, status, approval.PublishAt); err != nil {
+		if err == models.ErrPostTransition {
+			logging.Info(action, post.Status, "->", status)
+			code, httpStatus = e.STATUS_CONFLICT, http.StatusConflict
+			return
+		}
+		logging.Error(action, err)
+		code = e.DATABASE_ERROR
+		return
+	}
+	models.AddAudit(models.Audit{
+		UserId: user.ID,
+		Action: action,
+		Target: fmt.Sprintf("post_%d", id),
+		IP:     c.ClientIP(),
+		Detail: post.Status + " -> " + status,
+	})
+	code = e.SUCCESS
+}
+
+// textStatuses are the statuses in which the title, desc and content of a
+// post may change, what readers see goes through review again
+var textStatuses = []string{models.PostDraft}
+
+func inStatus(status string, statuses []string) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,384 @@
+package posts
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Unknwon/com"
+	"github.com/astaxie/beego/validation"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Chalin-Shi/gout/libs/e"
+	"github.com/Chalin-Shi/gout/libs/logging"
+	"github.com/Chalin-Shi/gout/libs/util"
+	"github.com/Chalin-Shi/gout/models"
+)
+
+// Merge is the body of POST /tags/:tagId/merge
+type Merge struct {
+	Into int `json:"into"`
+}
+
+// orgTag finds a tag of the organization of the request
+func orgTag(c *gin.Context, id int) (models.Tag, bool) {
+	maid := c.GetStringMap("Maid")
+	org := maid["Org"].(models.Organization)
+	tag := models.GetTag(id)
+	return tag, tag.ID > 0 && tag.OrgId == org.ID
+}
+
+/**
+  * @api {get} /tags GET_TAGS
+  * @apiName GET_TAGS
+  * @apiGroup Tags
+  * @apiPermission Authorization User
+  *
+  * @apiDescription Tags of the organization of the request with the number
+  * of posts they are on. Filters are written field=value with the operators
+  * = != > >= < <= and ~= for "contains", on id, name, postCount, createdAt
+  * and updatedAt.
+  *
+  * @apiParam {Number} [start=0] Offset.
+  * @apiParam {Number} [limit=10] Page size, at most MAX_PAGE_SIZE.
+  * @apiParam {String} [cursor] Walk the list by id instead of start, empty for the first page and then data.pagination.next.
+  * @apiParam {String} [sort] Fields to sort by, e.g. -postCount,name.
+  * @apiParam (Authorization) {String} token Only admin user can post this.
+  * @apiParamExample {json} Request-Example:
+    GET /api/tags?sort=-postCount
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data.pagination Tag pagination.
+  * @apiSuccess {Object[]} data.list Tag list.
+  * @apiSuccess {Number} data.list.postCount Posts the tag is on.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "pagination": {
+          "total": 1,
+          "start": 0,
+          "limit": 10
+        },
+        "list": [
+          {
+            "id": 1,
+            "orgId": 1,
+            "name": "release",
+            "postCount": 3,
+            "createdAt": 1526977135000,
+            "updatedAt": 1526977135000
+          }
+        ]
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func GetTags(c *gin.Context) {
+	listTopics(c, models.TagFields, func(q util.Query, maps map[string]interface{}) (interface{}, util.Pagination, error) {
+		return models.GetTags(q, maps)
+	})
+}
+
+/**
+  * @api {post} /tags POST_TAGS
+  * @apiName POST_TAGS
+  * @apiGroup Tags
+  * @apiPermission Authorization User
+  *
+  * @apiDescription Creates a tag in the organization of the request. Tags
+  * named by posts are created with them as well.
+  *
+  * @apiParam {String} name Tag name, unique within the organization.
+  * @apiParam (Authorization) {String} token Only admin user can post this.
+  * @apiParamExample {json} Request-Example:
+    {
+      "name": "release"
+    }
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result.
+  * @apiSuccess {Number} data.id Tag id.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "id": 1
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func AddTag(c *gin.Context) {
+	var form models.Tag
+	maid := c.GetStringMap("Maid")
+	org := maid["Org"].(models.Organization)
+	code := e.INVALID_PARAMS
+	data := make(map[string]interface{})
+
+	defer func() {
+		response := map[string]interface{}{
+			"status": code,
+			"data":   data,
+		}
+		c.Set("response", response)
+	}()
+
+	if err := c.ShouldBindJSON(&form); err != nil {
+		return
+	}
+
+	form.Name = strings.TrimSpace(form.Name)
+	valid := validation.Validation{}
+	validTagName(&valid, form.Name, "name")
+
+	if valid.HasErrors() {
+		for _, err := range valid.Errors {
+			logging.Info(err.Key, err.Message)
+		}
+		return
+	}
+
+	if models.GetOrgTagIdByName(org.ID, form.Name) > 0 {
+		code = e.RECORD_HAS_EXISTED
+		return
+	}
+
+	tag := models.Tag{OrgId: org.ID, Name: form.Name}
+	if err := models.AddTag(&tag); err != nil {
+		logging.Error("add tag", err)
+		code = e.DATABASE_ERROR
+		return
+	}
+
+	data["id"] = tag.ID
+	code = e.SUCCESS
+}
+
+/**
+  * @api {put} /tags/:tagId PUT_TAGS_TAGID
+  * @apiName PUT_TAGS_TAGID
+  * @apiGroup Tags
+  * @apiPermission Authorization User
+  *
+  * @apiDescription Renames a tag, the posts it is on change with it. Tags
+  * are joined with POST /tags/:tagId/merge rather than renamed to the name
+  * of another tag.
+  *
+  * @apiParam {String} name Tag name, unique within the organization.
+  * @apiParam (Authorization) {String} token Only admin user can post this.
+  * @apiParamExample {json} Request-Example:
+    {
+      "name": "releases"
+    }
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result.
+  * @apiSuccess {Number} data.id Tag id.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "id": 1
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func EditTag(c *gin.Context) {
+	var form models.Tag
+	tagId := com.StrTo(c.Param("tagId")).MustInt()
+	code := e.INVALID_PARAMS
+
+	defer func() {
+		response := map[string]interface{}{
+			"status": code,
+			"data":   map[string]int{"id": tagId},
+		}
+		c.Set("response", response)
+	}()
+
+	if err := c.ShouldBindJSON(&form); err != nil {
+		return
+	}
+
+	form.Name = strings.TrimSpace(form.Name)
+	valid := validation.Validation{}
+	valid.Min(tagId, 1, "tagId").Message("ID must greater than 0")
+	validTagName(&valid, form.Name, "name")
+
+	if valid.HasErrors() {
+		for _, err := range valid.Errors {
+			logging.Info(err.Key, err.Message)
+		}
+		return
+	}
+
+	tag, ok := orgTag(c, tagId)
+	if !ok {
+		code = e.RECORD_NOT_EXIST
+		return
+	}
+	if form.Name == tag.Name {
+		code = e.SUCCESS
+		return
+	}
+	// a tag may change the case of its own name
+	if id := models.GetOrgTagIdByName(tag.OrgId, form.Name); id > 0 && id != tagId {
+		code = e.RECORD_HAS_EXISTED
+		return
+	}
+
+	if err := models.RenameTag(tagId, form.Name); err != nil {
+		logging.Error("rename tag", err)
+		code = e.DATABASE_ERROR
+		return
+	}
+	auditTopic(c, "tag.rename", "tag", tagId, fmt.Sprintf("%s to %s", tag.Name, form.Name))
+	code = e.SUCCESS
+}
+
+/**
+  * @api {post} /tags/:tagId/merge POST_TAGS_TAGID_MERGE
+  * @apiName POST_TAGS_TAGID_MERGE
+  * @apiGroup Tags
+  * @apiPermission Authorization User
+  *
+  * @apiDescription Moves the posts of the tag to the tag into and deletes
+  * the tag, all at once.
+  *
+  * @apiParam {Number} into Tag the posts move to.
+  * @apiParam (Authorization) {String} token Only admin user can post this.
+  * @apiParamExample {json} Request-Example:
+    {
+      "into": 2
+    }
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result.
+  * @apiSuccess {Number} data.id Tag id.
+  * @apiSuccess {Number} data.into Tag the posts moved to.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "id": 1,
+        "into": 2
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func MergeTag(c *gin.Context) {
+	var merge Merge
+	tagId := com.StrTo(c.Param("tagId")).MustInt()
+	code := e.INVALID_PARAMS
+
+	defer func() {
+		response := map[string]interface{}{
+			"status": code,
+			"data":   map[string]int{"id": tagId, "into": merge.Into},
+		}
+		c.Set("response", response)
+	}()
+
+	if err := c.ShouldBindJSON(&merge); err != nil {
+		return
+	}
+
+	valid := validation.Validation{}
+	valid.Min(tagId, 1, "tagId").Message("ID must greater than 0")
+	valid.Min(merge.Into, 1, "into").Message("Into must greater than 0")
+
+	if valid.HasErrors() {
+		for _, err := range valid.Errors {
+			logging.Info(err.Key, err.Message)
+		}
+		return
+	}
+	if merge.Into == tagId {
+		logging.Info("into", models.ErrTagMerge)
+		return
+	}
+
+	if _, ok := orgTag(c, tagId); !ok {
+		code = e.RECORD_NOT_EXIST
+		return
+	}
+	if _, ok := orgTag(c, merge.Into); !ok {
+		code = e.RECORD_NOT_EXIST
+		return
+	}
+
+	if err := models.MergeTag(tagId, merge.Into); err != nil {
+		logging.Error("merge tag", err)
+		code = e.DATABASE_ERROR
+		return
+	}
+	auditTopic(c, "tag.merge", "tag", tagId, fmt.Sprintf("into tag_%d", merge.Into))
+	code = e.SUCCESS
+}
+
+/**
+  * @api {delete} /tags/:tagId DELETE_TAGS_TAGID
+  * @apiName DELETE_TAGS_TAGID
+  * @apiGroup Tags
+  * @apiPermission Authorization User
+  *
+  * @apiDescription Takes the tag off its posts and deletes it.
+  *
+  * @apiParam (Authorization) {String} token Only admin user can post this.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result.
+  * @apiSuccess {Number} data.id Tag id.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    {
+      "status": "100000",
+      "data": {
+        "id": 1
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func DeleteTag(c *gin.Context) {
+	deleteTopic(c, "tagId", "tag", func(id int) bool {
+		_, ok := orgTag(c, id)
+		return ok
+	}, models.DeleteTag)
+}
+
+// validTagName checks a tag name of the request, key names it in the errors.
+// Names are trimmed before.
+func validTagName(valid *validation.Validation, name string, key string) {
+	valid.Required(name, key).Message("Tag name is required")
+	valid.MaxSize(name, 50, key).Message("Tag name must be at most 50 characters")
+}
@@ -0,0 +1,101 @@
+package posts
+
+import (
+	"fmt"
+
+	"github.com/Unknwon/com"
+	"github.com/astaxie/beego/validation"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Chalin-Shi/gout/libs/e"
+	"github.com/Chalin-Shi/gout/libs/logging"
+	"github.com/Chalin-Shi/gout/libs/util"
+	"github.com/Chalin-Shi/gout/models"
+)
+
+// Tags and categories are the topics of posts, both belong to an
+// organization and are managed alike
+
+// listTopics answers a page of the tags or categories of the organization
+func listTopics(c *gin.Context, fields util.Fields, list func(q util.Query, maps map[string]interface{}) (interface{}, util.Pagination, error)) {
+	code := e.INVALID_PARAMS
+	data := make(map[string]interface{})
+
+	defer func() {
+		response := map[string]interface{}{
+			"status": code,
+			"data":   data,
+		}
+		c.Set("response", response)
+	}()
+
+	q, err := util.GetQuery(c, fields, "name")
+	if err != nil {
+		logging.Info("query", err)
+		return
+	}
+
+	maid := c.GetStringMap("Maid")
+	org := maid["Org"].(models.Organization)
+	topics, page, err := list(q, map[string]interface{}{"org_id": org.ID})
+	if err != nil {
+		logging.Error("topics", err)
+		code = e.DATABASE_ERROR
+		return
+	}
+
+	data["list"] = topics
+	data["pagination"] = page
+	code = e.SUCCESS
+}
+
+// deleteTopic deletes the tag or category, kind, of the path parameter param
+// when found finds it in the organization
+func deleteTopic(c *gin.Context, param string, kind string, found func(id int) bool, remove func(id int) error) {
+	id := com.StrTo(c.Param(param)).MustInt()
+	code := e.INVALID_PARAMS
+
+	defer func() {
+		response := map[string]interface{}{
+			"status": code,
+			"data":   map[string]int{"id": id},
+		}
+		c.Set("response", response)
+	}()
+
+	valid := validation.Validation{}
+	valid.Min(id, 1, param).Message("ID must greater than 0")
+
+	if valid.HasErrors() {
+		for _, err := range valid.Errors {
+			logging.Info(err.Key, err.Message)
+		}
+		return
+	}
+
+	if !found(id) {
+		code = e.RECORD_NOT_EXIST
+		return
+	}
+
+	if err := remove(id); err != nil {
+		logging.Error("delete "+kind, err)
+		code = e.DATABASE_ERROR
+		return
+	}
+	auditTopic(c, kind+".delete", kind, id, "")
+	code = e.SUCCESS
+}
+
+// auditTopic records a change the caller made to the tag or category id
+func auditTopic(c *gin.Context, action string, kind string, id int, detail string) {
+	maid := c.GetStringMap("Maid")
+	admin := maid["User"].(models.User)
+	models.AddAudit(models.Audit{
+		UserId: admin.ID,
+		Action: action,
+		Target: fmt.Sprintf("%s_%d", kind, id),
+		IP:     c.ClientIP(),
+		Detail: detail,
+	})
+}
@@ -0,0 +1,243 @@
+package user
+
+import (
+  "encoding/json"
+  "regexp"
+  "time"
+
+  "github.com/Unknwon/com"
+  "github.com/astaxie/beego/validation"
+  "github.com/gin-gonic/gin"
+
+  "github.com/Chalin-Shi/gout/libs/e"
+  "github.com/Chalin-Shi/gout/libs/logging"
+  "github.com/Chalin-Shi/gout/libs/setting"
+  "github.com/Chalin-Shi/gout/libs/util"
+  "github.com/Chalin-Shi/gout/models"
+)
+
+type NewAccessToken struct {
+  Name      string         `json:"name"`
+  OrgId     int            `json:"orgId"`
+  Scopes    []models.Scope `json:"scopes"`
+  ExpiresIn int            `json:"expiresIn"`
+}
+
+/**
+  * @api {get} /user/tokens GET_USER_TOKENS
+  * @apiName GET_USER_TOKENS
+  * @apiGroup User
+  *
+  * @apiParam (Login) {String} token Only logged in users can post this.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object[]} data Personal access tokens of the user.
+  * @apiSuccess {Number} data.id Token id.
+  * @apiSuccess {String} data.name Token name.
+  * @apiSuccess {Number} data.orgId Organization the token is bound to, 0 if none.
+  * @apiSuccess {String} data.prefix First characters of the token, for identification.
+  * @apiSuccess {Object[]} data.scopes Requests the token can make.
+  * @apiSuccess {Timestamp} data.expiresAt Token expiry.
+  * @apiSuccess {Timestamp} data.lastUsedAt Last request made with the token.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": [{
+        "id": 1,
+        "name": "ci",
+        "prefix": "gout_3fa85f64",
+        "scopes": [{"path": "/api/users/*", "method": "GET"}],
+        "expiresAt": 1553500800000,
+        "lastUsedAt": 1552896000000
+      }],
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func GetAccessTokens(c *gin.Context) {
+  maid := c.GetStringMap("Maid")
+  user := maid["User"].(models.User)
+
+  response := map[string]interface{}{
+    "status": e.SUCCESS,
+    "data":   models.GetAccessTokens(user.ID),
+  }
+  c.Set("response", response)
+}
+
+/**
+  * @api {post} /user/tokens POST_USER_TOKENS
+  * @apiName POST_USER_TOKENS
+  * @apiGroup User
+  *
+  * @apiDescription Creates a personal access token. It is sent as a bearer
+  * token and can only make requests matching both its scopes and the
+  * policies of the user.
+  *
+  * @apiParam (Login) {String} token Only logged in users can post this.
+  * @apiParam {String} name Token name, unique per user.
+  * @apiParam {Object[]} scopes Path patterns and method regexps, as in policies.
+  * @apiParam {Number} expiresIn Lifetime in days.
+  * @apiParam {Number} [orgId] Bind the token to one of the user's organizations.
+  * @apiParamExample {json} Request-Example:
+    {
+      "name": "ci",
+      "orgId": 1,
+      "scopes": [{"path": "/api/users/*", "method": "GET"}],
+      "expiresIn": 30
+    }
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result.
+  * @apiSuccess {Number} data.id Token id.
+  * @apiSuccess {String} data.token The token, only shown once.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": {
+        "id": 1,
+        "token": "gout_3fa85f6457174562b3fc2c963f66afa6c7a1d2e3"
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func AddAccessToken(c *gin.Context) {
+  maid := c.GetStringMap("Maid")
+  user := maid["User"].(models.User)
+  code := e.INVALID_PARAMS
+  data := make(map[string]interface{})
+
+  defer func() {
+    response := map[string]interface{}{
+      "status": code,
+      "data":   data,
+    }
+    c.Set("response", response)
+  }()
+
+  var newToken NewAccessToken
+  if err := c.ShouldBindJSON(&newToken); err != nil {
+    return
+  }
+
+  valid := validation.Validation{}
+  valid.Required(newToken.Name, "name").Message("Name is required")
+  valid.MinSize(newToken.Scopes, 1, "scopes").Message("Scopes are required")
+  valid.Range(newToken.ExpiresIn, 1, setting.AccessTokenMaxDays, "expiresIn").Message("ExpiresIn is out of range")
+  for _, scope := range newToken.Scopes {
+    valid.Required(scope.Path, "scopes.path").Message("Scope path is required")
+    valid.Required(scope.Method, "scopes.method").Message("Scope method is required")
+    if _, err := regexp.Compile(scope.Method); err != nil {
+      valid.SetError("scopes.method", "Scope method is not a valid regexp")
+    }
+  }
+
+  if valid.HasErrors() {
+    for _, err := range valid.Errors {
+      logging.Info(err.Key, err.Message)
+    }
+    return
+  }
+
+  if newToken.OrgId != 0 && !models.IsOrgMember(newToken.OrgId, user.ID) && user.Username != "root" {
+    code = e.PERMISSION_DENIED
+    return
+  }
+
+  if models.ExistAccessTokenByName(user.ID, newToken.Name) {
+    code = e.RECORD_HAS_EXISTED
+    return
+  }
+
+  scopes, _ := json.Marshal(newToken.Scopes)
+  secret := util.AccessTokenPrefix + util.RandToken(20)
+  expireTime := time.Now().Add(time.Duration(newToken.ExpiresIn) * 24 * time.Hour)
+  accessToken := models.AccessToken{
+    UserId:    user.ID,
+    OrgId:     newToken.OrgId,
+    Name:      newToken.Name,
+    Prefix:    secret[:len(util.AccessTokenPrefix)+8],
+    TokenHash: util.HashToken(secret),
+    Scopes:    models.JSON(scopes),
+    ExpiresAt: expireTime.UnixNano() / 1000000,
+  }
+  models.AddAccessToken(&accessToken)
+
+  data["id"] = accessToken.ID
+  data["token"] = secret
+  code = e.SUCCESS
+}
+
+/**
+  * @api {delete} /user/tokens/:id DELETE_USER_TOKENS_ID
+  * @apiName DELETE_USER_TOKENS_ID
+  * @apiGroup User
+  *
+  * @apiParam (Login) {String} token Only logged in users can post this.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result.
+  * @apiSuccess {Number} data.id Token id.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": {
+        "id": 1
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func DeleteAccessToken(c *gin.Context) {
+  maid := c.GetStringMap("Maid")
+  user := maid["User"].(models.User)
+  id := com.StrTo(c.Param("id")).MustInt()
+  code := e.INVALID_PARAMS
+
+  defer func() {
+    response := map[string]interface{}{
+      "status": code,
+      "data":   map[string]int{"id": id},
+    }
+    c.Set("response", response)
+  }()
+
+  valid := validation.Validation{}
+  valid.Min(id, 1, "id").Message("ID must greater than 0")
+
+  if valid.HasErrors() {
+    for _, err := range valid.Errors {
+      logging.Info(err.Key, err.Message)
+    }
+    return
+  }
+
+  if !models.RevokeAccessToken(user.ID, id) {
+    code = e.RECORD_NOT_EXIST
+    return
+  }
+  code = e.SUCCESS
+}
@@ -0,0 +1,37 @@
+package user
+
+import (
+  "net/http"
+
+  "github.com/gin-gonic/gin"
+
+  "github.com/Chalin-Shi/gout/libs/util"
+)
+
+/**
+  * @api {get} /.well-known/jwks.json GET_WELL_KNOWN_JWKS
+  * @apiName GET_WELL_KNOWN_JWKS
+  * @apiGroup Auth
+  * @apiPermission None
+  *
+  * @apiDescription Public keys verifying gout-issued tokens, in the JSON Web
+  * Key Set format. Tokens name their key in the kid header. The set is empty
+  * when tokens are signed with HS256.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "keys": [{
+        "kty": "RSA",
+        "kid": "5f1c2a9be07d44e3",
+        "alg": "RS256",
+        "use": "sig",
+        "n": "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+        "e": "AQAB"
+      }]
+    }
+  *
+*/
+func GetJWKS(c *gin.Context) {
+  c.JSON(http.StatusOK, util.JWKS())
+}
@@ -0,0 +1,54 @@
+package user
+
+import (
+  "github.com/Chalin-Shi/gout/libs/logging"
+  "github.com/Chalin-Shi/gout/libs/setting"
+  "github.com/Chalin-Shi/gout/libs/util"
+  "github.com/Chalin-Shi/gout/models"
+)
+
+// authenticate checks a password login and returns the user id or 0. With
+// LDAP enabled the directory decides, the local password is only consulted
+// for root, or with FALLBACK_LOCAL when the directory cannot be reached. A
+// user the directory does not know is refused, otherwise removing someone
+// from the directory would leave their local password working.
+func authenticate(email string, password string) int {
+  if !setting.LdapEnabled {
+    return models.CheckUser(email, password)
+  }
+
+  local := models.GetUserByEmail(email)
+  if local.Username == "root" {
+    return models.CheckUser(email, password)
+  }
+
+  entry, err := util.LdapAuthenticate(email, password)
+  switch err {
+  case nil:
+  case util.ErrLdapInvalidCredentials, util.ErrLdapUserNotFound:
+    return 0
+  default:
+    logging.Warn("ldap", err)
+    if setting.LdapFallbackLocal {
+      return models.CheckUser(email, password)
+    }
+    return 0
+  }
+
+  if entry.Email != email {
+    local = models.GetUserByEmail(entry.Email)
+  }
+  if local.ID > 0 {
+    return local.ID
+  }
+  if !setting.LdapAutoProvision {
+    logging.Info("ldap", "no user for", entry.Email)
+    return 0
+  }
+  user, err := provisionUser(entry.Email, entry.Username)
+  if err != nil {
+    logging.Warn("ldap", err)
+    return 0
+  }
+  return user.ID
+}
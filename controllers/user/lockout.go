@@ -0,0 +1,80 @@
+package user
+
+import (
+  "fmt"
+  "time"
+
+  "github.com/Chalin-Shi/gout/libs/e"
+  "github.com/Chalin-Shi/gout/libs/logging"
+  "github.com/Chalin-Shi/gout/libs/setting"
+  "github.com/Chalin-Shi/gout/models"
+)
+
+// backoff is how long a source has to wait after its last failure
+func backoff(failures int) time.Duration {
+  if failures < setting.LoginBackoffAfter {
+    return 0
+  }
+  wait := setting.LoginBackoffBase
+  for i := setting.LoginBackoffAfter; i < failures && wait < setting.LoginBackoffMax; i++ {
+    wait *= 2
+  }
+  if wait > setting.LoginBackoffMax {
+    wait = setting.LoginBackoffMax
+  }
+  return wait
+}
+
+// checkLockout returns the error code refusing a login attempt before the
+// password is even looked at, or SUCCESS
+func checkLockout(email string, ip string) string {
+  nowTime := time.Now().UnixNano() / 1000000
+  account := models.GetLoginFailure(models.EmailSource(email))
+  if account.LockedUntil > nowTime {
+    return e.ACCOUNT_LOCKED
+  }
+  client := models.GetLoginFailure(models.IPSource(ip))
+  if client.LockedUntil > nowTime {
+    return e.TOO_MANY_ATTEMPTS
+  }
+
+  for _, failure := range []models.LoginFailure{account, client} {
+    wait := int64(backoff(failure.Failures) / time.Millisecond)
+    if failure.LastFailedAt+wait > nowTime {
+      return e.TOO_MANY_ATTEMPTS
+    }
+  }
+  return e.SUCCESS
+}
+
+// recordFailure counts a failed login for both the account and the client
+// and audits the lockouts it causes
+func recordFailure(email string, ip string) {
+  window := setting.LoginFailureWindow
+  lockFor := setting.LoginLockDuration
+  if _, locked := models.AddLoginFailure(models.EmailSource(email), ip, window, setting.LoginMaxFailures, lockFor); locked {
+    logging.Warn("account locked", email, ip)
+    user := models.GetUserByEmail(email)
+    models.AddAudit(models.Audit{
+      Action: "user.lockout",
+      Target: models.EmailSource(email),
+      IP:     ip,
+      Detail: fmt.Sprintf("user %d locked for %s", user.ID, lockFor),
+    })
+  }
+  if _, locked := models.AddLoginFailure(models.IPSource(ip), ip, window, setting.LoginIPMaxFailures, lockFor); locked {
+    logging.Warn("client locked", ip)
+    models.AddAudit(models.Audit{
+      Action: "ip.lockout",
+      Target: models.IPSource(ip),
+      IP:     ip,
+      Detail: fmt.Sprintf("client locked for %s", lockFor),
+    })
+  }
+}
+
+// clearFailures resets the counter of an account once a login went through
+// all of its steps
+func clearFailures(email string) {
+  models.ClearLoginFailure(models.EmailSource(email))
+}
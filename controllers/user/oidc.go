@@ -0,0 +1,333 @@
+package user
+
+import (
+  "crypto/subtle"
+  "fmt"
+  "net/http"
+  "net/url"
+  "sort"
+  "strings"
+  "time"
+
+  "github.com/gin-gonic/gin"
+
+  "github.com/Chalin-Shi/gout/libs/e"
+  "github.com/Chalin-Shi/gout/libs/logging"
+  "github.com/Chalin-Shi/gout/libs/setting"
+  "github.com/Chalin-Shi/gout/libs/util"
+  "github.com/Chalin-Shi/gout/middlewares"
+  "github.com/Chalin-Shi/gout/models"
+)
+
+const (
+  oidcStateCookie = "oidc_state"
+  oidcCookiePath  = "/api/auth/oidc"
+)
+
+/**
+  * @api {get} /auth/oidc/login GET_AUTH_OIDC_LOGIN
+  * @apiName GET_AUTH_OIDC_LOGIN
+  * @apiGroup Auth
+  * @apiPermission None
+  * @apiDescription Redirects the browser to the identity provider, the login
+  * is finished at /auth/oidc/callback. The state of the login is kept in an
+  * HttpOnly cookie as well.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 302 Found
+    Location: https://idp.example.com/authorize?response_type=code&client_id=gout&...
+  *
+*/
+func OidcLogin(c *gin.Context) {
+  provider, err := util.GetOIDCProvider()
+  if err != nil {
+    logging.Warn("oidc", err)
+    oidcFailed(c)
+    return
+  }
+
+  state := models.OidcState{
+    State:     util.RandToken(16),
+    Nonce:     util.RandToken(16),
+    Verifier:  util.RandToken(32),
+    ExpiresAt: time.Now().Add(setting.OidcStateExpire).UnixNano() / 1000000,
+  }
+  if !models.AddOidcState(state) {
+    oidcFailed(c)
+    return
+  }
+
+  // the callback only accepts the state from the browser that started the
+  // login, a state sent along by someone else can't finish it
+  maxAge := int(setting.OidcStateExpire / time.Second)
+  c.SetCookie(oidcStateCookie, state.State, maxAge, oidcCookiePath, "", c.Request.TLS != nil, true)
+  c.Redirect(http.StatusFound, provider.AuthCodeURL(state.State, state.Nonce, state.Verifier))
+}
+
+/**
+  * @api {get} /auth/oidc/callback GET_AUTH_OIDC_CALLBACK
+  * @apiName GET_AUTH_OIDC_CALLBACK
+  * @apiGroup Auth
+  * @apiPermission None
+  * @apiDescription Redirect target of the identity provider, the state must
+  * match the state cookie set at /auth/oidc/login. Users are found by the
+  * subject of the ID token. On the first login a user is matched by its
+  * verified email and linked to the subject, root and organization admins are
+  * never linked that way. Users are created on their first login when [oidc]
+  * AUTO_PROVISION is on,
+  * provider groups listed in [oidc] GROUP_MAP set the user's group. When
+  * [oidc] POST_LOGIN_REDIRECT is set the browser is sent there with the
+  * response data in the url fragment.
+  *
+  * @apiParam {String} code Authorization code.
+  * @apiParam {String} state State of the login started at /auth/oidc/login.
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Same data as /auth/login.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": {
+        "token": "eyJhbGciOiJSUzI1NiIsImtpZCI6IjRmMWQ...",
+        "refreshToken": "9b1f0c7be1d2a4f5c3e8d7a6b5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b7c6",
+        "expiresIn": 900
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func OidcCallback(c *gin.Context) {
+  code := e.ERROR_AUTH_OIDC
+  data := make(map[string]interface{})
+
+  defer func() {
+    if setting.OidcPostLoginRedirect != "" {
+      fragment := url.Values{}
+      fragment.Set("status", code)
+      for k, v := range data {
+        fragment.Set(k, fmt.Sprint(v))
+      }
+      c.Redirect(http.StatusFound, setting.OidcPostLoginRedirect+"#"+fragment.Encode())
+      return
+    }
+    c.JSON(http.StatusOK, gin.H{
+      "status":  code,
+      "data":    data,
+      "message": e.GetMsg(code),
+    })
+  }()
+
+  if reason := c.Query("error"); reason != "" {
+    logging.Info("oidc", reason, c.Query("error_description"))
+    return
+  }
+
+  cookie, _ := c.Cookie(oidcStateCookie)
+  c.SetCookie(oidcStateCookie, "", -1, oidcCookiePath, "", c.Request.TLS != nil, true)
+  if cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(c.Query("state"))) != 1 {
+    code = e.INVALID_PARAMS
+    return
+  }
+  state := models.TakeOidcState(c.Query("state"))
+  if state.ID == 0 {
+    code = e.INVALID_PARAMS
+    return
+  }
+
+  provider, err := util.GetOIDCProvider()
+  if err != nil {
+    logging.Warn("oidc", err)
+    return
+  }
+  idToken, err := provider.Exchange(c.Query("code"), state.Verifier)
+  if err != nil {
+    logging.Warn("oidc", err)
+    return
+  }
+  claims, err := provider.VerifyIDToken(idToken, state.Nonce)
+  if err != nil {
+    logging.Warn("oidc", err)
+    return
+  }
+
+  subject, _ := claims["sub"].(string)
+  email, _ := claims["email"].(string)
+  verified, _ := claims["email_verified"].(bool)
+  if subject == "" || email == "" || !verified {
+    logging.Info("oidc", "id token without a subject or a verified email", claims["sub"])
+    return
+  }
+
+  if code = checkLockout(email, c.ClientIP()); code != e.SUCCESS {
+    return
+  }
+  code = e.ERROR_AUTH_OIDC
+
+  user, ok := oidcUser(provider.Issuer, subject, email, claims)
+  if !ok {
+    return
+  }
+  if user.Disabled {
+    logging.Info("oidc", "disabled user", email)
+    return
+  }
+  if user.Username != "root" {
+    syncOidcGroups(&user, util.ClaimStrings(claims, setting.OidcGroupsClaim))
+  }
+
+  models.AddAudit(models.Audit{
+    UserId: user.ID,
+    Action: "user.oidc_login",
+    Target: fmt.Sprintf("u_%d", user.ID),
+    IP:     c.ClientIP(),
+    Detail: fmt.Sprintf("%v", claims["sub"]),
+  })
+
+  challenge, err := mfaChallenge(user)
+  if err != nil {
+    code = e.ERROR_AUTH_TOKEN
+    return
+  }
+  if challenge != nil {
+    data = challenge
+    code = e.SUCCESS
+    return
+  }
+
+  tokens, err := startSession(c, user.ID)
+  if err != nil {
+    code = e.ERROR_AUTH_TOKEN
+    return
+  }
+
+  data = tokens
+  code = e.SUCCESS
+}
+
+// oidcUser finds the user linked to the subject, a user logging in for the
+// first time is matched by email or provisioned and then linked
+func oidcUser(issuer string, subject string, email string, claims map[string]interface{}) (models.User, bool) {
+  if link := models.GetOidcLink(issuer, subject); link.ID > 0 {
+    user := models.GetUser(link.UserId)
+    return user, user.ID > 0
+  }
+
+  user := models.GetUserByEmail(email)
+  if user.ID == 0 {
+    if !setting.OidcAutoProvision {
+      logging.Info("oidc", "no user for", email)
+      return user, false
+    }
+    username, _ := claims["preferred_username"].(string)
+    if username == "" {
+      username, _ = claims["name"].(string)
+    }
+    var err error
+    if user, err = provisionUser(email, username); err != nil {
+      logging.Warn("oidc", err)
+      return user, false
+    }
+  } else if models.IsPrivilegedUser(user) {
+    // whoever controls the email at the provider would take over the account
+    logging.Warn("oidc", "refused to link privileged user", email, subject)
+    return user, false
+  } else if models.ExistOidcLinkByUser(issuer, user.ID) {
+    logging.Warn("oidc", "user is linked to another subject", email, subject)
+    return user, false
+  }
+
+  if !models.AddOidcLink(models.OidcLink{UserId: user.ID, Issuer: issuer, Subject: subject}) {
+    return user, false
+  }
+  return user, true
+}
+
+func oidcFailed(c *gin.Context) {
+  c.JSON(http.StatusOK, gin.H{
+    "status":  e.ERROR_AUTH_OIDC,
+    "data":    make(map[string]interface{}),
+    "message": e.GetMsg(e.ERROR_AUTH_OIDC),
+  })
+}
+
+// provisionUser creates the local account of a first time OIDC or LDAP
+// login, its random password is never handed out so the local password
+// login stays closed for it. It joins the default organization.
+func provisionUser(email string, username string) (models.User, error) {
+  if username == "" || username == "root" {
+    username = strings.SplitN(email, "@", 2)[0]
+  }
+
+  password, err := util.HashPassword(util.RandToken(32))
+  if err != nil {
+    return models.User{}, err
+  }
+  user := models.User{Email: email, Username: username, Password: password}
+  if !models.CreateUser(&user) {
+    return models.User{}, fmt.Errorf("could not create user %s", email)
+  }
+  if err := models.SetOrgMember(models.DefaultOrgId(), user.ID, models.OrgRoleMember); err != nil {
+    return models.User{}, err
+  }
+  return user, nil
+}
+
+// syncOidcGroups mirrors the provider groups named in GROUP_MAP onto the
+// user, groups outside of the map are left as they are. Mapped groups are
+// looked up in the default organization.
+func syncOidcGroups(user *models.User, groups []string) {
+  if len(setting.OidcGroupMap) == 0 {
+    return
+  }
+
+  member := make(map[string]bool)
+  for _, group := range groups {
+    if name, ok := setting.OidcGroupMap[group]; ok {
+      member[name] = true
+    }
+  }
+
+  names := make([]string, 0, len(setting.OidcGroupMap))
+  for _, name := range setting.OidcGroupMap {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+
+  current := make(map[int]bool)
+  for _, id := range models.GetUserGroupIds(user.ID) {
+    current[id] = true
+  }
+
+  orgId := models.DefaultOrgId()
+  changed := false
+  for _, name := range names {
+    id := models.GetOrgGroupIdByName(orgId, name)
+    if id == 0 || member[name] == current[id] {
+      continue
+    }
+    var err error
+    if member[name] {
+      err = models.AddUserGroup(user.ID, id)
+    } else {
+      err = models.RemoveUserGroup(user.ID, id)
+    }
+    if err != nil {
+      logging.Error("oidc group", err)
+      continue
+    }
+    changed = true
+  }
+
+  if changed {
+    *user = models.GetUser(user.ID)
+    if err := middlewares.ReloadPolicy(); err != nil {
+      logging.Error("reload policy", err)
+    }
+  }
+}
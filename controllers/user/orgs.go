@@ -0,0 +1,61 @@
+package user
+
+import (
+  "github.com/gin-gonic/gin"
+
+  "github.com/Chalin-Shi/gout/libs/e"
+  "github.com/Chalin-Shi/gout/models"
+)
+
+/**
+  * @api {get} /user/orgs GET_USER_ORGS
+  * @apiName GET_USER_ORGS
+  * @apiGroup User
+  *
+  * @apiDescription Organizations of the user, the first one is used when a
+  * request carries no X-Org-Id header.
+  *
+  * @apiParam (Login) {String} token Only logged in users can post this.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object[]} data Organizations.
+  * @apiSuccess {Number} data.id Organization id.
+  * @apiSuccess {String} data.name Organization name.
+  * @apiSuccess {String} data.desc Organization description.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": [{
+        "id": 1,
+        "name": "default",
+        "desc": "",
+        "createdAt": 1552896000000,
+        "updatedAt": 1552896000000
+      }],
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func GetOrganizations(c *gin.Context) {
+  maid := c.GetStringMap("Maid")
+  user := maid["User"].(models.User)
+
+  orgs := models.GetUserOrganizations(user.ID)
+  if orgs == nil {
+    orgs = make([]models.Organization, 0)
+  }
+
+  response := map[string]interface{}{
+    "status": e.SUCCESS,
+    "data":   orgs,
+  }
+  c.Set("response", response)
+}
@@ -0,0 +1,218 @@
+package user
+
+import (
+  "crypto/subtle"
+  "fmt"
+  "net/http"
+  "time"
+
+  "github.com/astaxie/beego/validation"
+  "github.com/gin-gonic/gin"
+
+  "github.com/Chalin-Shi/gout/libs/e"
+  "github.com/Chalin-Shi/gout/libs/logging"
+  "github.com/Chalin-Shi/gout/libs/setting"
+  "github.com/Chalin-Shi/gout/libs/util"
+  "github.com/Chalin-Shi/gout/models"
+)
+
+type Forgot struct {
+  Email string `json:"email"`
+}
+
+type Reset struct {
+  Email    string `json:"email"`
+  Code     string `json:"code"`
+  Password string `json:"password"`
+}
+
+func resetCodeHash(email string, code string) string {
+  return util.HashToken(fmt.Sprintf("%s:%s", email, code))
+}
+
+/**
+  * @api {post} /auth/password/forgot POST_AUTH_PASSWORD_FORGOT
+  * @apiName POST_AUTH_PASSWORD_FORGOT
+  * @apiGroup Auth
+  * @apiPermission None
+  *
+  * @apiDescription Emails a one-time reset code. The response is the same
+  * whether or not the email is registered.
+  *
+  * @apiParam {String} email user email.
+  *
+  * @apiParamExample {json} Request-Example:
+    {
+      "email": "admin@linktime.cloud"
+    }
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": {},
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func ForgotPassword(c *gin.Context) {
+  var forgot Forgot
+  code := e.INVALID_PARAMS
+
+  defer func() {
+    c.JSON(http.StatusOK, gin.H{
+      "status":  code,
+      "data":    make(map[string]interface{}),
+      "message": e.GetMsg(code),
+    })
+  }()
+
+  if err := c.ShouldBindJSON(&forgot); err != nil {
+    return
+  }
+
+  valid := validation.Validation{}
+  email := forgot.Email
+  valid.Required(email, "email").Message("Email is required")
+  valid.Email(email, "email").Message("Email is invalid")
+
+  if valid.HasErrors() {
+    for _, err := range valid.Errors {
+      logging.Info(err.Key, err.Message)
+    }
+    return
+  }
+
+  // from here on the answer is always success so it can't be used to
+  // find out which emails are registered
+  code = e.SUCCESS
+
+  user := models.GetUserByEmail(email)
+  if user.ID == 0 {
+    return
+  }
+
+  nowTime := time.Now()
+  since := nowTime.Add(-setting.ResetThrottleWindow).UnixNano() / 1000000
+  if models.GetPasswordResetTotal(email, since) >= setting.ResetThrottleLimit {
+    logging.Warn("password reset throttled", email)
+    return
+  }
+
+  resetCode := util.ValidCode(setting.ResetCodeLength)
+  reset := models.PasswordReset{
+    UserId:    user.ID,
+    Email:     email,
+    CodeHash:  resetCodeHash(email, resetCode),
+    ExpiresAt: nowTime.Add(setting.ResetCodeExpire).UnixNano() / 1000000,
+  }
+  if !models.AddPasswordReset(reset) {
+    return
+  }
+
+  params := map[string]string{
+    "email":   email,
+    "subject": "Password reset code",
+    "html":    fmt.Sprintf("<p>Your password reset code is <b>%s</b>, it expires in %d minutes.</p>", resetCode, int(setting.ResetCodeExpire.Minutes())),
+  }
+  go func() {
+    if ok, err := util.SendMail(params); !ok || err != nil {
+      logging.Error("send password reset mail", email, err)
+    }
+  }()
+}
+
+/**
+  * @api {post} /auth/password/reset POST_AUTH_PASSWORD_RESET
+  * @apiName POST_AUTH_PASSWORD_RESET
+  * @apiGroup Auth
+  * @apiPermission None
+  *
+  * @apiDescription Sets a new password with the emailed code. The code can
+  * be used once, and every login of the user is ended.
+  *
+  * @apiParam {String} email user email.
+  * @apiParam {String} code Emailed reset code.
+  * @apiParam {String} password New password.
+  *
+  * @apiParamExample {json} Request-Example:
+    {
+      "email": "admin@linktime.cloud",
+      "code": "480213",
+      "password": "654321"
+    }
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": {},
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func ResetPassword(c *gin.Context) {
+  var reset Reset
+  code := e.INVALID_PARAMS
+
+  defer func() {
+    c.JSON(http.StatusOK, gin.H{
+      "status":  code,
+      "data":    make(map[string]interface{}),
+      "message": e.GetMsg(code),
+    })
+  }()
+
+  if err := c.ShouldBindJSON(&reset); err != nil {
+    return
+  }
+
+  valid := validation.Validation{}
+  valid.Required(reset.Email, "email").Message("Email is required")
+  valid.Required(reset.Code, "code").Message("Code is required")
+  valid.Required(reset.Password, "password").Message("Password is required")
+
+  if valid.HasErrors() {
+    for _, err := range valid.Errors {
+      logging.Info(err.Key, err.Message)
+    }
+    return
+  }
+
+  code = e.VERIFICATION_NOT_MATCH
+  record := models.GetActivePasswordReset(reset.Email)
+  if record.ID == 0 || record.Attempts >= setting.ResetMaxAttempts {
+    return
+  }
+
+  hash := resetCodeHash(reset.Email, reset.Code)
+  if subtle.ConstantTimeCompare([]byte(hash), []byte(record.CodeHash)) != 1 {
+    models.AddPasswordResetAttempt(record.ID)
+    return
+  }
+  if !models.UsePasswordReset(record.ID) {
+    return
+  }
+
+  password, err := util.HashPassword(reset.Password)
+  if err != nil {
+    code = e.ERROR
+    return
+  }
+
+  models.EditUser(record.UserId, map[string]string{"password": password})
+  models.RevokeUserRefreshFamilies(record.UserId)
+  code = e.SUCCESS
+}
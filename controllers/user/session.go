@@ -0,0 +1,192 @@
+package user
+
+import (
+  "github.com/Unknwon/com"
+  "github.com/astaxie/beego/validation"
+  "github.com/gin-gonic/gin"
+
+  "github.com/Chalin-Shi/gout/libs/e"
+  "github.com/Chalin-Shi/gout/libs/logging"
+  "github.com/Chalin-Shi/gout/libs/util"
+  "github.com/Chalin-Shi/gout/models"
+)
+
+type SessionView struct {
+  models.Session
+  Current bool `json:"current"`
+}
+
+// sessionViews marks the session of the request among sessions
+func sessionViews(sessions []models.Session, family string) []SessionView {
+  views := make([]SessionView, len(sessions))
+  for i, session := range sessions {
+    views[i] = SessionView{Session: session, Current: session.Family == family}
+  }
+  return views
+}
+
+/**
+  * @api {get} /user/sessions GET_USER_SESSIONS
+  * @apiName GET_USER_SESSIONS
+  * @apiGroup User
+  *
+  * @apiParam (Login) {String} token Only logged in users can post this.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object[]} data Active sessions of the user.
+  * @apiSuccess {Number} data.id Session id.
+  * @apiSuccess {String} data.userAgent User agent of the login.
+  * @apiSuccess {String} data.ip Client ip of the login.
+  * @apiSuccess {Timestamp} data.createdAt Login time.
+  * @apiSuccess {Timestamp} data.lastSeenAt Last request of the session.
+  * @apiSuccess {Timestamp} data.expiresAt Expiry of the session's refresh token.
+  * @apiSuccess {Boolean} data.current Whether this is the session of the request.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": [{
+        "id": 3,
+        "userId": 1,
+        "userAgent": "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_3)",
+        "ip": "10.0.0.12",
+        "createdAt": 1552896000000,
+        "updatedAt": 1552896000000,
+        "lastSeenAt": 1552899600000,
+        "expiresAt": 1555488000000,
+        "endedAt": 0,
+        "current": true
+      }],
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func GetSessions(c *gin.Context) {
+  maid := c.GetStringMap("Maid")
+  user := maid["User"].(models.User)
+  claims := maid["Claims"].(*util.Claims)
+
+  response := map[string]interface{}{
+    "status": e.SUCCESS,
+    "data":   sessionViews(models.GetSessions(user.ID), claims.Family),
+  }
+  c.Set("response", response)
+}
+
+/**
+  * @api {delete} /user/sessions/:id DELETE_USER_SESSIONS_ID
+  * @apiName DELETE_USER_SESSIONS_ID
+  * @apiGroup User
+  * @apiDescription Ends a session, its refresh and access tokens stop working.
+  *
+  * @apiParam (Login) {String} token Only logged in users can post this.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result.
+  * @apiSuccess {Number} data.id Session id.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": {
+        "id": 3
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func DeleteSession(c *gin.Context) {
+  maid := c.GetStringMap("Maid")
+  user := maid["User"].(models.User)
+  id := com.StrTo(c.Param("id")).MustInt()
+  code := e.INVALID_PARAMS
+
+  defer func() {
+    response := map[string]interface{}{
+      "status": code,
+      "data":   map[string]int{"id": id},
+    }
+    c.Set("response", response)
+  }()
+
+  valid := validation.Validation{}
+  valid.Min(id, 1, "id").Message("ID must greater than 0")
+
+  if valid.HasErrors() {
+    for _, err := range valid.Errors {
+      logging.Info(err.Key, err.Message)
+    }
+    return
+  }
+
+  session := models.GetSession(id)
+  if session.ID == 0 || session.UserId != user.ID || session.EndedAt != 0 {
+    code = e.RECORD_NOT_EXIST
+    return
+  }
+  if !models.RevokeRefreshFamily(session.Family) {
+    code = e.DATABASE_ERROR
+    return
+  }
+  code = e.SUCCESS
+}
+
+/**
+  * @api {delete} /user/sessions DELETE_USER_SESSIONS
+  * @apiName DELETE_USER_SESSIONS
+  * @apiGroup User
+  * @apiDescription Ends every session of the user but the one making the request.
+  *
+  * @apiParam (Login) {String} token Only logged in users can post this.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Data result.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": {},
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func DeleteOtherSessions(c *gin.Context) {
+  maid := c.GetStringMap("Maid")
+  user := maid["User"].(models.User)
+  claims := maid["Claims"].(*util.Claims)
+  code := e.DATABASE_ERROR
+
+  defer func() {
+    response := map[string]interface{}{
+      "status": code,
+      "data":   make(map[string]interface{}),
+    }
+    c.Set("response", response)
+  }()
+
+  if !models.RevokeOtherRefreshFamilies(user.ID, claims.Family) {
+    return
+  }
+  code = e.SUCCESS
+}
@@ -0,0 +1,83 @@
+package users
+
+import (
+  "github.com/Unknwon/com"
+  "github.com/astaxie/beego/validation"
+  "github.com/gin-gonic/gin"
+
+  "github.com/Chalin-Shi/gout/libs/e"
+  "github.com/Chalin-Shi/gout/libs/logging"
+  "github.com/Chalin-Shi/gout/models"
+)
+
+/**
+  * @api {get} /users/:id/groups GET_USERS_UID_GROUPS
+  * @apiName GET_USERS_UID_GROUPS
+  * @apiGroup Users
+  * @apiPermission Admin User
+  *
+  * @apiDescription Effective group chain of a user in the organization of
+  * the request: the groups the user is a direct member of, then the groups
+  * they are nested in, level by level.
+  *
+  * @apiParam {String} id User unique id.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object[]} data Groups of the chain.
+  * @apiSuccess {Number} data.id Group id.
+  * @apiSuccess {String} data.name Group name.
+  * @apiSuccess {Number} data.parentId Group the group is nested in.
+  * @apiSuccess {Number} data.via Group the group is inherited through, 0 for direct membership.
+  * @apiSuccess {Number} data.depth Levels above the direct membership.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": [
+        {"id": 3, "name": "backend", "parentId": 2, "via": 0, "depth": 0},
+        {"id": 2, "name": "engineering", "parentId": 0, "via": 3, "depth": 1}
+      ],
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func GetUserGroups(c *gin.Context) {
+  var groups []models.GroupLink
+  maid := c.GetStringMap("Maid")
+  org := maid["Org"].(models.Organization)
+  id := com.StrTo(c.Param("id")).MustInt()
+  code := e.INVALID_PARAMS
+
+  defer func() {
+    response := map[string]interface{}{
+      "status": code,
+      "data":   groups,
+    }
+    c.Set("response", response)
+  }()
+
+  valid := validation.Validation{}
+  valid.Min(id, 1, "id").Message("ID must greater than 0")
+
+  if valid.HasErrors() {
+    for _, err := range valid.Errors {
+      logging.Info(err.Key, err.Message)
+    }
+    return
+  }
+
+  if !models.IsOrgMember(org.ID, id) {
+    code = e.RECORD_NOT_EXIST
+    return
+  }
+
+  groups = models.GetUserGroupChain(id, org.ID)
+  code = e.SUCCESS
+}
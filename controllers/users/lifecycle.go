@@ -0,0 +1,566 @@
+package users
+
+import (
+  "fmt"
+  "net/http"
+
+  "github.com/Unknwon/com"
+  "github.com/astaxie/beego/validation"
+  "github.com/gin-gonic/gin"
+
+  "github.com/Chalin-Shi/gout/libs/e"
+  "github.com/Chalin-Shi/gout/libs/logging"
+  "github.com/Chalin-Shi/gout/libs/util"
+  "github.com/Chalin-Shi/gout/middlewares"
+  "github.com/Chalin-Shi/gout/models"
+)
+
+// Profile is the body of PUT and PATCH /users/:id, fields left out are kept
+// by PATCH while PUT requires email and username
+type Profile struct {
+  Email    *string `json:"email"`
+  Username *string `json:"username"`
+  Password *string `json:"password"`
+}
+
+// manageableUser finds a user of the organization an admin may manage, the
+// deleted flag picks soft deleted users instead of live ones. Root is never
+// manageable.
+func manageableUser(org models.Organization, id int, deleted bool) (models.User, string) {
+  var user models.User
+  if !models.IsOrgMember(org.ID, id) {
+    return user, e.RECORD_NOT_EXIST
+  }
+  if deleted {
+    user = models.GetDeletedUser(id)
+  } else {
+    user = models.GetUser(id)
+  }
+  if user.ID == 0 {
+    return user, e.RECORD_NOT_EXIST
+  }
+  if user.Username == "root" {
+    return user, e.PERMISSION_DENIED
+  }
+  return user, e.SUCCESS
+}
+
+func reloadPolicy() {
+  if err := middlewares.ReloadPolicy(); err != nil {
+    logging.Error("reload policy", err)
+  }
+}
+
+/**
+  * @api {put} /users/:id PUT_USERS_UID
+  * @apiName PUT_USERS_UID
+  * @apiGroup Users
+  * @apiPermission Admin User
+  *
+  * @apiDescription Updates a user of the organization. PUT requires email
+  * and username, PATCH only changes the fields it is given. A new password
+  * ends every session of the user. Root can't be edited. With If-Match the
+  * user is only changed while it still has that ETag.
+  *
+  * @apiParam {String} id User unique id.
+  * @apiParam {String} email User unique email.
+  * @apiParam {String} username User name.
+  * @apiParam {String} [password] New password.
+  * @apiHeader {String} [If-Match] ETag of GET /users/:id, 412 when the user changed since.
+  * @apiParam (Authorization) {String} token Only admin users can post this.
+  * @apiParamExample {json} Request-Example:
+    {
+      "email": "Justin@163.com",
+      "username": "Justin"
+    }
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Result of user.
+  * @apiSuccess {String} data.id User unique id.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": {
+        "id": 2
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func EditUser(c *gin.Context) {
+  var profile Profile
+  maid := c.GetStringMap("Maid")
+  admin := maid["User"].(models.User)
+  org := maid["Org"].(models.Organization)
+  id := com.StrTo(c.Param("id")).MustInt()
+  code := e.INVALID_PARAMS
+  httpStatus := http.StatusOK
+
+  defer func() {
+    response := map[string]interface{}{
+      "status":     code,
+      "data":       map[string]int{"id": id},
+      "httpStatus": httpStatus,
+    }
+    c.Set("response", response)
+  }()
+
+  if err := c.ShouldBindJSON(&profile); err != nil {
+    return
+  }
+
+  valid := validation.Validation{}
+  valid.Min(id, 1, "id").Message("ID must greater than 0")
+  if c.Request.Method == http.MethodPut {
+    valid.Required(profile.Email != nil, "email").Message("Email is required")
+    valid.Required(profile.Username != nil, "username").Message("Username is required")
+  }
+  if profile.Email != nil {
+    valid.Email(*profile.Email, "email").Message("Email is invalid")
+  }
+  if profile.Username != nil {
+    valid.Required(*profile.Username, "username").Message("Username is required")
+  }
+  if profile.Password != nil {
+    valid.Required(*profile.Password, "password").Message("Password is required")
+  }
+
+  if valid.HasErrors() {
+    for _, err := range valid.Errors {
+      logging.Info(err.Key, err.Message)
+    }
+    return
+  }
+
+  user, code := manageableUser(org, id, false)
+  if code != e.SUCCESS {
+    return
+  }
+  if !util.IfMatch(c, util.ETag(user.ID, user.Version)) {
+    code, httpStatus = e.PRECONDITION_FAILED, http.StatusPreconditionFailed
+    return
+  }
+
+  data := make(map[string]interface{})
+  if profile.Email != nil && *profile.Email != user.Email {
+    if models.ExistUserByEmail(*profile.Email) {
+      code = e.RECORD_HAS_EXISTED
+      return
+    }
+    data["email"] = *profile.Email
+  }
+  if profile.Username != nil {
+    data["username"] = *profile.Username
+  }
+  if profile.Password != nil {
+    hash, err := util.HashPassword(*profile.Password)
+    if err != nil {
+      code = e.ERROR
+      return
+    }
+    data["password"] = hash
+  }
+
+  if len(data) > 0 {
+    if err := models.EditUserIfUnmodified(id, user.Version, data); err == models.ErrModified {
+      code, httpStatus = e.PRECONDITION_FAILED, http.StatusPreconditionFailed
+      return
+    } else if err != nil {
+      logging.Error("edit user", err)
+      code = e.DATABASE_ERROR
+      return
+    }
+  }
+  if _, ok := data["password"]; ok {
+    models.RevokeUserRefreshFamilies(id)
+  }
+  models.AddAudit(models.Audit{
+    UserId: admin.ID,
+    Action: "user.update",
+    Target: fmt.Sprintf("u_%d", id),
+    IP:     c.ClientIP(),
+  })
+  code = e.SUCCESS
+}
+
+/**
+  * @api {post} /users/:id/deactivate POST_USERS_UID_DEACTIVATE
+  * @apiName POST_USERS_UID_DEACTIVATE
+  * @apiGroup Users
+  * @apiPermission Admin User
+  *
+  * @apiDescription Disables a user: its sessions end, its tokens stop working,
+  * it can't log in and its group roles are dropped until it is reactivated.
+  * Root can't be deactivated.
+  *
+  * @apiParam {String} id User unique id.
+  * @apiParam (Authorization) {String} token Only admin users can post this.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Result of user.
+  * @apiSuccess {String} data.id User unique id.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": {
+        "id": 2
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func DeactivateUser(c *gin.Context) {
+  setUserDisabled(c, true)
+}
+
+/**
+  * @api {post} /users/:id/reactivate POST_USERS_UID_REACTIVATE
+  * @apiName POST_USERS_UID_REACTIVATE
+  * @apiGroup Users
+  * @apiPermission Admin User
+  *
+  * @apiDescription Enables a deactivated user again and restores its group
+  * roles.
+  *
+  * @apiParam {String} id User unique id.
+  * @apiParam (Authorization) {String} token Only admin users can post this.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Result of user.
+  * @apiSuccess {String} data.id User unique id.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": {
+        "id": 2
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func ReactivateUser(c *gin.Context) {
+  setUserDisabled(c, false)
+}
+
+func setUserDisabled(c *gin.Context, disabled bool) {
+  maid := c.GetStringMap("Maid")
+  admin := maid["User"].(models.User)
+  org := maid["Org"].(models.Organization)
+  id := com.StrTo(c.Param("id")).MustInt()
+  code := e.INVALID_PARAMS
+
+  defer func() {
+    response := map[string]interface{}{
+      "status": code,
+      "data":   map[string]int{"id": id},
+    }
+    c.Set("response", response)
+  }()
+
+  valid := validation.Validation{}
+  valid.Min(id, 1, "id").Message("ID must greater than 0")
+
+  if valid.HasErrors() {
+    for _, err := range valid.Errors {
+      logging.Info(err.Key, err.Message)
+    }
+    return
+  }
+
+  if _, code = manageableUser(org, id, false); code != e.SUCCESS {
+    return
+  }
+
+  if err := models.SetUserDisabled(id, disabled); err != nil {
+    logging.Error("user disabled", err)
+    code = e.DATABASE_ERROR
+    return
+  }
+  action := "user.reactivate"
+  if disabled {
+    models.RevokeUserRefreshFamilies(id)
+    action = "user.deactivate"
+  }
+  reloadPolicy()
+  models.AddAudit(models.Audit{
+    UserId: admin.ID,
+    Action: action,
+    Target: fmt.Sprintf("u_%d", id),
+    IP:     c.ClientIP(),
+  })
+  code = e.SUCCESS
+}
+
+/**
+  * @api {delete} /users/:id DELETE_USERS_UID
+  * @apiName DELETE_USERS_UID
+  * @apiGroup Users
+  * @apiPermission Admin User
+  *
+  * @apiDescription Soft deletes a user: it is hidden, its sessions end and
+  * its group roles are dropped. Groups, organizations and posts are kept
+  * until the user is restored or purged. Root can't be deleted.
+  *
+  * @apiParam {String} id User unique id.
+  * @apiHeader {String} [If-Match] ETag of GET /users/:id, 412 when the user changed since.
+  * @apiParam (Authorization) {String} token Only admin users can post this.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Result of user.
+  * @apiSuccess {String} data.id User unique id.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": {
+        "id": 2
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func DeleteUser(c *gin.Context) {
+  maid := c.GetStringMap("Maid")
+  admin := maid["User"].(models.User)
+  org := maid["Org"].(models.Organization)
+  id := com.StrTo(c.Param("id")).MustInt()
+  code := e.INVALID_PARAMS
+  httpStatus := http.StatusOK
+
+  defer func() {
+    response := map[string]interface{}{
+      "status":     code,
+      "data":       map[string]int{"id": id},
+      "httpStatus": httpStatus,
+    }
+    c.Set("response", response)
+  }()
+
+  valid := validation.Validation{}
+  valid.Min(id, 1, "id").Message("ID must greater than 0")
+
+  if valid.HasErrors() {
+    for _, err := range valid.Errors {
+      logging.Info(err.Key, err.Message)
+    }
+    return
+  }
+
+  user, code := manageableUser(org, id, false)
+  if code != e.SUCCESS {
+    return
+  }
+  if !util.IfMatch(c, util.ETag(user.ID, user.Version)) {
+    code, httpStatus = e.PRECONDITION_FAILED, http.StatusPreconditionFailed
+    return
+  }
+
+  if err := models.DeleteUser(id, user.Version); err == models.ErrModified {
+    code, httpStatus = e.PRECONDITION_FAILED, http.StatusPreconditionFailed
+    return
+  } else if err != nil {
+    logging.Error("delete user", err)
+    code = e.DATABASE_ERROR
+    return
+  }
+  models.RevokeUserRefreshFamilies(id)
+  reloadPolicy()
+  models.AddAudit(models.Audit{
+    UserId: admin.ID,
+    Action: "user.delete",
+    Target: fmt.Sprintf("u_%d", id),
+    IP:     c.ClientIP(),
+  })
+  code = e.SUCCESS
+}
+
+/**
+  * @api {post} /users/:id/restore POST_USERS_UID_RESTORE
+  * @apiName POST_USERS_UID_RESTORE
+  * @apiGroup Users
+  * @apiPermission Admin User
+  *
+  * @apiDescription Restores a soft deleted user with its group roles. Fails
+  * when its email has been taken by another user in the meantime.
+  *
+  * @apiParam {String} id User unique id.
+  * @apiParam (Authorization) {String} token Only admin users can post this.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Result of user.
+  * @apiSuccess {String} data.id User unique id.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": {
+        "id": 2
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func RestoreUser(c *gin.Context) {
+  maid := c.GetStringMap("Maid")
+  admin := maid["User"].(models.User)
+  org := maid["Org"].(models.Organization)
+  id := com.StrTo(c.Param("id")).MustInt()
+  code := e.INVALID_PARAMS
+
+  defer func() {
+    response := map[string]interface{}{
+      "status": code,
+      "data":   map[string]int{"id": id},
+    }
+    c.Set("response", response)
+  }()
+
+  valid := validation.Validation{}
+  valid.Min(id, 1, "id").Message("ID must greater than 0")
+
+  if valid.HasErrors() {
+    for _, err := range valid.Errors {
+      logging.Info(err.Key, err.Message)
+    }
+    return
+  }
+
+  user, code := manageableUser(org, id, true)
+  if code != e.SUCCESS {
+    return
+  }
+  // users deleted before emails stayed taken may have been replaced
+  if models.GetUserByEmail(user.Email).ID > 0 {
+    code = e.RECORD_HAS_EXISTED
+    return
+  }
+
+  if err := models.RestoreUser(id); err != nil {
+    logging.Error("restore user", err)
+    code = e.DATABASE_ERROR
+    return
+  }
+  reloadPolicy()
+  models.AddAudit(models.Audit{
+    UserId: admin.ID,
+    Action: "user.restore",
+    Target: fmt.Sprintf("u_%d", id),
+    IP:     c.ClientIP(),
+  })
+  code = e.SUCCESS
+}
+
+/**
+  * @api {delete} /users/:id/purge DELETE_USERS_UID_PURGE
+  * @apiName DELETE_USERS_UID_PURGE
+  * @apiGroup Users
+  * @apiPermission Admin User
+  *
+  * @apiDescription Permanently removes a soft deleted user together with its
+  * policies, memberships, sessions, tokens and posts. Can't be undone.
+  *
+  * @apiParam {String} id User unique id.
+  * @apiParam (Authorization) {String} token Only admin users can post this.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Result of user.
+  * @apiSuccess {String} data.id User unique id.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": {
+        "id": 2
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func PurgeUser(c *gin.Context) {
+  maid := c.GetStringMap("Maid")
+  admin := maid["User"].(models.User)
+  org := maid["Org"].(models.Organization)
+  id := com.StrTo(c.Param("id")).MustInt()
+  code := e.INVALID_PARAMS
+
+  defer func() {
+    response := map[string]interface{}{
+      "status": code,
+      "data":   map[string]int{"id": id},
+    }
+    c.Set("response", response)
+  }()
+
+  valid := validation.Validation{}
+  valid.Min(id, 1, "id").Message("ID must greater than 0")
+
+  if valid.HasErrors() {
+    for _, err := range valid.Errors {
+      logging.Info(err.Key, err.Message)
+    }
+    return
+  }
+
+  user, code := manageableUser(org, id, true)
+  if code != e.SUCCESS {
+    return
+  }
+
+  if err := models.PurgeUser(id); err != nil {
+    logging.Error("purge user", err)
+    code = e.DATABASE_ERROR
+    return
+  }
+  reloadPolicy()
+  models.AddAudit(models.Audit{
+    UserId: admin.ID,
+    Action: "user.purge",
+    Target: fmt.Sprintf("u_%d", id),
+    IP:     c.ClientIP(),
+    Detail: user.Email,
+  })
+  code = e.SUCCESS
+}
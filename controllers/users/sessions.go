@@ -0,0 +1,160 @@
+package users
+
+import (
+  "fmt"
+
+  "github.com/Unknwon/com"
+  "github.com/astaxie/beego/validation"
+  "github.com/gin-gonic/gin"
+
+  "github.com/Chalin-Shi/gout/libs/e"
+  "github.com/Chalin-Shi/gout/libs/logging"
+  "github.com/Chalin-Shi/gout/models"
+)
+
+/**
+  * @api {get} /users/:id/sessions GET_USERS_UID_SESSIONS
+  * @apiName GET_USERS_UID_SESSIONS
+  * @apiGroup Users
+  * @apiPermission Admin User
+  *
+  * @apiParam {String} id User unique id.
+  * @apiParam (Authorization) {String} token Only admin users can post this.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object[]} data Active sessions of the user, see GET /user/sessions.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": [{
+        "id": 3,
+        "userId": 2,
+        "userAgent": "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_3)",
+        "ip": "10.0.0.12",
+        "createdAt": 1552896000000,
+        "updatedAt": 1552896000000,
+        "lastSeenAt": 1552899600000,
+        "expiresAt": 1555488000000,
+        "endedAt": 0
+      }],
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func GetUserSessions(c *gin.Context) {
+  var sessions []models.Session
+  maid := c.GetStringMap("Maid")
+  org := maid["Org"].(models.Organization)
+  id := com.StrTo(c.Param("id")).MustInt()
+  code := e.INVALID_PARAMS
+
+  defer func() {
+    response := map[string]interface{}{
+      "status": code,
+      "data":   sessions,
+    }
+    c.Set("response", response)
+  }()
+
+  valid := validation.Validation{}
+  valid.Min(id, 1, "id").Message("ID must greater than 0")
+
+  if valid.HasErrors() {
+    for _, err := range valid.Errors {
+      logging.Info(err.Key, err.Message)
+    }
+    return
+  }
+
+  if !models.IsOrgMember(org.ID, id) {
+    code = e.RECORD_NOT_EXIST
+    return
+  }
+
+  sessions = models.GetSessions(id)
+  code = e.SUCCESS
+}
+
+/**
+  * @api {delete} /users/:id/sessions DELETE_USERS_UID_SESSIONS
+  * @apiName DELETE_USERS_UID_SESSIONS
+  * @apiGroup Users
+  * @apiPermission Admin User
+  *
+  * @apiDescription Logs the user out everywhere by ending all of their
+  * sessions. Personal access tokens are not affected.
+  *
+  * @apiParam {String} id User unique id.
+  * @apiParam (Authorization) {String} token Only admin users can post this.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Result of user.
+  * @apiSuccess {String} data.id User unique id.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": {
+        "id": 2
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func DeleteUserSessions(c *gin.Context) {
+  maid := c.GetStringMap("Maid")
+  admin := maid["User"].(models.User)
+  org := maid["Org"].(models.Organization)
+  id := com.StrTo(c.Param("id")).MustInt()
+  code := e.INVALID_PARAMS
+
+  defer func() {
+    response := map[string]interface{}{
+      "status": code,
+      "data":   map[string]int{"id": id},
+    }
+    c.Set("response", response)
+  }()
+
+  valid := validation.Validation{}
+  valid.Min(id, 1, "id").Message("ID must greater than 0")
+
+  if valid.HasErrors() {
+    for _, err := range valid.Errors {
+      logging.Info(err.Key, err.Message)
+    }
+    return
+  }
+
+  if !models.IsOrgMember(org.ID, id) {
+    code = e.RECORD_NOT_EXIST
+    return
+  }
+
+  if !models.RevokeUserRefreshFamilies(id) {
+    code = e.DATABASE_ERROR
+    return
+  }
+  models.AddAudit(models.Audit{
+    UserId: admin.ID,
+    Action: "user.logout",
+    Target: fmt.Sprintf("u_%d", id),
+    IP:     c.ClientIP(),
+  })
+  code = e.SUCCESS
+}
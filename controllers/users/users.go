@@ -1,6 +1,8 @@
 package users
 
 import (
+  "net/http"
+
   "github.com/Unknwon/com"
   "github.com/astaxie/beego/validation"
   "github.com/gin-gonic/gin"
@@ -8,6 +10,7 @@ import (
   "github.com/Chalin-Shi/gout/libs/e"
   "github.com/Chalin-Shi/gout/libs/logging"
   "github.com/Chalin-Shi/gout/libs/util"
+  "github.com/Chalin-Shi/gout/middlewares"
   "github.com/Chalin-Shi/gout/models"
 )
 
@@ -17,6 +20,8 @@ import (
   * @apiGroup Users
   * @apiPermission Admin User
   *
+  * @apiDescription The user joins the organization of the request as member.
+  *
   * @apiParam {String} email User unique email.
   * @apiParam {String} [password=123456] User password.
   * @apiParam (Authorization) {String} token Only admin users can post this.
@@ -66,7 +71,6 @@ func AddUser(c *gin.Context) {
   password := user.Password
   valid.Required(email, "email").Message("Email is required")
   valid.Required(password, "password").Message("Password is required")
-  user.Password = util.Encrypt(password, "sha256")
 
   if valid.HasErrors() {
     for _, err := range valid.Errors {
@@ -75,12 +79,29 @@ func AddUser(c *gin.Context) {
     return
   }
 
+  hash, err := util.HashPassword(password)
+  if err != nil {
+    code = e.ERROR
+    return
+  }
+  user.Password = hash
+
   if models.ExistUserByEmail(email) {
     code = e.RECORD_HAS_EXISTED
     return
   }
 
-  models.AddUser(user)
+  maid := c.GetStringMap("Maid")
+  org := maid["Org"].(models.Organization)
+  if !models.CreateUser(&user) {
+    code = e.DATABASE_ERROR
+    return
+  }
+  if err := models.SetOrgMember(org.ID, user.ID, models.OrgRoleMember); err != nil {
+    logging.Error("org member", err)
+    code = e.DATABASE_ERROR
+    return
+  }
   code = e.SUCCESS
 }
 
@@ -90,9 +111,18 @@ func AddUser(c *gin.Context) {
   * @apiGroup Users
   * @apiPermission Authorization User
   *
-  * @apiParam {null} null no params.
+  * @apiDescription Members of the organization of the request. Filters
+  * are written field=value with the operators = != > >= < <= and ~= for
+  * "contains", on id, email, username, groupId (primary group), disabled,
+  * createdAt and updatedAt.
+  *
+  * @apiParam {Number} [start=0] Offset.
+  * @apiParam {Number} [limit=10] Page size, at most MAX_PAGE_SIZE.
+  * @apiParam {String} [cursor] Walk the list by id instead of start, empty for the first page and then data.pagination.next.
+  * @apiParam {String} [sort] Fields to sort by, e.g. username,-createdAt.
+  * @apiParam {Boolean} [deleted=false] List the soft deleted members instead.
   * @apiParamExample {json} Request-Example:
-    {}
+    GET /api/users?email~=@163.com&createdAt>=1521113735000&sort=-createdAt
   *
   * @apiSuccess {String} status Status code.
   * @apiSuccess {Object} data.pagination User pagination.
@@ -144,18 +174,40 @@ func AddUser(c *gin.Context) {
   *
 */
 func GetUsers(c *gin.Context) {
-  var users []models.User
   code := e.INVALID_PARAMS
+  data := make(map[string]interface{})
 
   defer func() {
     response := map[string]interface{}{
       "status": code,
-      "data":   users,
+      "data":   data,
     }
     c.Set("response", response)
   }()
 
-  users = models.GetUsers()
+  q, err := util.GetQuery(c, models.UserFields, "-updatedAt")
+  if err != nil {
+    logging.Info("query", err)
+    return
+  }
+
+  maid := c.GetStringMap("Maid")
+  org := maid["Org"].(models.Organization)
+  var users []models.User
+  var page util.Pagination
+  if c.Query("deleted") == "true" {
+    users, page, err = models.GetDeletedUsers(org.ID, q)
+  } else {
+    users, page, err = models.GetUsers(org.ID, q)
+  }
+  if err != nil {
+    logging.Error("users", err)
+    code = e.DATABASE_ERROR
+    return
+  }
+
+  data["list"] = users
+  data["pagination"] = page
   code = e.SUCCESS
 }
 
@@ -166,10 +218,11 @@ func GetUsers(c *gin.Context) {
   * @apiPermission Authorization User
   *
   * @apiParam {String} id User unique id.
+  * @apiParam {String} [include] posts to load the posts of the user as well, only the published ones
+  * unless the caller may see the others, as for GET /users/:id/posts.
+  * @apiHeader {String} [If-None-Match] ETag of the user the client has, answered with 304 when it is current.
   * @apiParamExample {json} Request-Example:
-    {
-      "id": 1
-    }
+    GET /api/users/1?include=posts
   *
   * @apiSuccess {String} status Status code.
   * @apiSuccess {Object} data Result of user.
@@ -201,16 +254,34 @@ func GetUsers(c *gin.Context) {
   *
 */
 func GetUserById(c *gin.Context) {
+  maid := c.GetStringMap("Maid")
+  org := maid["Org"].(models.Organization)
   id := com.StrTo(c.Param("id")).MustInt()
 
   valid := validation.Validation{}
   valid.Min(id, 1, "id").Message("ID must greater than 0")
 
   code := e.INVALID_PARAMS
+  httpStatus := http.StatusOK
   var data interface{}
   if !valid.HasErrors() {
-    if models.ExistUserByID(id) {
-      data = models.GetUser(id)
+    if models.IsOrgMember(org.ID, id) {
+      if c.Query("include") == "posts" {
+        user := models.GetUserWithPosts(id, middlewares.CanSeeUnpublished(c, id))
+        user.Password = ""
+        data = user
+      } else {
+        // the posts of a user change without the user, only the user
+        // alone is tagged
+        user := models.GetUser(id)
+        user.Password = ""
+        etag := util.ETag(user.ID, user.Version)
+        c.Header("ETag", etag)
+        if util.IfNoneMatch(c, etag) {
+          httpStatus = http.StatusNotModified
+        }
+        data = user
+      }
       code = e.SUCCESS
     } else {
       code = e.RECORD_NOT_EXIST
@@ -222,8 +293,85 @@ func GetUserById(c *gin.Context) {
   }
 
   response := map[string]interface{}{
-    "status": code,
-    "data":   data,
+    "status":     code,
+    "data":       data,
+    "httpStatus": httpStatus,
   }
   c.Set("response", response)
 }
+
+/**
+  * @api {delete} /users/:id/lock DELETE_USERS_UID_LOCK
+  * @apiName DELETE_USERS_UID_LOCK
+  * @apiGroup Users
+  * @apiPermission Admin User
+  *
+  * @apiDescription Lifts a lockout caused by failed logins and resets the
+  * failure counters of the account and of the client its last failed login
+  * came from.
+  *
+  * @apiParam {String} id User unique id.
+  * @apiParam (Authorization) {String} token Only admin users can post this.
+  * @apiParamExample {json} Request-Example:
+    {}
+  *
+  * @apiSuccess {String} status Status code.
+  * @apiSuccess {Object} data Result of user.
+  * @apiSuccess {String} data.id User unique id.
+  * @apiSuccess {Object} message Descrpition within status code.
+  * @apiSuccess {String} message.desc Detail descrption.
+  *
+  * @apiSuccessExample {json} Success-Response:
+    HTTP/1.1 200 OK
+    {
+      "status": "100000",
+      "data": {
+        "id": 2
+      },
+      "message": {
+        "desc": "Success"
+      }
+    }
+  *
+*/
+func UnlockUser(c *gin.Context) {
+  maid := c.GetStringMap("Maid")
+  admin := maid["User"].(models.User)
+  org := maid["Org"].(models.Organization)
+  id := com.StrTo(c.Param("id")).MustInt()
+  code := e.INVALID_PARAMS
+
+  defer func() {
+    response := map[string]interface{}{
+      "status": code,
+      "data":   map[string]int{"id": id},
+    }
+    c.Set("response", response)
+  }()
+
+  valid := validation.Validation{}
+  valid.Min(id, 1, "id").Message("ID must greater than 0")
+
+  if valid.HasErrors() {
+    for _, err := range valid.Errors {
+      logging.Info(err.Key, err.Message)
+    }
+    return
+  }
+
+  if !models.IsOrgMember(org.ID, id) {
+    code = e.RECORD_NOT_EXIST
+    return
+  }
+
+  email := models.GetUser(id).Email
+  target := models.EmailSource(email)
+  models.ClearAccountFailures(email)
+  models.AddAudit(models.Audit{
+    UserId: admin.ID,
+    Action: "user.unlock",
+    Target: target,
+    IP:     c.ClientIP(),
+  })
+  code = e.SUCCESS
+}
@@ -1,6 +1,6 @@
 module github.com/Chalin-Shi/gout
 
-go 1.12
+go 1.15
 
 require (
 	cloud.google.com/go v0.37.0 // indirect
@@ -32,6 +32,10 @@ require (
 	github.com/robfig/cron v0.0.0-20180505203441-b41be1df6967
 	github.com/satori/go.uuid v1.2.0 // indirect
 	go.uber.org/zap v1.9.1
+	golang.org/x/crypto v0.0.0-20190308221718-c2843e01d9a2
 	golang.org/x/time v0.0.0-20190308202827-9d24e82272b4 // indirect
+	gopkg.in/asn1-ber.v1 v1.0.0-20181015200546-f715ec2f112d // indirect
 	gopkg.in/ini.v1 v1.42.0 // indirect
+	gopkg.in/ldap.v3 v3.0.3
+	gopkg.in/yaml.v2 v2.2.2
 )
@@ -8,6 +8,11 @@ const (
 	ERROR_AUTH_CHECK_TOKEN_EXPIRED = "20002"
 	ERROR_AUTH_TOKEN               = "20003"
 	ERROR_AUTH                     = "20004"
+	ERROR_AUTH_TOKEN_REVOKED       = "20005"
+	ERROR_AUTH_REFRESH_TOKEN       = "20006"
+	ERROR_AUTH_REFRESH_TOKEN_REUSE = "20007"
+	ERROR_AUTH_OIDC                = "20008"
+	ERROR_AUTH_USER_DISABLED       = "20009"
 
 	UNKNOW_ERROR           = "-1"
 	SUCCESS                = "100000"
@@ -30,6 +35,10 @@ const (
 	PASSWORD_NOT_MATCH     = "410000"
 	ORIGIN_PASSWORD_ERROR  = "420000"
 	VERIFICATION_NOT_MATCH = "430000"
+	ACCOUNT_LOCKED         = "440000"
+	TOO_MANY_ATTEMPTS      = "450000"
+	PRECONDITION_FAILED    = "460000"
+	STATUS_CONFLICT        = "470000"
 	CLUSTER_NOT_EXIST      = "500000"
 	HTTP_REQUEST_ERROR     = "600000"
 	PLATFORM_REQUEST_ERROR = "700000"
@@ -6,6 +6,11 @@ var eMap = map[string]string{
 	ERROR_AUTH_CHECK_TOKEN_EXPIRED: "Token is expired",
 	ERROR_AUTH_TOKEN:               "Token generate failed",
 	ERROR_AUTH:                     "Token is null",
+	ERROR_AUTH_TOKEN_REVOKED:       "Token has been revoked",
+	ERROR_AUTH_REFRESH_TOKEN:       "Refresh token is invalid or expired",
+	ERROR_AUTH_REFRESH_TOKEN_REUSE: "Refresh token reuse detected",
+	ERROR_AUTH_OIDC:                "Single sign-on failed",
+	ERROR_AUTH_USER_DISABLED:       "Account is disabled",
 
 	UNKNOW_ERROR:           "Unknow error",
 	SUCCESS:                "Success",
@@ -28,6 +33,10 @@ var eMap = map[string]string{
 	PASSWORD_NOT_MATCH:     "Username and password don't match",
 	ORIGIN_PASSWORD_ERROR:  "Origin password not match",
 	VERIFICATION_NOT_MATCH: "Verification not match",
+	ACCOUNT_LOCKED:         "Account is temporarily locked",
+	TOO_MANY_ATTEMPTS:      "Too many attempts, try again later",
+	PRECONDITION_FAILED:    "Resource was modified, reload it and try again",
+	STATUS_CONFLICT:        "Resource is not in a status allowing this",
 	CLUSTER_NOT_EXIST:      "Cluster not exist",
 	HTTP_REQUEST_ERROR:     "Http request error",
 	PLATFORM_REQUEST_ERROR: "Platform request error",
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/go-ini/ini"
@@ -26,8 +28,78 @@ var (
 
 	Limit     string
 	Offset    string
+	MaxLimit  int
 	Secret    string
 	SentryKey string
+
+	AccessTokenExpire  time.Duration
+	RefreshTokenExpire time.Duration
+	MfaTokenExpire     time.Duration
+	MfaIssuer          string
+	MfaRecoveryCodes   int
+	AccessTokenMaxDays int
+
+	JwtAlgorithm      string
+	JwtRotateInterval time.Duration
+
+	PasswordHasher string
+	Argon2Memory   uint32
+	Argon2Time     uint32
+	Argon2Threads  uint8
+	BcryptCost     int
+
+	ResetCodeLength     int
+	ResetCodeExpire     time.Duration
+	ResetMaxAttempts    int
+	ResetThrottleWindow time.Duration
+	ResetThrottleLimit  int
+
+	LoginFailureWindow time.Duration
+	LoginMaxFailures   int
+	LoginIPMaxFailures int
+	LoginLockDuration  time.Duration
+	LoginBackoffAfter  int
+	LoginBackoffBase   time.Duration
+	LoginBackoffMax    time.Duration
+
+	OidcEnabled           bool
+	OidcIssuer            string
+	OidcClientID          string
+	OidcClientSecret      string
+	OidcRedirectURL       string
+	OidcScopes            []string
+	OidcStateExpire       time.Duration
+	OidcGroupsClaim       string
+	OidcGroupMap          map[string]string
+	OidcAutoProvision     bool
+	OidcPostLoginRedirect string
+
+	LdapEnabled         bool
+	LdapURL             string
+	LdapStartTLS        bool
+	LdapSkipVerify      bool
+	LdapTimeout         time.Duration
+	LdapBindDN          string
+	LdapBindPassword    string
+	LdapBaseDN          string
+	LdapUserDNTemplate  string
+	LdapUserFilter      string
+	LdapEmailAttr       string
+	LdapUsernameAttr    string
+	LdapGroupBaseDN     string
+	LdapGroupFilter     string
+	LdapGroupNameAttr   string
+	LdapGroupDescAttr   string
+	LdapGroupMemberAttr string
+	LdapSyncInterval    time.Duration
+	LdapFallbackLocal   bool
+	LdapAutoProvision   bool
+
+	AuthzPollInterval       time.Duration
+	AuthzCacheSize          int
+	AuthzDefaultPermissions []string
+
+	PostPublishSchedule string
 )
 
 func init() {
@@ -36,14 +108,15 @@ func init() {
 	if os.Getenv("GIN_MODE") == "release" {
 		name = "prod.ini"
 	}
-	filename = fmt.Sprintf("conf/%s", name)
+	dir := confDir()
+	filename = filepath.Join(dir, name)
 
 	Cfg, err = ini.Load(filename)
 	if err != nil {
 		log.Fatalf("Fail to parse 'conf/app.ini': %v", err)
 	}
 
-	Cfg, err = ini.Load("conf/base.ini", filename)
+	Cfg, err = ini.Load(filepath.Join(dir, "base.ini"), filename)
 	Cfg.BlockMode = false
 	if err != nil {
 		log.Fatalf("Fail to parse 'conf/app.ini': %v", err)
@@ -55,6 +128,31 @@ func init() {
 	LoadOSS()
 	LoadMail()
 	LoadApp()
+	LoadAuth()
+	LoadPassword()
+	LoadReset()
+	LoadSecurity()
+	LoadOidc()
+	LoadLdap()
+	LoadAuthz()
+	LoadPost()
+}
+
+// confDir finds conf in the working directory or above it, tests run in the
+// directory of their package
+func confDir() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "conf"
+	}
+	for dir := wd; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, "conf", "base.ini")); err == nil {
+			return filepath.Join(dir, "conf")
+		}
+		if filepath.Dir(dir) == dir {
+			return "conf"
+		}
+	}
 }
 
 func LoadBase() {
@@ -130,4 +228,136 @@ func LoadApp() {
 	SentryKey = sec.Key("SENTRY_KEY").String()
 	Limit = sec.Key("PAGE_SIZE").String()
 	Offset = "0"
+	MaxLimit = sec.Key("MAX_PAGE_SIZE").MustInt(100)
+}
+
+func LoadAuth() {
+	sec, err := Cfg.GetSection("auth")
+	if err != nil {
+		log.Fatalf("Fail to get section 'auth': %v", err)
+	}
+
+	AccessTokenExpire = time.Duration(sec.Key("ACCESS_TOKEN_EXPIRE").MustInt(15)) * time.Minute
+	RefreshTokenExpire = time.Duration(sec.Key("REFRESH_TOKEN_EXPIRE").MustInt(720)) * time.Hour
+	MfaTokenExpire = time.Duration(sec.Key("MFA_TOKEN_EXPIRE").MustInt(5)) * time.Minute
+	MfaIssuer = sec.Key("MFA_ISSUER").MustString("gout")
+	MfaRecoveryCodes = sec.Key("MFA_RECOVERY_CODES").MustInt(10)
+	AccessTokenMaxDays = sec.Key("ACCESS_TOKEN_MAX_DAYS").MustInt(365)
+	JwtAlgorithm = sec.Key("JWT_ALGORITHM").In("RS256", []string{"HS256", "RS256", "ES256", "EdDSA"})
+	JwtRotateInterval = time.Duration(sec.Key("JWT_ROTATE_INTERVAL").MustInt(720)) * time.Hour
+}
+
+func LoadPassword() {
+	sec, err := Cfg.GetSection("password")
+	if err != nil {
+		log.Fatalf("Fail to get section 'password': %v", err)
+	}
+
+	PasswordHasher = sec.Key("HASHER").In("argon2id", []string{"argon2id", "bcrypt"})
+	Argon2Memory = uint32(sec.Key("ARGON2_MEMORY").MustUint(64 * 1024))
+	Argon2Time = uint32(sec.Key("ARGON2_TIME").MustUint(1))
+	Argon2Threads = uint8(sec.Key("ARGON2_THREADS").MustUint(4))
+	BcryptCost = sec.Key("BCRYPT_COST").MustInt(10)
+}
+
+func LoadReset() {
+	sec, err := Cfg.GetSection("reset")
+	if err != nil {
+		log.Fatalf("Fail to get section 'reset': %v", err)
+	}
+
+	ResetCodeLength = sec.Key("CODE_LENGTH").MustInt(6)
+	ResetCodeExpire = time.Duration(sec.Key("CODE_EXPIRE").MustInt(15)) * time.Minute
+	ResetMaxAttempts = sec.Key("MAX_ATTEMPTS").MustInt(5)
+	ResetThrottleWindow = time.Duration(sec.Key("THROTTLE_WINDOW").MustInt(60)) * time.Minute
+	ResetThrottleLimit = sec.Key("THROTTLE_LIMIT").MustInt(3)
+}
+
+func LoadSecurity() {
+	sec, err := Cfg.GetSection("security")
+	if err != nil {
+		log.Fatalf("Fail to get section 'security': %v", err)
+	}
+
+	LoginFailureWindow = time.Duration(sec.Key("FAILURE_WINDOW").MustInt(15)) * time.Minute
+	LoginMaxFailures = sec.Key("MAX_FAILURES").MustInt(10)
+	LoginIPMaxFailures = sec.Key("IP_MAX_FAILURES").MustInt(50)
+	LoginLockDuration = time.Duration(sec.Key("LOCK_DURATION").MustInt(15)) * time.Minute
+	LoginBackoffAfter = sec.Key("BACKOFF_AFTER").MustInt(3)
+	LoginBackoffBase = time.Duration(sec.Key("BACKOFF_BASE").MustInt(1)) * time.Second
+	LoginBackoffMax = time.Duration(sec.Key("BACKOFF_MAX").MustInt(300)) * time.Second
+}
+
+func LoadOidc() {
+	sec, err := Cfg.GetSection("oidc")
+	if err != nil {
+		log.Fatalf("Fail to get section 'oidc': %v", err)
+	}
+
+	OidcEnabled = sec.Key("ENABLED").MustBool(false)
+	OidcIssuer = sec.Key("ISSUER").String()
+	OidcClientID = sec.Key("CLIENT_ID").String()
+	OidcClientSecret = sec.Key("CLIENT_SECRET").String()
+	OidcRedirectURL = sec.Key("REDIRECT_URL").String()
+	OidcScopes = strings.Fields(sec.Key("SCOPES").MustString("openid email profile"))
+	OidcStateExpire = time.Duration(sec.Key("STATE_EXPIRE").MustInt(10)) * time.Minute
+	OidcGroupsClaim = sec.Key("GROUPS_CLAIM").MustString("groups")
+	OidcAutoProvision = sec.Key("AUTO_PROVISION").MustBool(true)
+	OidcPostLoginRedirect = sec.Key("POST_LOGIN_REDIRECT").String()
+
+	OidcGroupMap = make(map[string]string)
+	for _, pair := range sec.Key("GROUP_MAP").Strings(",") {
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) == 2 {
+			OidcGroupMap[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+}
+
+func LoadLdap() {
+	sec, err := Cfg.GetSection("ldap")
+	if err != nil {
+		log.Fatalf("Fail to get section 'ldap': %v", err)
+	}
+
+	LdapEnabled = sec.Key("ENABLED").MustBool(false)
+	LdapURL = sec.Key("URL").MustString("ldap://127.0.0.1:389")
+	LdapStartTLS = sec.Key("START_TLS").MustBool(false)
+	LdapSkipVerify = sec.Key("INSECURE_SKIP_VERIFY").MustBool(false)
+	LdapTimeout = time.Duration(sec.Key("TIMEOUT").MustInt(5)) * time.Second
+	LdapBindDN = sec.Key("BIND_DN").String()
+	LdapBindPassword = sec.Key("BIND_PASSWORD").String()
+	LdapBaseDN = sec.Key("BASE_DN").String()
+	LdapUserDNTemplate = sec.Key("USER_DN_TEMPLATE").String()
+	LdapUserFilter = sec.Key("USER_FILTER").MustString("(&(objectClass=person)(mail=%s))")
+	LdapEmailAttr = sec.Key("EMAIL_ATTR").MustString("mail")
+	LdapUsernameAttr = sec.Key("USERNAME_ATTR").MustString("uid")
+	LdapGroupBaseDN = sec.Key("GROUP_BASE_DN").MustString(LdapBaseDN)
+	LdapGroupFilter = sec.Key("GROUP_FILTER").MustString("(objectClass=groupOfNames)")
+	LdapGroupNameAttr = sec.Key("GROUP_NAME_ATTR").MustString("cn")
+	LdapGroupDescAttr = sec.Key("GROUP_DESC_ATTR").MustString("description")
+	LdapGroupMemberAttr = sec.Key("GROUP_MEMBER_ATTR").MustString("member")
+	LdapSyncInterval = time.Duration(sec.Key("SYNC_INTERVAL").MustInt(15)) * time.Minute
+	LdapFallbackLocal = sec.Key("FALLBACK_LOCAL").MustBool(false)
+	LdapAutoProvision = sec.Key("AUTO_PROVISION").MustBool(true)
+}
+
+func LoadAuthz() {
+	sec, err := Cfg.GetSection("authz")
+	if err != nil {
+		log.Fatalf("Fail to get section 'authz': %v", err)
+	}
+
+	AuthzPollInterval = time.Duration(sec.Key("POLICY_POLL_INTERVAL").MustInt(5)) * time.Second
+	AuthzCacheSize = sec.Key("DECISION_CACHE_SIZE").MustInt(10000)
+	AuthzDefaultPermissions = sec.Key("DEFAULT_GROUP_PERMISSIONS").Strings(",")
+}
+
+func LoadPost() {
+	sec, err := Cfg.GetSection("post")
+	if err != nil {
+		log.Fatalf("Fail to get section 'post': %v", err)
+	}
+
+	PostPublishSchedule = sec.Key("PUBLISH_SCHEDULE").String()
 }
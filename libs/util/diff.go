@@ -0,0 +1,99 @@
+package util
+
+import (
+	"strings"
+)
+
+// DiffLine is a line of a diff, Op is "=" for a line both texts have, "-"
+// for a line only the old text has and "+" for a line only the new one has
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// maxDiffCells bounds the table of DiffLines, about 8MB. Texts whose changed
+// lines would need more are diffed as all old lines replaced by all new ones.
+const maxDiffCells = 1 << 20
+
+// DiffLines compares two texts line by line along their longest common
+// subsequence of lines
+func DiffLines(a string, b string) []DiffLine {
+	x, y := splitLines(a), splitLines(b)
+
+	// lines the texts start and end with are common anyway, leave them out of
+	// the table
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+
+	diff := make([]DiffLine, 0, len(x)+len(y))
+	diff = appendLines(diff, "=", x[:prefix])
+
+	xs, ys := x[prefix:len(x)-suffix], y[prefix:len(y)-suffix]
+	if (len(xs)+1)*(len(ys)+1) > maxDiffCells {
+		diff = appendLines(diff, "-", xs)
+		diff = appendLines(diff, "+", ys)
+	} else {
+		diff = appendLCS(diff, xs, ys)
+	}
+
+	return appendLines(diff, "=", x[len(x)-suffix:])
+}
+
+// appendLCS appends the diff of xs and ys along their longest common
+// subsequence
+func appendLCS(diff []DiffLine, xs []string, ys []string) []DiffLine {
+	// lcs[i][j] is the length of the longest common subsequence of xs[i:]
+	// and ys[j:]
+	lcs := make([][]int, len(xs)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(ys)+1)
+	}
+	for i := len(xs) - 1; i >= 0; i-- {
+		for j := len(ys) - 1; j >= 0; j-- {
+			if xs[i] == ys[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(xs) && j < len(ys) {
+		switch {
+		case xs[i] == ys[j]:
+			diff = append(diff, DiffLine{Op: "=", Text: xs[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, DiffLine{Op: "-", Text: xs[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{Op: "+", Text: ys[j]})
+			j++
+		}
+	}
+	diff = appendLines(diff, "-", xs[i:])
+	return appendLines(diff, "+", ys[j:])
+}
+
+func appendLines(diff []DiffLine, op string, lines []string) []DiffLine {
+	for _, line := range lines {
+		diff = append(diff, DiffLine{Op: op, Text: line})
+	}
+	return diff
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
@@ -0,0 +1,84 @@
+package util
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want []DiffLine
+	}{
+		{name: "both empty", a: "", b: "", want: []DiffLine{}},
+		{
+			name: "added to empty",
+			a:    "",
+			b:    "one\ntwo\n",
+			want: []DiffLine{{"+", "one"}, {"+", "two"}},
+		},
+		{
+			name: "removed all",
+			a:    "one\ntwo",
+			b:    "",
+			want: []DiffLine{{"-", "one"}, {"-", "two"}},
+		},
+		{
+			name: "equal",
+			a:    "one\ntwo",
+			b:    "one\ntwo\n",
+			want: []DiffLine{{"=", "one"}, {"=", "two"}},
+		},
+		{
+			name: "changed line",
+			a:    "one\ntwo\nthree",
+			b:    "one\n2\nthree",
+			want: []DiffLine{{"=", "one"}, {"-", "two"}, {"+", "2"}, {"=", "three"}},
+		},
+		{
+			name: "inserted and removed",
+			a:    "a\nb\nc\nd",
+			b:    "a\nc\nd\ne",
+			want: []DiffLine{{"=", "a"}, {"-", "b"}, {"=", "c"}, {"=", "d"}, {"+", "e"}},
+		},
+		{
+			name: "moved line",
+			a:    "x\na\nb",
+			b:    "a\nb\nx",
+			want: []DiffLine{{"-", "x"}, {"=", "a"}, {"=", "b"}, {"+", "x"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DiffLines(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffLines() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffLinesLargeInput(t *testing.T) {
+	// too many changed lines for the table, the middle is replaced as a whole
+	// and the common first and last lines are kept
+	old := make([]string, 2000)
+	cur := make([]string, 2000)
+	for i := range old {
+		old[i] = "old"
+		cur[i] = "new"
+	}
+	a := "first\n" + strings.Join(old, "\n") + "\nlast"
+	b := "first\n" + strings.Join(cur, "\n") + "\nlast"
+
+	diff := DiffLines(a, b)
+	if len(diff) != 4002 {
+		t.Fatalf("len(DiffLines()) = %d, want 4002", len(diff))
+	}
+	if diff[0] != (DiffLine{"=", "first"}) || diff[1] != (DiffLine{"-", "old"}) ||
+		diff[2001] != (DiffLine{"+", "new"}) || diff[4001] != (DiffLine{"=", "last"}) {
+		t.Fatalf("unexpected diff %v ... %v", diff[:2], diff[len(diff)-2:])
+	}
+}
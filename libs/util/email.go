@@ -1,21 +1,27 @@
 package util
 
 import (
+	"crypto/rand"
 	"fmt"
-	"math/rand"
+	"math/big"
 	"net/url"
-	"time"
 
 	"github.com/Chalin-Shi/gout/libs/setting"
 )
 
 func SendMail(params map[string]string) (bool, error) {
-	conf := setting.Mail
+	conf := make(map[string]string)
+	for k, v := range setting.Mail {
+		conf[k] = v
+	}
 	apiURL, ok := conf["apiURL"]
 	if ok {
 		delete(conf, "apiURL")
 	}
 	conf["subject"] = "Hello, This is an official email from BDOS Update Center"
+	if subject, ok := params["subject"]; ok {
+		conf["subject"] = subject
+	}
 	conf["to"] = params["email"]
 	conf["html"] = params["html"]
 
@@ -43,22 +49,24 @@ func SendMail(params map[string]string) (bool, error) {
 
 func RandPassword(n int) string {
 	const letterBytes = "1234567890abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
-	b := make([]byte, n)
-	seed := rand.NewSource(time.Now().Unix())
-	r := rand.New(seed)
-	for i := range b {
-		b[i] = letterBytes[r.Intn(len(letterBytes))]
-	}
-	return string(b)
+	return randString(letterBytes, n)
 }
 
 func ValidCode(n int) string {
 	const letterBytes = "1234567890"
+	return randString(letterBytes, n)
+}
+
+// randString draws from crypto/rand, the codes are used as credentials
+func randString(letterBytes string, n int) string {
 	b := make([]byte, n)
-	seed := rand.NewSource(time.Now().Unix())
-	r := rand.New(seed)
+	max := big.NewInt(int64(len(letterBytes)))
 	for i := range b {
-		b[i] = letterBytes[r.Intn(len(letterBytes))]
+		r, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		b[i] = letterBytes[r.Int64()]
 	}
 	return string(b)
 }
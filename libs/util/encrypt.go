@@ -2,7 +2,9 @@ package util
 
 import (
 	"crypto/md5"
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"hash"
 	"io"
@@ -21,3 +23,22 @@ func Encrypt(origin string, algorithm string) string {
 	io.WriteString(h, setting.Secret)
 	return fmt.Sprintf("%x", h.Sum(nil))
 }
+
+// AccessTokenPrefix marks personal access tokens, which are sent as bearer
+// tokens just like JWTs
+const AccessTokenPrefix = "gout_"
+
+// RandToken returns n random bytes as a hex string
+func RandToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// HashToken digests an opaque token for storage, only the digest is persisted
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,48 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ETag tags a version of a record by the count of its changes
+func ETag(id int, version int) string {
+	return fmt.Sprintf(`"%d-%d"`, id, version)
+}
+
+// IfNoneMatch reports whether the If-None-Match header of the request lists
+// etag, the client has the current version then
+func IfNoneMatch(c *gin.Context, etag string) bool {
+	header := c.GetHeader("If-None-Match")
+	return header != "" && matchETag(header, etag, true)
+}
+
+// IfMatch reports whether a change to the record tagged etag may go ahead:
+// the request has no If-Match header or the header lists etag
+func IfMatch(c *gin.Context, etag string) bool {
+	header := c.GetHeader("If-Match")
+	return header == "" || matchETag(header, etag, false)
+}
+
+// matchETag compares etag with a list of tags, weak tags count for weak
+// comparison only
+func matchETag(header string, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = tag[2:]
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package util
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestETag(t *testing.T) {
+	if got := ETag(7, 3); got != `"7-3"` {
+		t.Fatalf("ETag() = %s", got)
+	}
+}
+
+func TestETagPreconditions(t *testing.T) {
+	etag := ETag(7, 100)
+
+	tests := []struct {
+		name        string
+		header      string
+		ifMatch     bool
+		ifNoneMatch bool
+	}{
+		{name: "no header", header: "", ifMatch: true, ifNoneMatch: false},
+		{name: "same tag", header: `"7-100"`, ifMatch: true, ifNoneMatch: true},
+		{name: "older tag", header: `"7-99"`, ifMatch: false, ifNoneMatch: false},
+		{name: "weak tag", header: `W/"7-100"`, ifMatch: false, ifNoneMatch: true},
+		{name: "any", header: "*", ifMatch: true, ifNoneMatch: true},
+		{name: "list", header: `"7-99", "7-100"`, ifMatch: true, ifNoneMatch: true},
+		{name: "list of weak tags", header: `W/"7-99",W/"7-100"`, ifMatch: false, ifNoneMatch: true},
+		{name: "unquoted tag", header: "7-100", ifMatch: false, ifNoneMatch: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("PUT", "/", nil)
+			if tt.header != "" {
+				c.Request.Header.Set("If-Match", tt.header)
+				c.Request.Header.Set("If-None-Match", tt.header)
+			}
+
+			if got := IfMatch(c, etag); got != tt.ifMatch {
+				t.Errorf("IfMatch() = %v, want %v", got, tt.ifMatch)
+			}
+			if got := IfNoneMatch(c, etag); got != tt.ifNoneMatch {
+				t.Errorf("IfNoneMatch() = %v, want %v", got, tt.ifNoneMatch)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"errors"
 	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
@@ -9,34 +10,92 @@ import (
 )
 
 type Claims struct {
-	ID int `json:"id"`
+	ID      int    `json:"id"`
+	Family  string `json:"fam,omitempty"`
+	Purpose string `json:"pur,omitempty"`
 	jwt.StandardClaims
 }
 
-func GenerateToken(id int) (string, error) {
+// MfaAudience is the audience of tokens that only finish a login
+const MfaAudience = "gout-mfa"
+
+var (
+	ErrUnexpectedAlg = errors.New("unexpected signing method")
+	ErrTokenAudience = errors.New("token is not meant for this use")
+)
+
+// GenerateToken issues a short-lived access token, family ties it to the
+// refresh token it was issued with
+func GenerateToken(id int, family string) (string, *Claims, error) {
 	nowTime := time.Now()
-	expireTime := nowTime.Add(7 * 24 * time.Hour)
+	expireTime := nowTime.Add(setting.AccessTokenExpire)
 
 	claims := Claims{
 		id,
+		family,
+		"",
 		jwt.StandardClaims{
+			Id:        RandToken(16),
+			IssuedAt:  nowTime.Unix(),
 			ExpiresAt: expireTime.Unix(),
 			Issuer:    "linktimecloud",
 		},
 	}
 
-	var jwtSecret = []byte(setting.Secret)
-	tokenClaims := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	token, err := tokenClaims.SignedString(jwtSecret)
+	token, err := signToken(claims)
+
+	return token, &claims, err
+}
+
+// GenerateMfaToken issues a token that is only good for finishing a login
+// at /api/auth/mfa, its audience makes ParseToken refuse it
+func GenerateMfaToken(id int, purpose string) (string, error) {
+	nowTime := time.Now()
+	expireTime := nowTime.Add(setting.MfaTokenExpire)
+
+	claims := Claims{
+		ID:      id,
+		Purpose: purpose,
+		StandardClaims: jwt.StandardClaims{
+			Id:        RandToken(16),
+			IssuedAt:  nowTime.Unix(),
+			ExpiresAt: expireTime.Unix(),
+			Issuer:    "linktimecloud",
+			Audience:  MfaAudience,
+		},
+	}
 
-	return token, err
+	return signToken(claims)
 }
 
-func ParseToken(token string, secret string) (*Claims, error) {
-	var jwtSecret = []byte(secret)
-	tokenClaims, err := jwt.ParseWithClaims(token, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+// ParseToken parses an access token, MFA tokens are refused
+func ParseToken(token string) (*Claims, error) {
+	claims, err := parseClaims(token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Audience != "" || claims.Purpose != "" {
+		return nil, ErrTokenAudience
+	}
+
+	return claims, nil
+}
+
+// ParseMfaToken parses a token issued by GenerateMfaToken
+func ParseMfaToken(token string) (*Claims, error) {
+	claims, err := parseClaims(token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Audience != MfaAudience || claims.Purpose == "" {
+		return nil, ErrTokenAudience
+	}
+
+	return claims, nil
+}
+
+func parseClaims(token string) (*Claims, error) {
+	tokenClaims, err := jwt.ParseWithClaims(token, &Claims{}, verifyKey)
 
 	if tokenClaims != nil {
 		if claims, ok := tokenClaims.Claims.(*Claims); ok && tokenClaims.Valid {
@@ -46,3 +105,42 @@ func ParseToken(token string, secret string) (*Claims, error) {
 
 	return nil, err
 }
+
+// signToken signs with the current key of the key set, the kid header tells
+// verifiers which public key of /.well-known/jwks.json to use
+func signToken(claims jwt.Claims) (string, error) {
+	if !asymmetric() {
+		var jwtSecret = []byte(setting.Secret)
+		tokenClaims := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return tokenClaims.SignedString(jwtSecret)
+	}
+
+	key := keys.signer()
+	if key == nil {
+		return "", ErrNoSigningKey
+	}
+	tokenClaims := jwt.NewWithClaims(key.method, claims)
+	tokenClaims.Header["kid"] = key.kid
+	return tokenClaims.SignedString(key.private)
+}
+
+// verifyKey only accepts the configured family of algorithms, so a token
+// can't pick HS256 and be checked against a public key
+func verifyKey(token *jwt.Token) (interface{}, error) {
+	if !asymmetric() {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, ErrUnexpectedAlg
+		}
+		return []byte(setting.Secret), nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key := keys.lookup(kid)
+	if key == nil {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, ErrUnexpectedAlg
+	}
+	return key.public, nil
+}
@@ -0,0 +1,278 @@
+package util
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/Chalin-Shi/gout/libs/logging"
+	"github.com/Chalin-Shi/gout/libs/setting"
+)
+
+// StoredKey is a signing key as persisted by a KeyStore, PrivateKey is a
+// PKCS#8 PEM block and the timestamps are in milliseconds
+type StoredKey struct {
+	Kid        string
+	Alg        string
+	PrivateKey string
+	CreatedAt  int64
+	RetiredAt  int64
+}
+
+// KeyStore persists the signing keys shared by every instance
+type KeyStore interface {
+	LoadKeys() ([]StoredKey, error)
+	AddKey(key StoredKey) error
+	// RetireKeys retires every active key but the one with kid except
+	RetireKeys(except string, at int64) error
+	// PurgeKeys drops the keys retired before the given time
+	PurgeKeys(retiredBefore int64) error
+}
+
+type signingKey struct {
+	kid       string
+	method    jwt.SigningMethod
+	private   interface{}
+	public    interface{}
+	createdAt int64
+	retiredAt int64
+}
+
+type keySet struct {
+	sync.RWMutex
+	store    KeyStore
+	keys     map[string]*signingKey
+	current  *signingKey
+	loadedAt time.Time
+}
+
+var (
+	keys = &keySet{keys: make(map[string]*signingKey)}
+
+	// how often instances pick up keys rotated by the others
+	keyReloadInterval = time.Minute
+
+	ErrNoSigningKey = errors.New("no signing key")
+	ErrUnknownKey   = errors.New("unknown signing key")
+)
+
+// asymmetric reports whether tokens are signed with the key set rather than
+// the [app] SECRET
+func asymmetric() bool {
+	return setting.JwtAlgorithm != "HS256"
+}
+
+// InitKeySet loads the signing keys from store and creates the first one
+func InitKeySet(store KeyStore) error {
+	if !asymmetric() {
+		return nil
+	}
+	keys.store = store
+	if err := keys.load(); err != nil {
+		return err
+	}
+	return keys.rotateIfDue()
+}
+
+// StartKeyRotation reloads the key set in the background and rotates the
+// signing key once it is older than [jwt] ROTATE_INTERVAL
+func StartKeyRotation() {
+	if !asymmetric() {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(keyReloadInterval)
+		for range ticker.C {
+			if err := keys.load(); err != nil {
+				logging.Error("load signing keys", err)
+				continue
+			}
+			if err := keys.rotateIfDue(); err != nil {
+				logging.Error("rotate signing keys", err)
+			}
+		}
+	}()
+}
+
+func (s *keySet) load() error {
+	stored, err := s.store.LoadKeys()
+	if err != nil {
+		return err
+	}
+
+	loaded := make(map[string]*signingKey)
+	var current *signingKey
+	for _, k := range stored {
+		key, err := parseStoredKey(k)
+		if err != nil {
+			logging.Error("parse signing key", k.Kid, err)
+			continue
+		}
+		loaded[key.kid] = key
+		if key.retiredAt == 0 && key.method.Alg() == setting.JwtAlgorithm {
+			if current == nil || key.createdAt > current.createdAt {
+				current = key
+			}
+		}
+	}
+
+	s.Lock()
+	s.keys = loaded
+	s.current = current
+	s.loadedAt = time.Now()
+	s.Unlock()
+	return nil
+}
+
+func (s *keySet) rotateIfDue() error {
+	s.RLock()
+	current := s.current
+	s.RUnlock()
+
+	nowTime := time.Now().UnixNano() / 1000000
+	if current != nil && nowTime-current.createdAt < int64(setting.JwtRotateInterval/time.Millisecond) {
+		return nil
+	}
+
+	stored, err := generateKey(setting.JwtAlgorithm)
+	if err != nil {
+		return err
+	}
+	stored.CreatedAt = nowTime
+	if err := s.store.AddKey(stored); err != nil {
+		return err
+	}
+	if err := s.store.RetireKeys(stored.Kid, nowTime); err != nil {
+		return err
+	}
+
+	// retired keys verify the tokens they signed until those expire
+	retention := setting.AccessTokenExpire
+	if setting.MfaTokenExpire > retention {
+		retention = setting.MfaTokenExpire
+	}
+	retention += 2 * keyReloadInterval
+	if err := s.store.PurgeKeys(nowTime - int64(retention/time.Millisecond)); err != nil {
+		return err
+	}
+	return s.load()
+}
+
+func (s *keySet) signer() *signingKey {
+	s.RLock()
+	defer s.RUnlock()
+	return s.current
+}
+
+func (s *keySet) lookup(kid string) *signingKey {
+	s.RLock()
+	key, ok := s.keys[kid]
+	stale := time.Since(s.loadedAt) > 10*time.Second
+	s.RUnlock()
+	if ok || !stale || s.store == nil {
+		return key
+	}
+
+	// the key may have been rotated in by another instance
+	if err := s.load(); err != nil {
+		logging.Error("load signing keys", err)
+		return nil
+	}
+	s.RLock()
+	defer s.RUnlock()
+	return s.keys[kid]
+}
+
+func generateKey(alg string) (StoredKey, error) {
+	var private interface{}
+	var err error
+	switch alg {
+	case "RS256":
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "EdDSA":
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		err = jwt.ErrSignatureInvalid
+	}
+	if err != nil {
+		return StoredKey{}, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return StoredKey{}, err
+	}
+	block := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	return StoredKey{Kid: RandToken(8), Alg: alg, PrivateKey: string(block)}, nil
+}
+
+func parseStoredKey(k StoredKey) (*signingKey, error) {
+	block, _ := pem.Decode([]byte(k.PrivateKey))
+	if block == nil {
+		return nil, errors.New("invalid PEM block")
+	}
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{kid: k.Kid, private: private, createdAt: k.CreatedAt, retiredAt: k.RetiredAt}
+	switch p := private.(type) {
+	case *rsa.PrivateKey:
+		key.method, key.public = jwt.SigningMethodRS256, &p.PublicKey
+	case *ecdsa.PrivateKey:
+		key.method, key.public = jwt.SigningMethodES256, &p.PublicKey
+	case ed25519.PrivateKey:
+		key.method, key.public = SigningMethodEd25519, p.Public()
+	default:
+		return nil, jwt.ErrInvalidKeyType
+	}
+	if key.method.Alg() != k.Alg {
+		return nil, jwt.ErrInvalidKeyType
+	}
+	return key, nil
+}
+
+// JWKS returns the public half of every key that can still verify a token,
+// in the JSON Web Key Set format of RFC 7517
+func JWKS() map[string]interface{} {
+	keys.RLock()
+	defer keys.RUnlock()
+
+	b64 := base64.RawURLEncoding
+	list := make([]map[string]string, 0, len(keys.keys))
+	for _, key := range keys.keys {
+		jwk := map[string]string{"kid": key.kid, "alg": key.method.Alg(), "use": "sig"}
+		switch p := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = b64.EncodeToString(p.N.Bytes())
+			jwk["e"] = b64.EncodeToString(big.NewInt(int64(p.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (p.Curve.Params().BitSize + 7) / 8
+			jwk["kty"] = "EC"
+			jwk["crv"] = p.Curve.Params().Name
+			jwk["x"] = b64.EncodeToString(p.X.FillBytes(make([]byte, size)))
+			jwk["y"] = b64.EncodeToString(p.Y.FillBytes(make([]byte, size)))
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = b64.EncodeToString(p)
+		}
+		list = append(list, jwk)
+	}
+	return map[string]interface{}{"keys": list}
+}
@@ -0,0 +1,256 @@
+package util
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"gopkg.in/ldap.v3"
+
+	"github.com/Chalin-Shi/gout/libs/logging"
+	"github.com/Chalin-Shi/gout/libs/setting"
+)
+
+// LdapEntry is a directory user which passed a bind
+type LdapEntry struct {
+	DN       string
+	Email    string
+	Username string
+}
+
+// LdapGroup is a directory group with the emails of its members
+type LdapGroup struct {
+	DN      string
+	Name    string
+	Desc    string
+	Members []string
+}
+
+var (
+	ErrLdapDisabled           = errors.New("ldap is not enabled")
+	ErrLdapUserNotFound       = errors.New("ldap user not found")
+	ErrLdapInvalidCredentials = errors.New("ldap invalid credentials")
+)
+
+// LdapAuthenticate binds as the directory user behind login, ErrLdapUserNotFound
+// and ErrLdapInvalidCredentials tell a rejected login from an unreachable
+// directory
+func LdapAuthenticate(login string, password string) (*LdapEntry, error) {
+	if !setting.LdapEnabled {
+		return nil, ErrLdapDisabled
+	}
+	// an empty password would be an anonymous bind which always succeeds
+	if password == "" {
+		return nil, ErrLdapInvalidCredentials
+	}
+
+	conn, err := ldapDial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var dn string
+	if setting.LdapUserDNTemplate != "" {
+		dn = fmt.Sprintf(setting.LdapUserDNTemplate, escapeDN(login))
+	} else {
+		if err := conn.Bind(setting.LdapBindDN, setting.LdapBindPassword); err != nil {
+			return nil, err
+		}
+		filter := fmt.Sprintf(setting.LdapUserFilter, ldap.EscapeFilter(login))
+		entries, err := ldapSearch(conn, setting.LdapBaseDN, ldap.ScopeWholeSubtree, filter)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) != 1 {
+			return nil, ErrLdapUserNotFound
+		}
+		dn = entries[0].DN
+	}
+
+	if err := conn.Bind(dn, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrLdapInvalidCredentials
+		}
+		return nil, err
+	}
+
+	entries, err := ldapSearch(conn, dn, ldap.ScopeBaseObject, "(objectClass=*)")
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) != 1 {
+		return nil, ErrLdapUserNotFound
+	}
+	entry := &LdapEntry{
+		DN:       dn,
+		Email:    entries[0].GetAttributeValue(setting.LdapEmailAttr),
+		Username: entries[0].GetAttributeValue(setting.LdapUsernameAttr),
+	}
+	if entry.Email == "" {
+		entry.Email = login
+	}
+	return entry, nil
+}
+
+// LdapGroups reads every group matched by GROUP_FILTER, members which are not
+// users matched by USER_FILTER are left out
+func LdapGroups() ([]LdapGroup, error) {
+	if !setting.LdapEnabled {
+		return nil, ErrLdapDisabled
+	}
+
+	conn, err := ldapDial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.Bind(setting.LdapBindDN, setting.LdapBindPassword); err != nil {
+		return nil, err
+	}
+
+	users, err := ldapSearch(conn, setting.LdapBaseDN, ldap.ScopeWholeSubtree, fmt.Sprintf(setting.LdapUserFilter, "*"))
+	if err != nil {
+		return nil, err
+	}
+	emails := make(map[string]string, len(users))
+	for _, user := range users {
+		if email := user.GetAttributeValue(setting.LdapEmailAttr); email != "" {
+			emails[normalizeDN(user.DN)] = email
+		}
+	}
+
+	entries, err := ldapSearch(conn, setting.LdapGroupBaseDN, ldap.ScopeWholeSubtree, setting.LdapGroupFilter)
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]LdapGroup, 0, len(entries))
+	for _, entry := range entries {
+		group := LdapGroup{
+			DN:   entry.DN,
+			Name: entry.GetAttributeValue(setting.LdapGroupNameAttr),
+			Desc: entry.GetAttributeValue(setting.LdapGroupDescAttr),
+		}
+		if group.Name == "" {
+			continue
+		}
+		for _, member := range entry.GetAttributeValues(setting.LdapGroupMemberAttr) {
+			if email, ok := emails[normalizeDN(member)]; ok {
+				group.Members = append(group.Members, email)
+			}
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// StartLdapSync hands the directory groups to sync every SYNC_INTERVAL,
+// starting right away
+func StartLdapSync(sync func([]LdapGroup) error) {
+	if !setting.LdapEnabled || setting.LdapSyncInterval <= 0 {
+		return
+	}
+
+	run := func() {
+		groups, err := LdapGroups()
+		if err == nil {
+			err = sync(groups)
+		}
+		if err != nil {
+			logging.Error("ldap sync", err)
+		}
+	}
+
+	go func() {
+		run()
+		ticker := time.NewTicker(setting.LdapSyncInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			run()
+		}
+	}()
+}
+
+func ldapDial() (*ldap.Conn, error) {
+	u, err := url.Parse(setting.LdapURL)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		port := "389"
+		if u.Scheme == "ldaps" {
+			port = "636"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	config := &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: setting.LdapSkipVerify}
+
+	var conn *ldap.Conn
+	if u.Scheme == "ldaps" {
+		conn, err = ldap.DialTLS("tcp", host, config)
+	} else {
+		conn, err = ldap.Dial("tcp", host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(setting.LdapTimeout)
+
+	if setting.LdapStartTLS && u.Scheme != "ldaps" {
+		if err := conn.StartTLS(config); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func ldapSearch(conn *ldap.Conn, base string, scope int, filter string) ([]*ldap.Entry, error) {
+	request := ldap.NewSearchRequest(
+		base, scope, ldap.NeverDerefAliases, 0, 0, false, filter,
+		[]string{"dn", setting.LdapEmailAttr, setting.LdapUsernameAttr, setting.LdapGroupNameAttr, setting.LdapGroupDescAttr, setting.LdapGroupMemberAttr},
+		nil,
+	)
+	result, err := conn.SearchWithPaging(request, 500)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return result.Entries, nil
+}
+
+// escapeDN escapes an attribute value put into a DN (RFC 4514)
+func escapeDN(value string) string {
+	var b strings.Builder
+	for i, r := range value {
+		switch {
+		case strings.ContainsRune(`,+"\<>;=`, r),
+			i == 0 && (r == ' ' || r == '#'),
+			i == len(value)-1 && r == ' ':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func normalizeDN(dn string) string {
+	if parsed, err := ldap.ParseDN(dn); err == nil {
+		parts := make([]string, 0, len(parsed.RDNs))
+		for _, rdn := range parsed.RDNs {
+			for _, attr := range rdn.Attributes {
+				parts = append(parts, strings.ToLower(attr.Type)+"="+strings.ToLower(attr.Value))
+			}
+		}
+		return strings.Join(parts, ",")
+	}
+	return strings.ToLower(dn)
+}
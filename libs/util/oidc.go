@@ -0,0 +1,318 @@
+package util
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/Chalin-Shi/gout/libs/setting"
+)
+
+// OIDCProvider is the relying party side of an OpenID Connect provider,
+// configured from its discovery document
+type OIDCProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+
+	mu        sync.RWMutex
+	keys      map[string]interface{}
+	fetchedAt time.Time
+}
+
+var (
+	oidcClient = &http.Client{Timeout: 10 * time.Second}
+
+	oidcMu       sync.Mutex
+	oidcProvider *OIDCProvider
+
+	ErrOIDCDisabled = errors.New("oidc is not enabled")
+	ErrInvalidToken = errors.New("invalid id token")
+)
+
+// GetOIDCProvider discovers the configured provider once and caches it
+func GetOIDCProvider() (*OIDCProvider, error) {
+	if !setting.OidcEnabled {
+		return nil, ErrOIDCDisabled
+	}
+
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+	if oidcProvider != nil {
+		return oidcProvider, nil
+	}
+
+	issuer := strings.TrimSuffix(setting.OidcIssuer, "/")
+	var provider OIDCProvider
+	if err := getJSON(issuer+"/.well-known/openid-configuration", &provider); err != nil {
+		return nil, err
+	}
+	if provider.Issuer != issuer {
+		return nil, fmt.Errorf("oidc issuer mismatch, expected %q got %q", issuer, provider.Issuer)
+	}
+	oidcProvider = &provider
+	return oidcProvider, nil
+}
+
+// PKCEChallenge derives the S256 code challenge of a verifier
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL is where the browser is sent to log in at the provider
+func (p *OIDCProvider) AuthCodeURL(state string, nonce string, verifier string) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", setting.OidcClientID)
+	query.Set("redirect_uri", setting.OidcRedirectURL)
+	query.Set("scope", strings.Join(setting.OidcScopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", PKCEChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.AuthorizationEndpoint + sep + query.Encode()
+}
+
+// Exchange trades an authorization code for the provider's ID token
+func (p *OIDCProvider) Exchange(code string, verifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", setting.OidcRedirectURL)
+	form.Set("client_id", setting.OidcClientID)
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequest("POST", p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if setting.OidcClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(setting.OidcClientID), url.QueryEscape(setting.OidcClientSecret))
+	}
+
+	resp, err := oidcClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK || result.IDToken == "" {
+		return "", fmt.Errorf("oidc token endpoint: %d %s %s", resp.StatusCode, result.Error, result.ErrorDescription)
+	}
+	return result.IDToken, nil
+}
+
+// VerifyIDToken checks the signature of an ID token against the provider's
+// JWKS together with its issuer, audience, expiry and nonce
+func (p *OIDCProvider) VerifyIDToken(raw string, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA, *SigningMethodEdDSA:
+		default:
+			return nil, ErrUnexpectedAlg
+		}
+		kid, _ := token.Header["kid"].(string)
+		key, err := p.key(kid)
+		if err == ErrUnknownKey && kid == "" {
+			if single, ok := p.singleKey(); ok {
+				return single, nil
+			}
+		}
+		return key, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	if iss, _ := claims["iss"].(string); iss != p.Issuer {
+		return nil, ErrInvalidToken
+	}
+	if !claims.VerifyAudience(setting.OidcClientID, true) && !containsAudience(claims["aud"], setting.OidcClientID) {
+		return nil, ErrInvalidToken
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, ErrInvalidToken
+	}
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// ClaimStrings reads a claim that may be a single string or a list of them
+func ClaimStrings(claims jwt.MapClaims, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func containsAudience(aud interface{}, clientID string) bool {
+	list, ok := aud.([]interface{})
+	if !ok {
+		return false
+	}
+	for _, a := range list {
+		if s, ok := a.(string); ok && s == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// key returns the provider key named kid, the JWKS is fetched again when an
+// unknown kid shows up since providers rotate their keys too
+func (p *OIDCProvider) key(kid string) (interface{}, error) {
+	p.mu.RLock()
+	key, ok := p.keys[kid]
+	stale := time.Since(p.fetchedAt) > time.Minute
+	p.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	if !stale && p.keys != nil {
+		return nil, ErrUnknownKey
+	}
+
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	if err := getJSON(p.JwksURI, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]interface{})
+	for _, jwk := range set.Keys {
+		if use, ok := jwk["use"]; ok && use != "sig" {
+			continue
+		}
+		if public, err := parseJWK(jwk); err == nil {
+			keys[jwk["kid"]] = public
+		}
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.fetchedAt = time.Now()
+	p.mu.Unlock()
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// singleKey covers providers which publish one key and leave out the kid
+func (p *OIDCProvider) singleKey() (interface{}, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if len(p.keys) != 1 {
+		return nil, false
+	}
+	for _, key := range p.keys {
+		return key, true
+	}
+	return nil, false
+}
+
+func parseJWK(jwk map[string]string) (interface{}, error) {
+	b64 := base64.RawURLEncoding
+	decode := func(name string) (*big.Int, error) {
+		b, err := b64.DecodeString(jwk[name])
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch jwk["kty"] {
+	case "RSA":
+		n, err := decode("n")
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode("e")
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if jwk["crv"] != "P-256" {
+			return nil, jwt.ErrInvalidKeyType
+		}
+		x, err := decode("x")
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode("y")
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	case "OKP":
+		if jwk["crv"] != "Ed25519" {
+			return nil, jwt.ErrInvalidKeyType
+		}
+		x, err := b64.DecodeString(jwk["x"])
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, jwt.ErrInvalidKeyType
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, jwt.ErrInvalidKeyType
+}
+
+func getJSON(URL string, v interface{}) error {
+	resp, err := oidcClient.Get(URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", URL, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
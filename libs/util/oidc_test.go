@@ -0,0 +1,159 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/Chalin-Shi/gout/libs/setting"
+)
+
+// mockProvider is an OpenID Connect provider serving discovery, JWKS and a
+// token endpoint which checks the PKCE verifier of the code it hands out
+type mockProvider struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+	audience  string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &mockProvider{key: key, audience: "gout"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		b64 := base64.RawURLEncoding
+		json.NewEncoder(w).Encode(map[string][]map[string]string{
+			"keys": {{
+				"kty": "RSA",
+				"use": "sig",
+				"kid": "k1",
+				"n":   b64.EncodeToString(key.N.Bytes()),
+				"e":   b64.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != "code" || PKCEChallenge(r.Form.Get("code_verifier")) != p.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            p.URL,
+			"aud":            p.audience,
+			"sub":            "subject",
+			"exp":            time.Now().Add(time.Minute).Unix(),
+			"nonce":          p.nonce,
+			"email":          "user@example.com",
+			"email_verified": true,
+		})
+		token.Header["kid"] = "k1"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+	})
+	p.Server = httptest.NewServer(mux)
+
+	setting.OidcEnabled = true
+	setting.OidcIssuer = p.URL
+	setting.OidcClientID = "gout"
+	setting.OidcRedirectURL = "http://localhost/api/auth/oidc/callback"
+	oidcProvider = nil
+
+	return p
+}
+
+func TestOIDCProvider(t *testing.T) {
+	mock := newMockProvider(t)
+	defer mock.Close()
+
+	provider, err := GetOIDCProvider()
+	if err != nil {
+		t.Fatalf("discovery failed: %v", err)
+	}
+	if provider.TokenEndpoint != mock.URL+"/token" || provider.JwksURI != mock.URL+"/jwks" {
+		t.Fatalf("unexpected discovery document %+v", provider)
+	}
+
+	tests := []struct {
+		name        string
+		verifier    string
+		nonce       string
+		tokenNonce  string
+		audience    string
+		exchangeErr bool
+		verifyErr   bool
+	}{
+		{name: "valid", verifier: "verifier", nonce: "nonce", tokenNonce: "nonce", audience: "gout"},
+		{name: "wrong verifier", verifier: "other", nonce: "nonce", tokenNonce: "nonce", audience: "gout", exchangeErr: true},
+		{name: "wrong nonce", verifier: "verifier", nonce: "nonce", tokenNonce: "replayed", audience: "gout", verifyErr: true},
+		{name: "missing nonce", verifier: "verifier", nonce: "nonce", tokenNonce: "", audience: "gout", verifyErr: true},
+		{name: "wrong audience", verifier: "verifier", nonce: "nonce", tokenNonce: "nonce", audience: "other", verifyErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authURL, err := url.Parse(provider.AuthCodeURL("state", tt.nonce, "verifier"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			query := authURL.Query()
+			if query.Get("code_challenge_method") != "S256" || query.Get("nonce") != tt.nonce {
+				t.Fatalf("unexpected authorization url %s", authURL)
+			}
+			mock.challenge = query.Get("code_challenge")
+			mock.nonce = tt.tokenNonce
+			mock.audience = tt.audience
+
+			idToken, err := provider.Exchange("code", tt.verifier)
+			if (err != nil) != tt.exchangeErr {
+				t.Fatalf("Exchange() error = %v, want error %v", err, tt.exchangeErr)
+			}
+			if err != nil {
+				return
+			}
+
+			claims, err := provider.VerifyIDToken(idToken, tt.nonce)
+			if (err != nil) != tt.verifyErr {
+				t.Fatalf("VerifyIDToken() error = %v, want error %v", err, tt.verifyErr)
+			}
+			if err == nil && claims["sub"] != "subject" {
+				t.Fatalf("unexpected subject %v", claims["sub"])
+			}
+		})
+	}
+}
+
+func TestPKCEChallenge(t *testing.T) {
+	// RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	if got := PKCEChallenge(verifier); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Fatalf("PKCEChallenge() = %s", got)
+	}
+}
@@ -1,6 +1,11 @@
 package util
 
 import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
 	"github.com/Unknwon/com"
 	"github.com/gin-gonic/gin"
 
@@ -13,3 +18,188 @@ func GetPage(c *gin.Context) (int, int) {
 
 	return limit, offset
 }
+
+// Fields maps the fields a list can be filtered and sorted by, as named in
+// the json of its records, to their columns. Every list has an id field.
+type Fields map[string]string
+
+// Filter is a condition on a column, Op is one of = != > >= < <= and LIKE
+type Filter struct {
+	Column string
+	Op     string
+	Value  interface{}
+}
+
+// Query is a page of a list as asked for by the query string: limit, start
+// or cursor, sort=field,-field and filters like email~=foo, createdAt>=
+// 1552896000000 or groupId=2
+type Query struct {
+	Limit   int
+	Start   int
+	Filters []Filter
+	Order   []string
+
+	// cursor pagination walks the list by id from the record after Cursor
+	UseCursor bool
+	Cursor    int
+	Desc      bool
+	IdColumn  string
+}
+
+// Pagination describes the page of a list response, Next is the cursor of
+// the following page when the list is walked by cursor
+type Pagination struct {
+	Total int    `json:"total"`
+	Start int    `json:"start"`
+	Limit int    `json:"limit"`
+	Next  string `json:"next,omitempty"`
+}
+
+var filterOps = map[string]string{
+	"=":  "=",
+	"!=": "<>",
+	">":  ">",
+	">=": ">=",
+	"<":  "<",
+	"<=": "<=",
+	"~=": "LIKE",
+}
+
+var queryKeys = map[string]bool{"limit": true, "start": true, "cursor": true, "sort": true}
+
+// GetQuery reads the page, sorting and filters of a list request. Only
+// fields are accepted, sort is the order used when none is asked for.
+func GetQuery(c *gin.Context, fields Fields, sort string) (Query, error) {
+	q := Query{IdColumn: fields["id"]}
+
+	limit, start := GetPage(c)
+	if limit <= 0 {
+		limit = com.StrTo(setting.Limit).MustInt()
+	}
+	if limit > setting.MaxLimit {
+		limit = setting.MaxLimit
+	}
+	if start < 0 {
+		start = 0
+	}
+	q.Limit, q.Start = limit, start
+
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		q.UseCursor, q.Start = true, 0
+		if cursor != "" {
+			id, err := DecodeCursor(cursor)
+			if err != nil {
+				return q, err
+			}
+			q.Cursor = id
+		}
+	}
+
+	if s, ok := c.GetQuery("sort"); ok {
+		sort = s
+	} else if q.UseCursor {
+		sort = "id"
+	}
+	for _, field := range strings.Split(sort, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		desc := strings.HasPrefix(field, "-")
+		column, ok := fields[strings.TrimPrefix(field, "-")]
+		if !ok {
+			return q, fmt.Errorf("can't sort by %s", field)
+		}
+		if q.UseCursor {
+			if column != q.IdColumn {
+				return q, fmt.Errorf("cursor pages are sorted by id, not %s", field)
+			}
+			q.Desc = desc
+		}
+		if desc {
+			column += " desc"
+		}
+		q.Order = append(q.Order, column)
+	}
+
+	for key, values := range c.Request.URL.Query() {
+		if queryKeys[key] {
+			continue
+		}
+		field, op, value, ok := parseFilter(key, values[0])
+		if !ok {
+			return q, fmt.Errorf("invalid filter %s", key)
+		}
+		column, known := fields[field]
+		if !known {
+			// plain parameters of the endpoint, like ?deleted=true
+			if op == "=" {
+				continue
+			}
+			return q, fmt.Errorf("can't filter by %s", field)
+		}
+		q.Filters = append(q.Filters, newFilter(column, op, value))
+	}
+
+	return q, nil
+}
+
+// Paginate describes the page of q in a list of total records, lastId is the
+// id of the last record of the page
+func (q Query) Paginate(total int, count int, lastId int) Pagination {
+	page := Pagination{Total: total, Start: q.Start, Limit: q.Limit}
+	if q.UseCursor && count == q.Limit && lastId > 0 {
+		page.Next = EncodeCursor(lastId)
+	}
+	return page
+}
+
+func EncodeCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(id)))
+}
+
+func DecodeCursor(cursor string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+	id, err := strconv.Atoi(string(b))
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+	return id, nil
+}
+
+// parseFilter splits a query parameter into field, operator and value. The
+// query string createdAt>=1 arrives as the key createdAt> with the value 1,
+// createdAt>1 as the key createdAt>1 without a value.
+func parseFilter(key string, value string) (string, string, string, bool) {
+	i := strings.IndexAny(key, "~!<>")
+	if i < 0 {
+		return key, "=", value, true
+	}
+	field, rest := key[:i], key[i:]
+	if len(rest) == 1 {
+		return field, rest + "=", value, true
+	}
+	if (rest[0] == '<' || rest[0] == '>') && value == "" {
+		return field, rest[:1], rest[1:], true
+	}
+	return "", "", "", false
+}
+
+func newFilter(column string, op string, value string) Filter {
+	if op == "~=" {
+		replacer := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+		return Filter{Column: column, Op: filterOps[op], Value: "%" + replacer.Replace(value) + "%"}
+	}
+
+	var v interface{} = value
+	switch value {
+	case "true":
+		v = true
+	case "false":
+		v = false
+	}
+	return Filter{Column: column, Op: filterOps[op], Value: v}
+}
@@ -0,0 +1,124 @@
+package util
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Chalin-Shi/gout/libs/setting"
+)
+
+var testFields = Fields{"id": "id", "email": "email", "createdAt": "created_at", "groupId": "group_id"}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		key   string
+		value string
+		field string
+		op    string
+		want  string
+		ok    bool
+	}{
+		{key: "email", value: "foo", field: "email", op: "=", want: "foo", ok: true},
+		{key: "email~", value: "foo", field: "email", op: "~=", want: "foo", ok: true},
+		{key: "groupId!", value: "2", field: "groupId", op: "!=", want: "2", ok: true},
+		{key: "createdAt>", value: "1", field: "createdAt", op: ">=", want: "1", ok: true},
+		{key: "createdAt<", value: "1", field: "createdAt", op: "<=", want: "1", ok: true},
+		{key: "createdAt>1", value: "", field: "createdAt", op: ">", want: "1", ok: true},
+		{key: "createdAt<1", value: "", field: "createdAt", op: "<", want: "1", ok: true},
+		{key: "createdAt>1", value: "2"},
+		{key: "email~x", value: ""},
+		{key: "email!x", value: ""},
+	}
+
+	for _, tt := range tests {
+		field, op, value, ok := parseFilter(tt.key, tt.value)
+		if ok != tt.ok || field != tt.field || op != tt.op || value != tt.want {
+			t.Errorf("parseFilter(%q, %q) = %q, %q, %q, %v, want %q, %q, %q, %v",
+				tt.key, tt.value, field, op, value, ok, tt.field, tt.op, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestGetQuery(t *testing.T) {
+	setting.Limit, setting.MaxLimit = "10", 100
+
+	tests := []struct {
+		name  string
+		query string
+		order string
+		want  Query
+		err   bool
+	}{
+		{
+			name:  "defaults",
+			order: "email",
+			want:  Query{Limit: 10, Order: []string{"email"}, IdColumn: "id"},
+		},
+		{
+			name:  "page",
+			query: "limit=20&start=40&sort=-createdAt,id",
+			want:  Query{Limit: 20, Start: 40, Order: []string{"created_at desc", "id"}, IdColumn: "id"},
+		},
+		{
+			name:  "limit cut down",
+			query: "limit=1000&start=-1",
+			want:  Query{Limit: 100, IdColumn: "id"},
+		},
+		{
+			name:  "filters",
+			query: "createdAt>=1552896000000&groupId=2&email~=a_b",
+			want: Query{Limit: 10, IdColumn: "id", Filters: []Filter{
+				{Column: "created_at", Op: ">=", Value: "1552896000000"},
+				{Column: "email", Op: "LIKE", Value: `%a\_b%`},
+				{Column: "group_id", Op: "=", Value: "2"},
+			}},
+		},
+		{
+			name:  "plain parameter",
+			query: "deleted=true",
+			want:  Query{Limit: 10, IdColumn: "id"},
+		},
+		{
+			name:  "cursor",
+			query: "cursor=" + EncodeCursor(42) + "&sort=-id&start=5",
+			want:  Query{Limit: 10, Order: []string{"id desc"}, UseCursor: true, Cursor: 42, Desc: true, IdColumn: "id"},
+		},
+		{
+			name:  "first cursor page",
+			query: "cursor=",
+			order: "email",
+			want:  Query{Limit: 10, Order: []string{"id"}, UseCursor: true, IdColumn: "id"},
+		},
+		{name: "unknown sort", query: "sort=password", err: true},
+		{name: "cursor sorted by other field", query: "cursor=&sort=email", err: true},
+		{name: "invalid cursor", query: "cursor=!", err: true},
+		{name: "unknown filter", query: "password~=a", err: true},
+		{name: "invalid filter", query: "createdAt>1=2", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/list?"+tt.query, nil)
+
+			q, err := GetQuery(c, testFields, tt.order)
+			if (err != nil) != tt.err {
+				t.Fatalf("GetQuery() error = %v, want error %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			// filters come in the random order of the query map
+			sort.Slice(q.Filters, func(i, j int) bool {
+				return q.Filters[i].Column < q.Filters[j].Column
+			})
+			if !reflect.DeepEqual(q, tt.want) {
+				t.Errorf("GetQuery() = %+v, want %+v", q, tt.want)
+			}
+		})
+	}
+}
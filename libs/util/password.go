@@ -0,0 +1,187 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Chalin-Shi/gout/libs/setting"
+)
+
+// Hasher turns passwords into self-describing encoded hashes
+type Hasher interface {
+	Hash(password string) (string, error)
+	Verify(password string, encoded string) (bool, error)
+	// NeedsRehash reports whether encoded was produced with other parameters
+	NeedsRehash(encoded string) bool
+}
+
+var (
+	hashers = make(map[string]Hasher)
+
+	legacyHash = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+	ErrInvalidHash = errors.New("invalid password hash")
+)
+
+func init() {
+	RegisterHasher("argon2id", &Argon2idHasher{
+		Memory:  setting.Argon2Memory,
+		Time:    setting.Argon2Time,
+		Threads: setting.Argon2Threads,
+		SaltLen: 16,
+		KeyLen:  32,
+	})
+	RegisterHasher("bcrypt", &BcryptHasher{Cost: setting.BcryptCost})
+}
+
+// RegisterHasher makes a hasher available under the id used in [password] HASHER
+func RegisterHasher(id string, hasher Hasher) {
+	hashers[id] = hasher
+}
+
+// HashPassword hashes with the configured hasher
+func HashPassword(password string) (string, error) {
+	hasher, ok := hashers[setting.PasswordHasher]
+	if !ok {
+		return "", fmt.Errorf("unknown password hasher %q", setting.PasswordHasher)
+	}
+	return hasher.Hash(password)
+}
+
+// VerifyPassword checks password against any supported encoding, rehash is
+// true when the stored hash should be upgraded to the configured hasher
+func VerifyPassword(password string, encoded string) (ok bool, rehash bool) {
+	id := identifyHash(encoded)
+	if id == "sha256" {
+		legacy := Encrypt(password, "sha256")
+		ok = subtle.ConstantTimeCompare([]byte(legacy), []byte(encoded)) == 1
+		return ok, ok
+	}
+
+	hasher, found := hashers[id]
+	if !found {
+		return false, false
+	}
+	ok, err := hasher.Verify(password, encoded)
+	if err != nil || !ok {
+		return false, false
+	}
+	return true, id != setting.PasswordHasher || hasher.NeedsRehash(encoded)
+}
+
+func identifyHash(encoded string) string {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return "argon2id"
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return "bcrypt"
+	case legacyHash.MatchString(encoded):
+		return "sha256"
+	}
+	return ""
+}
+
+// Argon2idHasher encodes hashes in the PHC string format,
+// $argon2id$v=19$m=65536,t=1,p=4$<salt>$<key>
+type Argon2idHasher struct {
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+
+	b64 := base64.RawStdEncoding
+	encoded := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Time, h.Threads, b64.EncodeToString(salt), b64.EncodeToString(key))
+	return encoded, nil
+}
+
+func (h *Argon2idHasher) Verify(password string, encoded string) (bool, error) {
+	p, err := decodeArgon2(encoded)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey([]byte(password), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+	return subtle.ConstantTimeCompare(key, p.key) == 1, nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	p, err := decodeArgon2(encoded)
+	if err != nil {
+		return true
+	}
+	return p.memory != h.Memory || p.time != h.Time || p.threads != h.Threads || uint32(len(p.key)) != h.KeyLen
+}
+
+func decodeArgon2(encoded string) (*argon2Params, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, ErrInvalidHash
+	}
+
+	p := &argon2Params{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return nil, ErrInvalidHash
+	}
+
+	var err error
+	b64 := base64.RawStdEncoding
+	if p.salt, err = b64.DecodeString(parts[4]); err != nil {
+		return nil, ErrInvalidHash
+	}
+	if p.key, err = b64.DecodeString(parts[5]); err != nil {
+		return nil, ErrInvalidHash
+	}
+	return p, nil
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(b), err
+}
+
+func (h *BcryptHasher) Verify(password string, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
+}
@@ -0,0 +1,214 @@
+package util
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// PolicySet holds casbin rules by section, rules keep the field order of
+// conf/authz.conf, so a p rule is sub, dom, obj, act and a g rule is
+// sub, role, dom
+type PolicySet struct {
+	P [][]string `yaml:"p" json:"p"`
+	G [][]string `yaml:"g" json:"g"`
+}
+
+var ErrPolicyFormat = errors.New("unknown policy format, use csv or yaml")
+
+// ParsePolicy reads a policy file in the casbin csv format, lines like
+// "p, g_1, o_1, /api/users/:id, GET", or in yaml with p and g lists
+func ParsePolicy(format string, data []byte) (PolicySet, error) {
+	var set PolicySet
+	switch format {
+	case "csv":
+		reader := csv.NewReader(bytes.NewReader(data))
+		reader.Comment = '#'
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return set, err
+			}
+			if err := set.add(record[0], record[1:]); err != nil {
+				return set, err
+			}
+		}
+	case "yaml":
+		var file PolicySet
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return set, err
+		}
+		for _, rule := range file.P {
+			if err := set.add("p", rule); err != nil {
+				return set, err
+			}
+		}
+		for _, rule := range file.G {
+			if err := set.add("g", rule); err != nil {
+				return set, err
+			}
+		}
+	default:
+		return set, ErrPolicyFormat
+	}
+	return set, nil
+}
+
+// MarshalPolicy writes set in the given format, sorted so exports of the
+// same policy are identical
+func MarshalPolicy(format string, set PolicySet) ([]byte, error) {
+	set = set.sorted()
+	switch format {
+	case "csv":
+		var buf bytes.Buffer
+		writer := csv.NewWriter(&buf)
+		for _, rule := range set.P {
+			writer.Write(append([]string{"p"}, rule...))
+		}
+		for _, rule := range set.G {
+			writer.Write(append([]string{"g"}, rule...))
+		}
+		writer.Flush()
+		return buf.Bytes(), writer.Error()
+	case "yaml":
+		// one rule per line reads and diffs better than yaml's block lists
+		var buf bytes.Buffer
+		for _, section := range []struct {
+			name  string
+			rules [][]string
+		}{{"p", set.P}, {"g", set.G}} {
+			if len(section.rules) == 0 {
+				fmt.Fprintf(&buf, "%s: []\n", section.name)
+				continue
+			}
+			fmt.Fprintf(&buf, "%s:\n", section.name)
+			for _, rule := range section.rules {
+				line, err := yaml.Marshal(struct {
+					Rule []string `yaml:"rule,flow"`
+				}{rule})
+				if err != nil {
+					return nil, err
+				}
+				fmt.Fprintf(&buf, "- %s", strings.TrimPrefix(string(line), "rule: "))
+			}
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, ErrPolicyFormat
+}
+
+// PolicyFormat guesses the format from a file name or content type
+func PolicyFormat(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, "csv"):
+		return "csv"
+	case strings.HasSuffix(name, "yaml"), strings.HasSuffix(name, "yml"):
+		return "yaml"
+	}
+	return ""
+}
+
+// DiffPolicy returns the rules to add and to remove to get from current to
+// desired. In merge mode nothing is removed.
+func DiffPolicy(current PolicySet, desired PolicySet, replace bool) (added PolicySet, removed PolicySet) {
+	added.P, removed.P = diffRules(current.P, desired.P, replace)
+	added.G, removed.G = diffRules(current.G, desired.G, replace)
+	return added.sorted(), removed.sorted()
+}
+
+// InDomain reports whether every rule of the set belongs to domain
+func (s PolicySet) InDomain(domain string) bool {
+	for _, rule := range s.P {
+		if rule[1] != domain {
+			return false
+		}
+	}
+	for _, rule := range s.G {
+		if rule[2] != domain {
+			return false
+		}
+	}
+	return true
+}
+
+// Len counts the rules of the set
+func (s PolicySet) Len() int {
+	return len(s.P) + len(s.G)
+}
+
+func (s *PolicySet) add(ptype string, rule []string) error {
+	values := make([]string, len(rule))
+	for i, v := range rule {
+		values[i] = strings.TrimSpace(v)
+		if values[i] == "" {
+			return fmt.Errorf("empty field in %s rule %v", ptype, rule)
+		}
+	}
+	switch ptype {
+	case "p":
+		if len(values) != 4 {
+			return fmt.Errorf("p rule needs sub, dom, obj, act, got %v", rule)
+		}
+		s.P = append(s.P, values)
+	case "g":
+		if len(values) != 3 {
+			return fmt.Errorf("g rule needs sub, role, dom, got %v", rule)
+		}
+		s.G = append(s.G, values)
+	default:
+		return fmt.Errorf("unknown rule type %q", ptype)
+	}
+	return nil
+}
+
+func (s PolicySet) sorted() PolicySet {
+	return PolicySet{P: sortRules(s.P), G: sortRules(s.G)}
+}
+
+func diffRules(current [][]string, desired [][]string, replace bool) (added [][]string, removed [][]string) {
+	have := make(map[string]bool, len(current))
+	for _, rule := range current {
+		have[ruleKey(rule)] = true
+	}
+	want := make(map[string]bool, len(desired))
+	for _, rule := range desired {
+		key := ruleKey(rule)
+		if !have[key] && !want[key] {
+			added = append(added, rule)
+		}
+		want[key] = true
+	}
+	if replace {
+		for _, rule := range current {
+			if !want[ruleKey(rule)] {
+				removed = append(removed, rule)
+			}
+		}
+	}
+	return
+}
+
+func sortRules(rules [][]string) [][]string {
+	sorted := make([][]string, len(rules))
+	copy(sorted, rules)
+	sort.Slice(sorted, func(i, j int) bool {
+		return ruleKey(sorted[i]) < ruleKey(sorted[j])
+	})
+	return sorted
+}
+
+func ruleKey(rule []string) string {
+	return strings.Join(rule, "\x00")
+}
@@ -0,0 +1,72 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+// secret of RFC 6238 appendix B, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// the last six digits of the SHA1 codes of RFC 6238 appendix B
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := TOTPCode(rfcSecret, tt.unix/totpPeriod)
+		if err != nil {
+			t.Fatalf("TOTPCode(%d) error = %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		want   int64
+		ok     bool
+	}{
+		{name: "current step", secret: rfcSecret, code: "050471", want: current, ok: true},
+		{name: "lowercase secret", secret: "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", code: "050471", want: current, ok: true},
+		{name: "previous step", secret: rfcSecret, code: totpAt(t, current-1), want: current - 1, ok: true},
+		{name: "next step", secret: rfcSecret, code: totpAt(t, current+1), want: current + 1, ok: true},
+		{name: "outside the skew", secret: rfcSecret, code: totpAt(t, current-2)},
+		{name: "wrong code", secret: rfcSecret, code: "000000"},
+		{name: "invalid secret", secret: "not base32!", code: "050471"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter, ok := ValidateTOTP(tt.secret, tt.code, now)
+			if ok != tt.ok || counter != tt.want {
+				t.Errorf("ValidateTOTP() = %d, %v, want %d, %v", counter, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func totpAt(t *testing.T, counter int64) string {
+	code, err := TOTPCode(rfcSecret, counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
@@ -3,39 +3,52 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
 	"syscall"
 
 	"github.com/fvbock/endless"
-	"github.com/robfig/cron"
 
 	"github.com/Chalin-Shi/gout/libs/setting"
+	"github.com/Chalin-Shi/gout/libs/util"
+	"github.com/Chalin-Shi/gout/middlewares"
+	"github.com/Chalin-Shi/gout/models"
 	"github.com/Chalin-Shi/gout/routers"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "policy" {
+		if err := runPolicyCommand(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if err := util.InitKeySet(models.SigningKeyStore{}); err != nil {
+		log.Fatalf("Fail to init signing keys: %v", err)
+	}
+	util.StartKeyRotation()
+	middlewares.InitEnforcer()
+	// the router sets the default group permissions the ldap sync grants
+	router := routers.InitRouter()
+	util.StartLdapSync(models.SyncLdapGroups)
+
 	endless.DefaultReadTimeOut = setting.ReadTimeout
 	endless.DefaultWriteTimeOut = setting.WriteTimeout
 	endless.DefaultMaxHeaderBytes = 1 << 20
 	endPoint := fmt.Sprintf(":%d", setting.Port)
 
-	server := endless.NewServer(endPoint, routers.InitRouter())
+	scheduler, err := startScheduler()
+	if err != nil {
+		log.Fatalf("Fail to start scheduler: %v", err)
+	}
+	defer scheduler.Stop()
+
+	server := endless.NewServer(endPoint, router)
 	server.BeforeBegin = func(add string) {
 		log.Printf("Actual pid is %d", syscall.Getpid())
 	}
 
-	err := server.ListenAndServe()
-	if err != nil {
+	if err := server.ListenAndServe(); err != nil {
 		log.Printf("Server err: %v", err)
 	}
-
-	c := cron.New()
-	spec := "*/5 * * * * ?"
-	i := 0
-	c.AddFunc(spec, func() {
-		i++
-		log.Println("cron running:", i)
-	})
-	c.Start()
-
-	select {}
 }
@@ -1,27 +1,28 @@
 package middlewares
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 
 	"github.com/casbin/casbin"
-	"github.com/casbin/gorm-adapter"
+	"github.com/casbin/casbin/util"
 	"github.com/gin-gonic/gin"
-	_ "github.com/go-sql-driver/mysql"
 
 	"github.com/Chalin-Shi/gout/libs/e"
-	"github.com/Chalin-Shi/gout/libs/setting"
 	"github.com/Chalin-Shi/gout/models"
 )
 
 // NewAuthorizer returns the authorizer, uses a Casbin enforcer as input
 func Authz() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		adapter := gormadapter.NewAdapter(setting.DBType, setting.DBLink, true)
-		enforcer := casbin.NewEnforcer("conf/authz.conf", adapter)
 		authorizer := &BasicAuthorizer{enforcer}
 
-		if !authorizer.CheckPermission(c) {
+		if !authorizer.CheckScopes(c) || !authorizer.CheckPermission(c) {
+			authorizer.RequirePermission(c)
+		} else if code := authorizer.CheckOwnership(c); code == e.RECORD_NOT_EXIST {
+			authorizer.RequireRecord(c)
+		} else if code != e.SUCCESS {
 			authorizer.RequirePermission(c)
 		}
 		c.Set("Enforcer", enforcer)
@@ -29,9 +30,31 @@ func Authz() gin.HandlerFunc {
 	}
 }
 
+// Allowed reports whether the policies allow the caller of c a request to
+// path and method in the organization of c, for handlers that show more to
+// callers who may do more
+func Allowed(c *gin.Context, path string, method string) bool {
+	authorizer := &BasicAuthorizer{enforcer}
+	maid := c.GetStringMap("Maid")
+	org := maid["Org"].(models.Organization)
+	return Enforce(authorizer.GetUserAuthe(c), models.OrgDomain(org.ID), path, method)
+}
+
+// CanSeeUnpublished reports whether the caller may see the posts of the user
+// that are not published: the author and whoever may approve its posts
+func CanSeeUnpublished(c *gin.Context, userId int) bool {
+	maid := c.GetStringMap("Maid")
+	user := maid["User"].(models.User)
+	if user.ID == userId || user.Username == "root" {
+		return true
+	}
+	// policies are written per route, any post id stands for all of them
+	return Allowed(c, fmt.Sprintf("/api/users/%d/posts/0/approve", userId), "POST")
+}
+
 // BasicAuthorizer stores the casbin handler
 type BasicAuthorizer struct {
-	enforcer *casbin.Enforcer
+	enforcer *casbin.SyncedEnforcer
 }
 
 // GetUserName gets the user name from the request.
@@ -46,13 +69,47 @@ func (a *BasicAuthorizer) GetUserAuthe(c *gin.Context) string {
 	return authe
 }
 
-// CheckPermission checks the user/method/path combination from the request.
+// CheckPermission checks the user/method/path combination from the request
+// within the domain of the request's organization.
 // Returns true (permission granted) or false (permission forbidden)
 func (a *BasicAuthorizer) CheckPermission(c *gin.Context) bool {
 	authe := a.GetUserAuthe(c)
+	maid := c.GetStringMap("Maid")
+	org := maid["Org"].(models.Organization)
+	method := c.Request.Method
+	path := c.Request.URL.Path
+	return Enforce(authe, models.OrgDomain(org.ID), path, method)
+}
+
+// CheckOwnership checks the ownership rules declared with Own, so a policy
+// allowing a path does not open the records of other users
+func (a *BasicAuthorizer) CheckOwnership(c *gin.Context) string {
+	maid := c.GetStringMap("Maid")
+	user := maid["User"].(models.User)
+	return checkOwnership(user, c.Request.URL.Path, c.Request.Method)
+}
+
+// CheckScopes narrows requests made with a personal access token to its
+// scopes, on top of what the casbin policies allow the token's user
+func (a *BasicAuthorizer) CheckScopes(c *gin.Context) bool {
+	maid := c.GetStringMap("Maid")
+	accessToken, ok := maid["AccessToken"].(models.AccessToken)
+	if !ok {
+		return true
+	}
+
+	var scopes []models.Scope
+	if err := json.Unmarshal(accessToken.Scopes, &scopes); err != nil {
+		return false
+	}
 	method := c.Request.Method
 	path := c.Request.URL.Path
-	return a.enforcer.Enforce(authe, path, method)
+	for _, scope := range scopes {
+		if util.KeyMatch2(path, scope.Path) && util.RegexMatch(method, scope.Method) {
+			return true
+		}
+	}
+	return false
 }
 
 // RequirePermission returns the 403 Forbidden to the client
@@ -64,3 +121,13 @@ func (a *BasicAuthorizer) RequirePermission(c *gin.Context) {
 	c.Abort()
 	return
 }
+
+// RequireRecord returns the 404 Not Found to the client, the record an
+// ownership rule looked for does not exist
+func (a *BasicAuthorizer) RequireRecord(c *gin.Context) {
+	c.JSON(http.StatusNotFound, gin.H{
+		"status":  e.RECORD_NOT_EXIST,
+		"message": e.GetMsg(e.RECORD_NOT_EXIST),
+	})
+	c.Abort()
+}
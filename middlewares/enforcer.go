@@ -0,0 +1,139 @@
+package middlewares
+
+import (
+	"sync"
+	"time"
+
+	"github.com/casbin/casbin"
+	"github.com/casbin/gorm-adapter"
+	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/Chalin-Shi/gout/libs/logging"
+	"github.com/Chalin-Shi/gout/libs/setting"
+	"github.com/Chalin-Shi/gout/models"
+)
+
+var (
+	enforcer  *casbin.SyncedEnforcer
+	decisions = &decisionCache{entries: make(map[string]bool)}
+)
+
+// InitEnforcer builds the enforcer shared by all requests, and starts
+// watching for policy changes made by other instances
+func InitEnforcer() {
+	adapter := gormadapter.NewAdapter(setting.DBType, setting.DBLink, true)
+	enforcer = casbin.NewSyncedEnforcer("conf/authz.conf", adapter)
+
+	watcher := &PolicyWatcher{revision: models.GetPolicyRevision()}
+	enforcer.SetWatcher(watcher)
+	watcher.SetUpdateCallback(func(string) {
+		if err := ReloadPolicy(); err != nil {
+			logging.Error("reload policy", err)
+		}
+	})
+	watcher.Start(setting.AuthzPollInterval)
+}
+
+// Enforcer returns the shared enforcer, policy changes made through it are
+// propagated to the other instances
+func Enforcer() *casbin.SyncedEnforcer {
+	return enforcer
+}
+
+// ReloadPolicy drops the in-memory policy and decisions after the casbin
+// table was changed behind the enforcer's back
+func ReloadPolicy() error {
+	defer decisions.clear()
+	return enforcer.LoadPolicy()
+}
+
+// Enforce answers from the decision cache when it can
+func Enforce(sub string, dom string, obj string, act string) bool {
+	key := sub + "\x00" + dom + "\x00" + obj + "\x00" + act
+	allowed, ok, generation := decisions.get(key)
+	if ok {
+		return allowed
+	}
+	allowed = enforcer.Enforce(sub, dom, obj, act)
+	decisions.set(key, allowed, generation)
+	return allowed
+}
+
+// decisionCache remembers enforce results until the policy changes, the
+// generation keeps a decision made on the old policy from being stored
+// after the cache was cleared
+type decisionCache struct {
+	mu         sync.RWMutex
+	entries    map[string]bool
+	generation uint64
+}
+
+func (d *decisionCache) get(key string) (bool, bool, uint64) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	allowed, ok := d.entries[key]
+	return allowed, ok, d.generation
+}
+
+func (d *decisionCache) set(key string, allowed bool, generation uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if generation != d.generation {
+		return
+	}
+	if len(d.entries) >= setting.AuthzCacheSize {
+		d.entries = make(map[string]bool)
+	}
+	d.entries[key] = allowed
+}
+
+func (d *decisionCache) clear() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries = make(map[string]bool)
+	d.generation++
+}
+
+// PolicyWatcher is a casbin watcher polling the policy revision kept in the
+// database, every policy write bumps it
+type PolicyWatcher struct {
+	mu       sync.Mutex
+	revision int64
+	callback func(string)
+}
+
+func (w *PolicyWatcher) SetUpdateCallback(callback func(string)) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.callback = callback
+	return nil
+}
+
+// Update is called by the enforcer after it changed the policy, our own
+// instance already has the change so only the cache is dropped here
+func (w *PolicyWatcher) Update() error {
+	decisions.clear()
+	if !models.BumpPolicyRevision() {
+		logging.Error("bump policy revision")
+	}
+	return nil
+}
+
+// Start polls the revision every interval and reloads when it moved
+func (w *PolicyWatcher) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			revision := models.GetPolicyRevision()
+			w.mu.Lock()
+			changed := revision != w.revision
+			w.revision = revision
+			callback := w.callback
+			w.mu.Unlock()
+			if changed && callback != nil {
+				callback("")
+			}
+		}
+	}()
+}
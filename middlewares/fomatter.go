@@ -7,9 +7,15 @@ import (
 	"github.com/Chalin-Shi/gout/libs/e"
 )
 
+// Formatter writes the response a handler set, with the HTTP status in its
+// httpStatus when the handler set one. Not modified responses have no body.
 func Formatter() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Next()
+		// handlers sending files write their own body
+		if c.Writer.Written() {
+			return
+		}
 		response := c.GetStringMap("response")
 		if len(response) == 0 {
 			c.JSON(http.StatusNotFound, gin.H{})
@@ -19,8 +25,16 @@ func Formatter() gin.HandlerFunc {
 		if status == "" {
 			status = e.UNKNOW_ERROR
 		}
+		httpStatus := http.StatusOK
+		if s, ok := response["httpStatus"].(int); ok {
+			httpStatus = s
+		}
+		if httpStatus == http.StatusNotModified {
+			c.Status(httpStatus)
+			return
+		}
 		data := response["data"]
-		c.JSON(http.StatusOK, gin.H{
+		c.JSON(httpStatus, gin.H{
 			"status":  status,
 			"data":    data,
 			"message": e.GetMsg(status),
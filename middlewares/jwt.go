@@ -3,11 +3,11 @@ package middlewares
 import (
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/Chalin-Shi/gout/libs/e"
-	"github.com/Chalin-Shi/gout/libs/setting"
 	"github.com/Chalin-Shi/gout/libs/util"
 	"github.com/Chalin-Shi/gout/models"
 )
@@ -37,22 +37,86 @@ func JWT() gin.HandlerFunc {
 			return
 		}
 
-		claims, err := util.ParseToken(t[1], setting.Secret)
-		if err != nil {
-			code = e.ERROR_AUTH_CHECK_TOKEN_EXPIRED
-			return
+		var id int
+		maid := make(map[string]interface{})
+		if strings.HasPrefix(t[1], util.AccessTokenPrefix) {
+			accessToken := models.GetAccessTokenByHash(util.HashToken(t[1]))
+			if accessToken.ID == 0 || accessToken.RevokedAt != 0 {
+				code = e.ERROR_AUTH_CHECK_TOKEN_FAIL
+				return
+			}
+			if accessToken.ExpiresAt < time.Now().UnixNano()/1000000 {
+				code = e.ERROR_AUTH_CHECK_TOKEN_EXPIRED
+				return
+			}
+			models.TouchAccessToken(accessToken.ID)
+			id = accessToken.UserId
+			maid["AccessToken"] = accessToken
+		} else {
+			claims, err := util.ParseToken(t[1])
+			// the half-way tokens of a login waiting for MFA are not accepted
+			if err == util.ErrTokenAudience {
+				code = e.ERROR_AUTH_CHECK_TOKEN_FAIL
+				return
+			}
+			if err != nil {
+				code = e.ERROR_AUTH_CHECK_TOKEN_EXPIRED
+				return
+			}
+			// tokens without a jti can't be revoked, so they are not accepted
+			if claims.Id == "" {
+				code = e.ERROR_AUTH_CHECK_TOKEN_FAIL
+				return
+			}
+			if models.ExistRevokedToken(claims.Id) {
+				code = e.ERROR_AUTH_TOKEN_REVOKED
+				return
+			}
+			// sessions are ended on logout, by the user from another device or
+			// by an admin, the access tokens of the session die with it
+			session := models.GetSessionByFamily(claims.Family)
+			if session.EndedAt != 0 {
+				code = e.ERROR_AUTH_TOKEN_REVOKED
+				return
+			}
+			if session.ID > 0 {
+				models.TouchSession(session.ID)
+				maid["Session"] = session
+			}
+			id = claims.ID
+			maid["Claims"] = claims
 		}
 
-		id := claims.ID
-		if !models.ExistUserByID(id) {
+		user := models.GetUser(id)
+		if user.ID == 0 {
 			code = e.RECORD_NOT_EXIST
 			return
 		}
-		user := models.GetUser(id)
-		maid := map[string]interface{}{"User": user}
+		if user.Disabled {
+			code = e.ERROR_AUTH_USER_DISABLED
+			return
+		}
+		maid["User"] = user
 		c.Set("Maid", maid)
 		code = e.SUCCESS
 
 		c.Next()
 	}
 }
+
+// RequireSession refuses personal access tokens on routes meant for
+// interactive logins, like managing the tokens themselves
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		maid := c.GetStringMap("Maid")
+		if _, ok := maid["Claims"]; !ok {
+			c.JSON(http.StatusForbidden, gin.H{
+				"status":  e.PERMISSION_DENIED,
+				"message": e.GetMsg(e.PERMISSION_DENIED),
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
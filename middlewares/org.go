@@ -0,0 +1,58 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/Unknwon/com"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Chalin-Shi/gout/libs/e"
+	"github.com/Chalin-Shi/gout/models"
+)
+
+// OrgHeader selects the organization a request acts in
+const OrgHeader = "X-Org-Id"
+
+// Org resolves the organization of a request: the X-Org-Id header, else the
+// organization a personal access token is bound to, else the organization
+// the user joined first. Users must be members, root may act in any.
+func Org() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		maid := c.GetStringMap("Maid")
+		user := maid["User"].(models.User)
+
+		orgId := com.StrTo(c.GetHeader(OrgHeader)).MustInt()
+		if accessToken, ok := maid["AccessToken"].(models.AccessToken); ok && accessToken.OrgId != 0 {
+			if orgId != 0 && orgId != accessToken.OrgId {
+				denyOrg(c)
+				return
+			}
+			orgId = accessToken.OrgId
+		}
+		if orgId == 0 {
+			if orgs := models.GetUserOrganizations(user.ID); len(orgs) > 0 {
+				orgId = orgs[0].ID
+			} else {
+				orgId = models.DefaultOrgId()
+			}
+		}
+
+		org := models.GetOrganization(orgId)
+		if org.ID == 0 || (user.Username != "root" && !models.IsOrgMember(org.ID, user.ID)) {
+			denyOrg(c)
+			return
+		}
+
+		maid["Org"] = org
+		c.Set("Maid", maid)
+		c.Next()
+	}
+}
+
+func denyOrg(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"status":  e.PERMISSION_DENIED,
+		"message": e.GetMsg(e.PERMISSION_DENIED),
+	})
+	c.Abort()
+}
@@ -0,0 +1,168 @@
+package middlewares
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/casbin/casbin/util"
+	"github.com/gin-gonic/gin"
+)
+
+// Permission is a route behind Authz, the obj and act a policy grants
+type Permission struct {
+	Name   string `json:"name"`
+	Group  string `json:"group"`
+	Desc   string `json:"desc"`
+	Path   string `json:"path"`
+	Method string `json:"method"`
+	// Global routes reach beyond the organization of the request, they are
+	// left to root and policies of an organization can't grant them
+	Global bool `json:"global"`
+}
+
+var (
+	catalog   []Permission
+	catalogMu sync.RWMutex
+)
+
+// globalRoutes are the routes of the catalog that are not scoped to the
+// organization of the request, every other route is
+var globalRoutes = map[string]bool{
+	"GET /api/orgs":               true,
+	"POST /api/orgs":              true,
+	"POST /api/org/members":       true,
+	"DELETE /api/users/:id/purge": true,
+	"POST /api/policy/import":     true,
+}
+
+// SetCatalog publishes routes as the permission catalog, routes also in
+// public are left out since they are not authorized by policies
+func SetCatalog(routes gin.RoutesInfo, public gin.RoutesInfo) {
+	skip := make(map[string]bool, len(public))
+	for _, route := range public {
+		skip[route.Method+" "+route.Path] = true
+	}
+
+	permissions := make([]Permission, 0, len(routes))
+	for _, route := range routes {
+		if skip[route.Method+" "+route.Path] {
+			continue
+		}
+		group, desc := describeHandler(route.Handler)
+		permissions = append(permissions, Permission{
+			Name:   permissionName(route.Method, route.Path),
+			Group:  group,
+			Desc:   desc,
+			Path:   route.Path,
+			Method: route.Method,
+			Global: globalRoutes[route.Method+" "+route.Path],
+		})
+	}
+	sort.Slice(permissions, func(i, j int) bool {
+		if permissions[i].Path != permissions[j].Path {
+			return permissions[i].Path < permissions[j].Path
+		}
+		return permissions[i].Method < permissions[j].Method
+	})
+
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	catalog = permissions
+}
+
+// Catalog returns every permission, sorted by path and method
+func Catalog() []Permission {
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+
+	return catalog
+}
+
+// CatalogCovers reports whether a policy for the path pattern and method
+// regexp would allow at least one route of the catalog
+func CatalogCovers(path string, method string) bool {
+	for _, permission := range Catalog() {
+		if util.KeyMatch2(permission.Path, path) && util.RegexMatch(permission.Method, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// OrgCovers reports whether a policy for the path pattern and method regexp
+// would allow routes of the catalog and only routes scoped to the
+// organization of the request
+func OrgCovers(path string, method string) bool {
+	covers := false
+	for _, permission := range Catalog() {
+		if util.KeyMatch2(permission.Path, path) && util.RegexMatch(permission.Method, method) {
+			if permission.Global {
+				return false
+			}
+			covers = true
+		}
+	}
+	return covers
+}
+
+// LookupPermissions finds permissions of the catalog by name, names not in
+// the catalog are returned as unknown
+func LookupPermissions(names []string) (permissions []Permission, unknown []string) {
+	byName := make(map[string]Permission)
+	for _, permission := range Catalog() {
+		byName[permission.Name] = permission
+	}
+	for _, name := range names {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if permission, ok := byName[name]; ok {
+			permissions = append(permissions, permission)
+		} else {
+			unknown = append(unknown, name)
+		}
+	}
+	return
+}
+
+// permissionName follows the @apiName of the handlers, e.g.
+// GET /api/users/:id/sessions is GET_USERS_ID_SESSIONS
+func permissionName(method string, path string) string {
+	parts := []string{method}
+	for _, segment := range strings.Split(strings.TrimPrefix(path, "/api"), "/") {
+		segment = strings.TrimLeft(segment, ":*")
+		if segment != "" {
+			parts = append(parts, strings.ToUpper(segment))
+		}
+	}
+	return strings.Join(parts, "_")
+}
+
+// describeHandler turns a handler like .../controllers/users.GetUserById
+// into its package users and the description "Get user by id"
+func describeHandler(handler string) (string, string) {
+	handler = strings.TrimSuffix(handler[strings.LastIndex(handler, "/")+1:], "-fm")
+	dot := strings.Index(handler, ".")
+	if dot < 0 {
+		return "", handler
+	}
+	group, name := handler[:dot], handler[dot+1:]
+
+	var words []string
+	start := 0
+	runes := []rune(name)
+	for i := 1; i < len(runes); i++ {
+		if unicode.IsUpper(runes[i]) && !unicode.IsUpper(runes[i-1]) {
+			words = append(words, strings.ToLower(string(runes[start:i])))
+			start = i
+		}
+	}
+	words = append(words, strings.ToLower(string(runes[start:])))
+	if len(words) > 0 && words[0] != "" {
+		words[0] = strings.ToUpper(words[0][:1]) + words[0][1:]
+	}
+	return group, strings.Join(words, " ")
+}
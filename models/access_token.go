@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+)
+
+type AccessToken struct {
+	Model
+	UserId     int    `sql:"not null" gorm:"index" json:"userId"`
+	OrgId      int    `sql:"not null" json:"orgId"`
+	Name       string `sql:"not null" json:"name"`
+	Prefix     string `sql:"not null" json:"prefix"`
+	TokenHash  string `sql:"not null" gorm:"unique_index" json:"-"`
+	Scopes     JSON   `sql:"type:json" json:"scopes"`
+	ExpiresAt  int64  `json:"expiresAt"`
+	LastUsedAt int64  `json:"lastUsedAt"`
+	RevokedAt  int64  `json:"revokedAt"`
+}
+
+// Scope limits a personal access token to the requests matching it, Path
+// and Method are matched like the obj and act of a casbin policy
+type Scope struct {
+	Path   string `json:"path"`
+	Method string `json:"method"`
+}
+
+func ExistAccessTokenByName(userId int, name string) bool {
+	var token AccessToken
+	db.Select("id").Where("user_id = ? AND name = ? AND revoked_at = 0", userId, name).First(&token)
+	if token.ID > 0 {
+		return true
+	}
+
+	return false
+}
+
+func GetAccessTokens(userId int) (tokens []AccessToken) {
+	db.Where("user_id = ? AND revoked_at = 0", userId).Order("created_at desc").Find(&tokens)
+
+	return
+}
+
+func GetAccessTokenByHash(hash string) (token AccessToken) {
+	db.Where("token_hash = ?", hash).First(&token)
+
+	return
+}
+
+func AddAccessToken(token *AccessToken) bool {
+	db.Create(token)
+
+	return true
+}
+
+// TouchAccessToken records the use of a token, at most once a minute so
+// busy clients don't turn every request into a write
+func TouchAccessToken(id int) bool {
+	nowTime := time.Now().UnixNano() / 1000000
+	db.Model(&AccessToken{}).Where("id = ? AND last_used_at < ?", id, nowTime-60*1000).UpdateColumn("last_used_at", nowTime)
+
+	return true
+}
+
+func RevokeAccessToken(userId int, id int) bool {
+	nowTime := time.Now().UnixNano() / 1000000
+	affected := db.Model(&AccessToken{}).Where("id = ? AND user_id = ? AND revoked_at = 0", id, userId).Update("revoked_at", nowTime).RowsAffected
+
+	return affected > 0
+}
@@ -0,0 +1,18 @@
+package models
+
+type Audit struct {
+	Model
+	UserId int    `gorm:"index" json:"userId"`
+	Action string `sql:"not null" gorm:"index" json:"action"`
+	Target string `json:"target"`
+	IP     string `json:"ip"`
+	Detail string `sql:"type:text" json:"detail"`
+}
+
+// AddAudit records a security relevant event, UserId is the acting user
+// and stays 0 for events raised by the system itself
+func AddAudit(audit Audit) bool {
+	db.Create(&audit)
+
+	return true
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"errors"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/Chalin-Shi/gout/libs/util"
+)
+
+var (
+	ErrCategoryCycle = errors.New("category would contain itself")
+	ErrCategoryOrg   = errors.New("categories are in different organizations")
+)
+
+// Category sorts posts of an organization, a post is in one category at
+// most. Names are unique per organization.
+type Category struct {
+	Model
+	OrgId int `sql:"not null" gorm:"unique_index:idx_org_category" json:"orgId"`
+	// ParentId is the category this category is nested in, lists of the
+	// parent include the posts of its subcategories
+	ParentId int    `sql:"not null" gorm:"index" json:"parentId"`
+	Name     string `sql:"not null" gorm:"unique_index:idx_org_category" json:"name"`
+	Desc     string `sql:"not null" json:"desc"`
+}
+
+// CategoryFields are the fields lists of categories are filtered and sorted by
+var CategoryFields = util.Fields{
+	"id":        "id",
+	"name":      "name",
+	"parentId":  "parent_id",
+	"createdAt": "created_at",
+	"updatedAt": "updated_at",
+}
+
+func GetCategories(q util.Query, maps map[string]interface{}) (categories []Category, page util.Pagination, err error) {
+	page, err = paginate(db.Where(maps), q, &categories)
+
+	return
+}
+
+func GetCategory(id int) (category Category) {
+	db.Where("id = ?", id).First(&category)
+
+	return
+}
+
+func GetOrgCategoryIdByName(orgId int, name string) int {
+	var category Category
+	db.Select("id").Where("org_id = ? AND name = ?", orgId, name).First(&category)
+
+	return category.ID
+}
+
+// GetCategoryTree returns the id of a category and the ids of the categories
+// nested in it
+func GetCategoryTree(id int) []int {
+	ids := []int{id}
+	seen := map[int]bool{id: true}
+	for level := []int{id}; len(level) > 0; {
+		var children []int
+		db.Model(&Category{}).Where("parent_id IN (?)", level).Pluck("id", &children)
+		level = nil
+		for _, child := range children {
+			if !seen[child] {
+				seen[child] = true
+				ids = append(ids, child)
+				level = append(level, child)
+			}
+		}
+	}
+
+	return ids
+}
+
+// CreateCategory creates a category, nested into category.ParentId if set
+func CreateCategory(category *Category) error {
+	tx := db.Begin()
+	parentId := category.ParentId
+	category.ParentId = 0
+	if err := tx.Create(category).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if parentId != 0 {
+		if err := setCategoryParent(tx, *category, parentId); err != nil {
+			tx.Rollback()
+			return err
+		}
+		category.ParentId = parentId
+	}
+
+	return tx.Commit().Error
+}
+
+// EditCategory changes the name or description of a category, the posts in
+// it change with it
+func EditCategory(id int, data map[string]interface{}) error {
+	tx := db.Begin()
+	if err := tx.Model(&Category{}).Where("id = ?", id).Updates(data).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := touchCategoryPosts(tx, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// SetCategoryParent nests a category into parentId, 0 makes it a top level
+// category
+func SetCategoryParent(id int, parentId int) error {
+	tx := db.Begin()
+	var category Category
+	tx.Where("id = ?", id).First(&category)
+	if category.ID == 0 {
+		tx.Rollback()
+		return gorm.ErrRecordNotFound
+	}
+	if err := setCategoryParent(tx, category, parentId); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+func setCategoryParent(tx *gorm.DB, category Category, parentId int) error {
+	if parentId != 0 {
+		var parent Category
+		tx.Where("id = ?", parentId).First(&parent)
+		if parent.ID == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if parent.OrgId != category.OrgId {
+			return ErrCategoryOrg
+		}
+		for id := parentId; id != 0; {
+			if id == category.ID {
+				return ErrCategoryCycle
+			}
+			var ancestor Category
+			tx.Select("id, parent_id").Where("id = ?", id).First(&ancestor)
+			id = ancestor.ParentId
+		}
+	}
+
+	return tx.Model(&Category{}).Where("id = ?", category.ID).Updates(map[string]interface{}{"parent_id": parentId}).Error
+}
+
+// DeleteCategory removes a category. Its posts and the categories nested in
+// it move up to its parent.
+func DeleteCategory(id int) error {
+	tx := db.Begin()
+	var category Category
+	tx.Where("id = ?", id).First(&category)
+	if category.ID == 0 {
+		tx.Rollback()
+		return gorm.ErrRecordNotFound
+	}
+
+	if err := touchCategoryPosts(tx, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Model(&Post{}).Where("category_id = ?", id).UpdateColumn("category_id", category.ParentId).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Model(&Category{}).Where("parent_id = ?", id).Updates(map[string]interface{}{"parent_id": category.ParentId}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("id = ?", id).Delete(Category{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// touchCategoryPosts marks the posts in a category as changed
+func touchCategoryPosts(tx *gorm.DB, id int) error {
+	var postIds []int
+	tx.Model(&Post{}).Where("category_id = ?", id).Pluck("id", &postIds)
+
+	return touchPosts(tx, postIds)
+}
@@ -1,11 +1,29 @@
 package models
 
+import (
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/Chalin-Shi/gout/libs/util"
+)
+
 type Group struct {
 	Model
 	Users []User `json:"users,omitempty"`
 
-	Name string `sql:"not null" json:"name"`
-	Desc string `sql:"not null" json:"desc"`
+	OrgId int `sql:"not null" gorm:"index" json:"orgId"`
+	// ParentId is the group this group is nested in, its members inherit
+	// the policies of the parent
+	ParentId   int    `sql:"not null" gorm:"index" json:"parentId"`
+	Name       string `sql:"not null" json:"name"`
+	Desc       string `sql:"not null" json:"desc"`
+	RequireMfa bool   `json:"requireMfa"`
+	// LdapDn is set on groups mirrored from the directory
+	LdapDn string `gorm:"index" json:"ldapDn,omitempty"`
+	// Version counts the changes of the group, its ETag and the condition
+	// of conditional changes, see updateIfUnmodified
+	Version int `sql:"not null;default:1" json:"-"`
 }
 
 func ExistGroupByID(id int) bool {
@@ -35,14 +53,39 @@ func GetGroupIdByName(name string) int {
 	return 0
 }
 
+func GetOrgGroupIdByName(orgId int, name string) int {
+	var group Group
+	db.Select("id").Where("org_id = ? AND name = ?", orgId, name).First(&group)
+
+	return group.ID
+}
+
+// GroupRequiresMfa reports whether direct members of the group must use MFA
+func GroupRequiresMfa(id int) bool {
+	var group Group
+	db.Select("id, require_mfa").Where("id = ?", id).First(&group)
+
+	return group.RequireMfa
+}
+
 func GetGroupTotal(maps interface{}) (count int) {
 	db.Model(&Group{}).Where(maps).Count(&count)
 
 	return
 }
 
-func GetGroups(limit int, offset int, maps map[string]interface{}) (groups []Group) {
-	db.Where(maps).Order("updated_at desc").Limit(limit).Offset(offset).Find(&groups)
+// GroupFields are the fields lists of groups are filtered and sorted by
+var GroupFields = util.Fields{
+	"id":         "id",
+	"name":       "name",
+	"parentId":   "parent_id",
+	"requireMfa": "require_mfa",
+	"createdAt":  "created_at",
+	"updatedAt":  "updated_at",
+}
+
+func GetGroups(q util.Query, maps map[string]interface{}) (groups []Group, page util.Pagination, err error) {
+	page, err = paginate(db.Where(maps), q, &groups)
 
 	return
 }
@@ -59,33 +102,137 @@ func EditGroup(id int, data interface{}) bool {
 	return true
 }
 
+// EditGroupIfUnmodified changes a group unless it was changed since its
+// version, see updateIfUnmodified
+func EditGroupIfUnmodified(id int, version int, data map[string]interface{}) error {
+	return updateIfUnmodified(db, &Group{}, id, version, data)
+}
+
 func EditGroupByAttr(id int, name string, data interface{}) bool {
 	db.Model(&Group{}).Where("id = ?", id).Update(name, data)
 
 	return true
 }
 
+// AddGroup creates a group with the default group permissions
 func AddGroup(group Group) bool {
-	db.Create(&group)
-
-	return true
+	return CreateGroup(&group) == nil
 }
 
-func DeleteGroup(id int) bool {
-	db.Where("id = ?", id).Delete(Group{})
+// CreateGroup creates a group with the default group permissions, nested
+// into group.ParentId if set
+func CreateGroup(group *Group) error {
+	parentId := group.ParentId
+	group.ParentId = 0
 
-	return true
+	tx := db.Begin()
+	if err := tx.Create(group).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := grantDefaultPermissions(tx, *group); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if parentId != 0 {
+		if err := setGroupParent(tx, *group, parentId); err != nil {
+			tx.Rollback()
+			return err
+		}
+		group.ParentId = parentId
+	}
+	if err := bumpPolicyRevision(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
 }
 
-func GetGroupUsers(id int) (group Group) {
-	db.Where("id = ?", id).First(&group)
-	db.Model(&group).Related(&group.Users)
+// DeleteGroup removes a group with its policies. Its members move to the
+// group reassign, or just leave it when reassign is 0. Groups nested in it
+// move up to its parent. The group is only deleted while its version is
+// still version, 0 deletes anyway.
+func DeleteGroup(id int, reassign int, version int) error {
+	tx := db.Begin()
+	var group Group
+	tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", id).First(&group)
+	if group.ID == 0 {
+		tx.Rollback()
+		return gorm.ErrRecordNotFound
+	}
+	if version != 0 && group.Version != version {
+		tx.Rollback()
+		return ErrModified
+	}
 
-	return
+	var members []int
+	tx.Model(&UserGroup{}).Where("group_id = ?", id).Order("user_id").Pluck("user_id", &members)
+	if reassign != 0 {
+		var target Group
+		tx.Select("id, org_id").Where("id = ?", reassign).First(&target)
+		if target.ID == 0 || target.ID == id {
+			tx.Rollback()
+			return gorm.ErrRecordNotFound
+		}
+		if target.OrgId != group.OrgId {
+			tx.Rollback()
+			return ErrGroupOrg
+		}
+		for _, userId := range members {
+			if err := addUserGroup(tx, userId, reassign); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		if len(members) > 0 {
+			if err := tx.Model(&User{}).Where("id IN (?) AND group_id = ?", members, id).Updates(map[string]interface{}{"group_id": reassign}).Error; err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+	for _, userId := range members {
+		if err := removeUserGroup(tx, userId, id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	var children []Group
+	tx.Where("parent_id = ?", id).Find(&children)
+	for _, child := range children {
+		if err := setGroupParent(tx, child, group.ParentId); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// whatever is left of the group in casbin: its own parent link, its
+	// policies, and links made outside of gout
+	role := fmt.Sprintf("g_%d", id)
+	if err := tx.Where("(p_type = 'p' AND v0 = ?) OR (p_type = 'g' AND (v0 = ? OR v1 = ?))", role, role, role).Delete(CasbinRule{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("id = ?", id).Delete(Group{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := bumpPolicyRevision(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
 }
 
-func GetGroupUser(id int, username string) (group Group) {
-	db.Where("id = ?", id).Preload("Users", "group_id = ? and username = ?", id, username).First(&group)
+// GetGroupUsers returns the direct members of a group
+func GetGroupUsers(id int, q util.Query) (users []User, page util.Pagination, err error) {
+	tx := db.Select(userListColumns).
+		Joins("JOIN user_groups ON user_groups.user_id = users.id").
+		Where("user_groups.group_id = ?", id)
+	page, err = paginate(tx, q, &users)
 
 	return
 }
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"sort"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/Chalin-Shi/gout/libs/util"
+)
+
+// SyncLdapGroups mirrors directory groups into groups and their members.
+// Groups are matched by DN, a local group with the same name is taken over
+// on the first sync. Members of groups gone from the directory are dropped,
+// the groups themselves are kept since policies may still refer to them. New
+// groups are created in the default organization with the default group
+// permissions, members join the organization of their group. Directory users
+// without a local account join on the sync after their first login.
+func SyncLdapGroups(groups []util.LdapGroup) error {
+	defaultOrgId := DefaultOrgId()
+	tx := db.Begin()
+
+	seen := make(map[int]bool)
+	members := make(map[int]map[int]bool)
+	for _, entry := range groups {
+		var group Group
+		tx.Where("ldap_dn = ?", entry.DN).First(&group)
+		if group.ID == 0 {
+			tx.Where("name = ? AND (ldap_dn = '' OR ldap_dn IS NULL)", entry.Name).First(&group)
+		}
+		group.Name = entry.Name
+		group.Desc = entry.Desc
+		group.LdapDn = entry.DN
+		if group.OrgId == 0 {
+			group.OrgId = defaultOrgId
+		}
+		created := group.ID == 0
+		if err := tx.Save(&group).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		if created {
+			if err := grantDefaultPermissions(tx, group); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		seen[group.ID] = true
+
+		ids := make(map[int]bool)
+		if len(entry.Members) > 0 {
+			var users []User
+			tx.Select("id").Where("email IN (?) AND username <> 'root'", entry.Members).Find(&users)
+			for _, user := range users {
+				ids[user.ID] = true
+			}
+		}
+		members[group.ID] = ids
+	}
+
+	var managed []Group
+	tx.Select("id").Where("ldap_dn <> ''").Find(&managed)
+	for _, group := range managed {
+		if !seen[group.ID] {
+			members[group.ID] = map[int]bool{}
+		}
+	}
+
+	groupIds := make([]int, 0, len(members))
+	for groupId := range members {
+		groupIds = append(groupIds, groupId)
+	}
+	sort.Ints(groupIds)
+	for _, groupId := range groupIds {
+		if err := syncGroupMembers(tx, groupId, members[groupId]); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := bumpPolicyRevision(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// syncGroupMembers makes ids the direct members of a group
+func syncGroupMembers(tx *gorm.DB, groupId int, ids map[int]bool) error {
+	var current []int
+	tx.Model(&UserGroup{}).Where("group_id = ?", groupId).Pluck("user_id", &current)
+	have := make(map[int]bool, len(current))
+	for _, id := range current {
+		have[id] = true
+		if ids[id] {
+			continue
+		}
+		if err := removeUserGroup(tx, id, groupId); err != nil {
+			return err
+		}
+	}
+
+	added := make([]int, 0, len(ids))
+	for id := range ids {
+		if !have[id] {
+			added = append(added, id)
+		}
+	}
+	sort.Ints(added)
+	for _, id := range added {
+		if err := addUserGroup(tx, id, groupId); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// LoginFailure counts the failed logins of a source, which is either an
+// account ("email:<email>") or a client ("ip:<ip>")
+type LoginFailure struct {
+	Model
+	Source       string `sql:"not null" gorm:"unique_index" json:"source"`
+	Failures     int    `json:"failures"`
+	LastFailedAt int64  `json:"lastFailedAt"`
+	LockedUntil  int64  `json:"lockedUntil"`
+	// LastIP is the client of the last failure
+	LastIP string `json:"lastIP"`
+}
+
+func EmailSource(email string) string {
+	return fmt.Sprintf("email:%s", email)
+}
+
+func IPSource(ip string) string {
+	return fmt.Sprintf("ip:%s", ip)
+}
+
+func GetLoginFailure(source string) (failure LoginFailure) {
+	db.Where("source = ?", source).First(&failure)
+
+	return
+}
+
+// AddLoginFailure counts a failure of source coming from ip, counters older
+// than window start over. Once maxFailures is reached the source is locked for lockFor, locked
+// reports whether this failure is the one that locked it
+func AddLoginFailure(source string, ip string, window time.Duration, maxFailures int, lockFor time.Duration) (failure LoginFailure, locked bool) {
+	nowTime := time.Now().UnixNano() / 1000000
+	tx := db.Begin()
+	tx.Set("gorm:query_option", "FOR UPDATE").Where("source = ?", source).First(&failure)
+	if failure.ID == 0 {
+		failure.Source = source
+	}
+	if failure.LastFailedAt < nowTime-int64(window/time.Millisecond) {
+		failure.Failures = 0
+	}
+
+	failure.Failures++
+	failure.LastFailedAt = nowTime
+	failure.LastIP = ip
+	if failure.Failures >= maxFailures && failure.LockedUntil < nowTime {
+		failure.LockedUntil = nowTime + int64(lockFor/time.Millisecond)
+		locked = true
+	}
+	if err := tx.Save(&failure).Error; err != nil {
+		tx.Rollback()
+		return failure, false
+	}
+	tx.Commit()
+
+	return
+}
+
+func ClearLoginFailure(source string) bool {
+	db.Where("source = ?", source).Delete(LoginFailure{})
+
+	return true
+}
+
+// ClearAccountFailures resets the counter of an account and the counter of
+// the client its last failure came from
+func ClearAccountFailures(email string) bool {
+	account := GetLoginFailure(EmailSource(email))
+	ClearLoginFailure(EmailSource(email))
+	if account.LastIP != "" {
+		ClearLoginFailure(IPSource(account.LastIP))
+	}
+
+	return true
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"time"
+)
+
+type RecoveryCode struct {
+	Model
+	UserId   int    `sql:"not null" gorm:"index" json:"userId"`
+	CodeHash string `sql:"not null" json:"-"`
+	UsedAt   int64  `json:"usedAt"`
+}
+
+// SetUserMfaSecret stores a pending secret, MFA is only enabled once a code
+// generated from it has been confirmed
+func SetUserMfaSecret(id int, secret string) bool {
+	db.Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"mfa_enabled": false,
+		"mfa_secret":  secret,
+		"mfa_counter": 0,
+	})
+
+	return true
+}
+
+func EnableUserMfa(id int, counter int64) bool {
+	db.Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"mfa_enabled": true,
+		"mfa_counter": counter,
+	})
+
+	return true
+}
+
+func DisableUserMfa(id int) bool {
+	tx := db.Begin()
+	err := tx.Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"mfa_enabled": false,
+		"mfa_secret":  "",
+		"mfa_counter": 0,
+	}).Error
+	if err == nil {
+		err = tx.Where("user_id = ?", id).Delete(RecoveryCode{}).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		return false
+	}
+	tx.Commit()
+
+	return true
+}
+
+// UseUserMfaCounter records the time step of an accepted code, it reports
+// false when that step or a later one was already used
+func UseUserMfaCounter(id int, counter int64) bool {
+	affected := db.Model(&User{}).Where("id = ? AND mfa_counter < ?", id, counter).UpdateColumn("mfa_counter", counter).RowsAffected
+
+	return affected > 0
+}
+
+// ReplaceRecoveryCodes drops the previous codes of a user for new ones
+func ReplaceRecoveryCodes(userId int, hashes []string) bool {
+	tx := db.Begin()
+	if err := tx.Where("user_id = ?", userId).Delete(RecoveryCode{}).Error; err != nil {
+		tx.Rollback()
+		return false
+	}
+	for _, hash := range hashes {
+		if err := tx.Create(&RecoveryCode{UserId: userId, CodeHash: hash}).Error; err != nil {
+			tx.Rollback()
+			return false
+		}
+	}
+	tx.Commit()
+
+	return true
+}
+
+func UseRecoveryCode(userId int, hash string) bool {
+	nowTime := time.Now().UnixNano() / 1000000
+	affected := db.Model(&RecoveryCode{}).Where("user_id = ? AND code_hash = ? AND used_at = 0", userId, hash).Update("used_at", nowTime).RowsAffected
+
+	return affected > 0
+}
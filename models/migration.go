@@ -0,0 +1,35 @@
+package models
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+// Migration records a one-shot migration that has run, it is not run again
+// even if the data it changed shows up again later
+type Migration struct {
+	Model
+	Name string `sql:"not null" gorm:"unique_index" json:"name"`
+}
+
+// runMigration runs migrate in a transaction unless a migration called name
+// has run already. The record is written first, an instance starting at the
+// same time fails on the unique name and leaves the migration to the other.
+func runMigration(name string, migrate func(tx *gorm.DB) error) error {
+	var done Migration
+	db.Where("name = ?", name).First(&done)
+	if done.ID > 0 {
+		return nil
+	}
+
+	tx := db.Begin()
+	if err := tx.Create(&Migration{Name: name}).Error; err != nil {
+		tx.Rollback()
+		return nil
+	}
+	if err := migrate(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
@@ -33,13 +33,33 @@ func init() {
 	}
 
 	// db.SingularTable(true)
-	db.AutoMigrate(&User{}, &Group{}, &Post{})
+	db.AutoMigrate(&User{}, &Group{}, &Post{}, &RefreshToken{}, &RevokedToken{}, &PasswordReset{}, &RecoveryCode{}, &AccessToken{}, &LoginFailure{}, &Audit{}, &SigningKey{}, &OidcState{}, &OidcLink{}, &Migration{}, &Session{}, &PolicyRevision{}, &Organization{}, &OrgMember{}, &CasbinRule{}, &UserGroup{}, &PostRevision{}, &Tag{}, &PostTag{}, &Category{})
 	db.Callback().Create().Replace("gorm:update_time_stamp", updateTimeStampForCreateCallback)
 	db.Callback().Update().Replace("gorm:update_time_stamp", updateTimeStampForUpdateCallback)
 	var root User
-	if err := db.Where(User{Email: "chalinsmith@gmail.com"}).Attrs(User{Username: "root", Password: util.Encrypt("123456", "sha256")}).FirstOrCreate(&root).Error; err != nil {
+	password, _ := util.HashPassword("123456")
+	if err := db.Where(User{Email: "chalinsmith@gmail.com"}).Attrs(User{Username: "root", Password: password}).FirstOrCreate(&root).Error; err != nil {
 		fmt.Printf("Should not raise any error, but got %v", err)
 	}
+	db.FirstOrCreate(&PolicyRevision{}, PolicyRevision{ID: 1})
+	if err := addDefaultOrganization(); err != nil {
+		fmt.Printf("Fail to add the default organization: %v", err)
+	}
+	if err := runMigration("organizations", migrateOrganizations); err != nil {
+		fmt.Printf("Fail to migrate organizations: %v", err)
+	}
+	if err := runMigration("policy_group_subjects", migratePolicySubjects); err != nil {
+		fmt.Printf("Fail to migrate policy subjects: %v", err)
+	}
+	if err := migrateUserGroups(); err != nil {
+		fmt.Printf("Fail to migrate user groups: %v", err)
+	}
+	if err := runMigration("post_titles", migratePostTitles); err != nil {
+		fmt.Printf("Fail to migrate post titles: %v", err)
+	}
+	if err := migratePostStatus(); err != nil {
+		fmt.Printf("Fail to migrate post status: %v", err)
+	}
 	db.DB().SetMaxIdleConns(2000)
 	db.DB().SetMaxOpenConns(1000)
 }
@@ -63,13 +83,29 @@ func updateTimeStampForCreateCallback(scope *gorm.Scope) {
 				modifyTimeField.Set(nowTime)
 			}
 		}
+
+		if versionField, ok := scope.FieldByName("Version"); ok {
+			if versionField.IsBlank {
+				versionField.Set(1)
+			}
+		}
 	}
 }
 
-// updateTimeStampForUpdateCallback will set `UpdatedAt` when updating
+// updateTimeStampForUpdateCallback will set `UpdatedAt` and count up
+// `Version` when updating
 func updateTimeStampForUpdateCallback(scope *gorm.Scope) {
 	nowTime := time.Now().UnixNano() / 1000000
 	if _, ok := scope.Get("gorm:update_at"); !ok {
 		scope.SetColumn("UpdatedAt", nowTime)
 	}
+
+	if versionField, ok := scope.FieldByName("Version"); ok {
+		// Updates write the update attributes, Save the fields
+		if attrs, ok := scope.InstanceGet("gorm:update_attrs"); ok {
+			attrs.(map[string]interface{})[versionField.DBName] = gorm.Expr(versionField.DBName + " + 1")
+		} else {
+			versionField.Set(versionField.Field.Int() + 1)
+		}
+	}
 }
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+)
+
+// OidcState keeps what a login started at the provider needs to be finished
+// at the callback: the nonce expected in the ID token and the PKCE verifier
+type OidcState struct {
+	Model
+	State     string `sql:"not null" gorm:"unique_index" json:"-"`
+	Nonce     string `sql:"not null" json:"-"`
+	Verifier  string `sql:"not null" json:"-"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+// AddOidcState stores a new login attempt and drops the expired ones
+func AddOidcState(state OidcState) bool {
+	nowTime := time.Now().UnixNano() / 1000000
+	db.Where("expires_at <= ?", nowTime).Delete(OidcState{})
+	if err := db.Create(&state).Error; err != nil {
+		return false
+	}
+
+	return true
+}
+
+// TakeOidcState returns and consumes an unexpired login attempt, a state
+// can only be taken once even by concurrent callbacks
+func TakeOidcState(value string) (state OidcState) {
+	nowTime := time.Now().UnixNano() / 1000000
+	db.Where("state = ? AND expires_at > ?", value, nowTime).First(&state)
+	if state.ID == 0 {
+		return
+	}
+	if db.Where("id = ?", state.ID).Delete(OidcState{}).RowsAffected == 0 {
+		return OidcState{}
+	}
+
+	return
+}
+
+// OidcLink ties a user to the subject of an identity provider. After the
+// first login the user is found by its subject, the email of the ID token
+// is not looked at anymore.
+type OidcLink struct {
+	Model
+	UserId  int    `sql:"not null" gorm:"unique_index:idx_oidc_user" json:"userId"`
+	Issuer  string `sql:"not null" gorm:"unique_index:idx_oidc_user;unique_index:idx_oidc_subject" json:"issuer"`
+	Subject string `sql:"not null" gorm:"unique_index:idx_oidc_subject" json:"subject"`
+}
+
+func GetOidcLink(issuer string, subject string) (link OidcLink) {
+	db.Where("issuer = ? AND subject = ?", issuer, subject).First(&link)
+
+	return
+}
+
+// ExistOidcLinkByUser reports whether a user is linked to a subject of issuer
+func ExistOidcLinkByUser(issuer string, userId int) bool {
+	var link OidcLink
+	db.Select("id").Where("issuer = ? AND user_id = ?", issuer, userId).First(&link)
+
+	return link.ID > 0
+}
+
+func AddOidcLink(link OidcLink) bool {
+	if err := db.Create(&link).Error; err != nil {
+		return false
+	}
+
+	return true
+}
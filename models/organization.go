@@ -0,0 +1,250 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	DefaultOrgName = "default"
+
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// Organization is a tenant, its policies live in the casbin domain o_<id>
+type Organization struct {
+	Model
+	Name string `sql:"not null" gorm:"unique_index" json:"name"`
+	Desc string `json:"desc"`
+}
+
+// OrgMember puts a user into an organization, admins of an organization get
+// the admin role in its domain
+type OrgMember struct {
+	Model
+	OrgId  int    `sql:"not null" gorm:"unique_index:idx_org_member" json:"orgId"`
+	UserId int    `sql:"not null" gorm:"unique_index:idx_org_member;index" json:"userId"`
+	Role   string `sql:"not null" json:"role"`
+	User   *User  `json:"user,omitempty"`
+}
+
+// OrgDomain is the casbin domain of an organization
+func OrgDomain(id int) string {
+	return fmt.Sprintf("o_%d", id)
+}
+
+// orgAdminRules are granted to the admin role of every domain, so
+// organization admins manage their own organization without root
+var orgAdminRules = [][]string{
+	{OrgRoleAdmin, "*", "/api/policy", "(GET)|(POST)|(DELETE)"},
+	{OrgRoleAdmin, "*", "/api/policy/*", "(GET)|(POST)"},
+	{OrgRoleAdmin, "*", "/api/subjects/:sub/permissions", "GET"},
+	{OrgRoleAdmin, "*", "/api/permissions", "GET"},
+	{OrgRoleAdmin, "*", "/api/org/members", "GET"},
+	{OrgRoleAdmin, "*", "/api/org/members/:userId", "(PUT)|(DELETE)"},
+	{OrgRoleAdmin, "*", "/api/groups", "(GET)|(POST)"},
+	{OrgRoleAdmin, "*", "/api/groups/:groupId", "(GET)|(PUT)|(DELETE)"},
+	{OrgRoleAdmin, "*", "/api/groups/:groupId/users", "GET"},
+	{OrgRoleAdmin, "*", "/api/groups/:groupId/users/:id", "(GET)|(POST)|(DELETE)"},
+	{OrgRoleAdmin, "*", "/api/groups/:groupId/parent", "PUT"},
+	{OrgRoleAdmin, "*", "/api/users/:id/groups", "GET"},
+}
+
+func DefaultOrgId() int {
+	var org Organization
+	db.Select("id").Where("name = ?", DefaultOrgName).First(&org)
+
+	return org.ID
+}
+
+func ExistOrganizationByID(id int) bool {
+	var org Organization
+	db.Select("id").Where("id = ?", id).First(&org)
+	if org.ID > 0 {
+		return true
+	}
+
+	return false
+}
+
+func ExistOrganizationByName(name string) bool {
+	var org Organization
+	db.Select("id").Where("name = ?", name).First(&org)
+	if org.ID > 0 {
+		return true
+	}
+
+	return false
+}
+
+func GetOrganization(id int) (org Organization) {
+	db.Where("id = ?", id).First(&org)
+
+	return
+}
+
+func GetOrganizations() (orgs []Organization) {
+	db.Order("id").Find(&orgs)
+
+	return
+}
+
+// GetUserOrganizations returns the organizations of a user, the one joined
+// first leads
+func GetUserOrganizations(userId int) (orgs []Organization) {
+	db.Joins("JOIN org_members ON org_members.org_id = organizations.id").
+		Where("org_members.user_id = ?", userId).Order("org_members.id").Find(&orgs)
+
+	return
+}
+
+func AddOrganization(org *Organization) bool {
+	if err := db.Create(org).Error; err != nil {
+		return false
+	}
+
+	return true
+}
+
+func GetOrgMember(orgId int, userId int) (member OrgMember) {
+	db.Where("org_id = ? AND user_id = ?", orgId, userId).First(&member)
+
+	return
+}
+
+func IsOrgMember(orgId int, userId int) bool {
+	return GetOrgMember(orgId, userId).ID > 0
+}
+
+func GetOrgMembers(orgId int) (members []OrgMember) {
+	db.Where("org_id = ?", orgId).Order("id").Find(&members)
+	for i := range members {
+		var user User
+		db.Select("id, email, username, group_id").Where("id = ?", members[i].UserId).First(&user)
+		members[i].User = &user
+	}
+
+	return
+}
+
+// SetOrgMember adds a user to an organization or changes the role, the
+// admin grouping policy of the domain follows the role
+func SetOrgMember(orgId int, userId int, role string) error {
+	tx := db.Begin()
+	if err := setOrgMember(tx, orgId, userId, role); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := bumpPolicyRevision(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// RemoveOrgMember takes a user out of an organization and its groups,
+// together with every grouping policy the user has in its domain
+func RemoveOrgMember(orgId int, userId int) error {
+	tx := db.Begin()
+	if err := tx.Where("org_id = ? AND user_id = ?", orgId, userId).Delete(OrgMember{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	var groupIds []int
+	tx.Model(&UserGroup{}).Joins("JOIN `groups` ON `groups`.id = user_groups.group_id").
+		Where("user_groups.user_id = ? AND `groups`.org_id = ?", userId, orgId).Pluck("user_groups.group_id", &groupIds)
+	for _, groupId := range groupIds {
+		if err := removeUserGroup(tx, userId, groupId); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	subject := fmt.Sprintf("u_%d", userId)
+	if err := tx.Where("p_type = 'g' AND v0 = ? AND v2 = ?", subject, OrgDomain(orgId)).Delete(CasbinRule{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := bumpPolicyRevision(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+func setOrgMember(tx *gorm.DB, orgId int, userId int, role string) error {
+	var member OrgMember
+	tx.Where("org_id = ? AND user_id = ?", orgId, userId).First(&member)
+	member.OrgId = orgId
+	member.UserId = userId
+	member.Role = role
+	if err := tx.Save(&member).Error; err != nil {
+		return err
+	}
+
+	admin := newCasbinRule("g", []string{fmt.Sprintf("u_%d", userId), OrgRoleAdmin, OrgDomain(orgId)})
+	if err := tx.Where(&admin).Delete(CasbinRule{}).Error; err != nil {
+		return err
+	}
+	// disabled and deleted users get the role back from restoreUserSubjects
+	if role == OrgRoleAdmin && activeUser(tx, userId) {
+		return tx.Create(&admin).Error
+	}
+	return nil
+}
+
+// addDefaultOrganization creates the organization users and groups from
+// before organizations belong to
+func addDefaultOrganization() error {
+	var org Organization
+	return db.Where(Organization{Name: DefaultOrgName}).Attrs(Organization{Desc: "Default organization"}).FirstOrCreate(&org).Error
+}
+
+// migrateOrganizations moves a database from before organizations into the
+// default organization: policies get its domain, groups and users join it.
+// It runs once, databases which already have members were migrated before
+// it was recorded and are left as they are.
+func migrateOrganizations(tx *gorm.DB) error {
+	var count int
+	tx.Model(&OrgMember{}).Count(&count)
+	if count > 0 {
+		return nil
+	}
+
+	var org Organization
+	tx.Where("name = ?", DefaultOrgName).First(&org)
+	if org.ID == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	domain := OrgDomain(org.ID)
+
+	// mysql assigns from left to right, each column is read before it is
+	// overwritten
+	if err := tx.Exec("UPDATE casbin_rule SET v3 = v2, v2 = v1, v1 = ? WHERE p_type = 'p' AND v3 = ''", domain).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec("UPDATE casbin_rule SET v2 = ? WHERE p_type = 'g' AND v2 = ''", domain).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&Group{}).Where("org_id = 0").UpdateColumn("org_id", org.ID).Error; err != nil {
+		return err
+	}
+
+	nowTime := time.Now().UnixNano() / 1000000
+	if err := tx.Exec("INSERT INTO org_members (org_id, user_id, role, created_at, updated_at) SELECT ?, id, ?, ?, ? FROM users WHERE username <> 'root'", org.ID, OrgRoleMember, nowTime, nowTime).Error; err != nil {
+		return err
+	}
+
+	for _, values := range orgAdminRules {
+		rule := newCasbinRule("p", values)
+		if err := tx.Where(rule).FirstOrCreate(&rule).Error; err != nil {
+			return err
+		}
+	}
+
+	return bumpPolicyRevision(tx)
+}
@@ -0,0 +1,167 @@
+package models
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/Chalin-Shi/gout/libs/util"
+)
+
+// CasbinRule maps the table the casbin gorm adapter keeps policies in, for
+// changes that have to be done within a transaction of our own
+type CasbinRule struct {
+	PType string `gorm:"size:100"`
+	V0    string `gorm:"size:100"`
+	V1    string `gorm:"size:100"`
+	V2    string `gorm:"size:100"`
+	V3    string `gorm:"size:100"`
+	V4    string `gorm:"size:100"`
+	V5    string `gorm:"size:100"`
+}
+
+func (CasbinRule) TableName() string {
+	return "casbin_rule"
+}
+
+// PolicyRevision is a single row counting policy changes, instances reload
+// their policy when they see it move
+type PolicyRevision struct {
+	ID       int   `gorm:"primary_key"`
+	Revision int64 `sql:"not null"`
+}
+
+func GetPolicyRevision() int64 {
+	var revision PolicyRevision
+	db.Where("id = 1").First(&revision)
+
+	return revision.Revision
+}
+
+func BumpPolicyRevision() bool {
+	return bumpPolicyRevision(db) == nil
+}
+
+func bumpPolicyRevision(tx *gorm.DB) error {
+	return tx.Model(&PolicyRevision{}).Where("id = 1").UpdateColumn("revision", gorm.Expr("revision + 1")).Error
+}
+
+// migratePolicySubjects renames the subjects of policies added before groups
+// were prefixed, "3" becomes "g_3" like the subjects of grouping policies
+func migratePolicySubjects(tx *gorm.DB) error {
+	if err := tx.Exec("UPDATE casbin_rule SET v0 = CONCAT('g_', v0) WHERE p_type = 'p' AND v0 REGEXP '^[0-9]+$'").Error; err != nil {
+		return err
+	}
+
+	return bumpPolicyRevision(tx)
+}
+
+// GetPolicySet reads every rule from the casbin table
+func GetPolicySet() util.PolicySet {
+	var rules []CasbinRule
+	db.Find(&rules)
+
+	return policySet(rules)
+}
+
+// GetDomainPolicySet reads the rules of one organization domain
+func GetDomainPolicySet(domain string) util.PolicySet {
+	var rules []CasbinRule
+	db.Where("(p_type = 'p' AND v1 = ?) OR (p_type = 'g' AND v2 = ?)", domain, domain).Find(&rules)
+
+	return policySet(rules)
+}
+
+// ApplyPolicyDiff adds and removes rules in one transaction and bumps the
+// policy revision, so every instance reloads
+func ApplyPolicyDiff(added util.PolicySet, removed util.PolicySet) error {
+	tx := db.Begin()
+	for ptype, rules := range map[string][][]string{"p": removed.P, "g": removed.G} {
+		for _, values := range rules {
+			rule := newCasbinRule(ptype, values)
+			if err := tx.Where(&rule).Delete(CasbinRule{}).Error; err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+	for ptype, rules := range map[string][][]string{"p": added.P, "g": added.G} {
+		for _, values := range rules {
+			rule := newCasbinRule(ptype, values)
+			if err := tx.Create(&rule).Error; err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+	if err := bumpPolicyRevision(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+func newCasbinRule(ptype string, values []string) CasbinRule {
+	rule := CasbinRule{PType: ptype}
+	fields := []*string{&rule.V0, &rule.V1, &rule.V2, &rule.V3, &rule.V4, &rule.V5}
+	for i, v := range values {
+		if i < len(fields) {
+			*fields[i] = v
+		}
+	}
+	return rule
+}
+
+// values drops the trailing empty fields like the casbin adapter does
+func policySet(rules []CasbinRule) (set util.PolicySet) {
+	for _, rule := range rules {
+		values := rule.values()
+		switch rule.PType {
+		case "p":
+			set.P = append(set.P, values)
+		case "g":
+			set.G = append(set.G, values)
+		}
+	}
+
+	return
+}
+
+func (rule CasbinRule) values() []string {
+	values := []string{rule.V0, rule.V1, rule.V2, rule.V3, rule.V4, rule.V5}
+	for len(values) > 0 && values[len(values)-1] == "" {
+		values = values[:len(values)-1]
+	}
+	return values
+}
+
+var (
+	defaultGroupPermissions   [][]string
+	defaultGroupPermissionsMu sync.RWMutex
+)
+
+// SetDefaultGroupPermissions sets the path and method pairs granted to new
+// groups
+func SetDefaultGroupPermissions(permissions [][]string) {
+	defaultGroupPermissionsMu.Lock()
+	defer defaultGroupPermissionsMu.Unlock()
+
+	defaultGroupPermissions = permissions
+}
+
+// grantDefaultPermissions gives a new group the default permissions in the
+// domain of its organization
+func grantDefaultPermissions(tx *gorm.DB, group Group) error {
+	defaultGroupPermissionsMu.RLock()
+	defer defaultGroupPermissionsMu.RUnlock()
+
+	for _, permission := range defaultGroupPermissions {
+		rule := newCasbinRule("p", []string{fmt.Sprintf("g_%d", group.ID), OrgDomain(group.OrgId), permission[0], permission[1]})
+		if err := tx.Where(&rule).FirstOrCreate(&rule).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
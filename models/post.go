@@ -1,11 +1,60 @@
 package models
 
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/Chalin-Shi/gout/libs/util"
+)
+
 type Post struct {
 	Model
-	Title   string `sql:"not null" json:"title"`
+	// Title is unique among the posts of a user
+	Title   string `sql:"not null" gorm:"unique_index:idx_user_title" json:"title"`
 	Desc    string `sql:"not null" json:"desc"`
 	Content string `sql:"not null;type:text" json:"content"`
-	UserId  int    `json:"postId,omitempty"`
+	UserId  int    `sql:"not null" gorm:"index;unique_index:idx_user_title" json:"userId"`
+
+	// Status is a state of the post workflow, see postTransitions
+	Status      string `sql:"not null" gorm:"index" json:"status"`
+	PublishAt   int64  `sql:"not null" json:"publishAt"`
+	PublishedAt int64  `sql:"not null" json:"publishedAt"`
+	// CategoryId is the category of the post, 0 for none
+	CategoryId int `sql:"not null" gorm:"index" json:"categoryId"`
+	// Tags are the names of the tags of the post, kept in post_tags
+	Tags []string `gorm:"-" json:"tags"`
+	// Version counts the changes of the post, its ETag and the condition
+	// of conditional changes, see updateIfUnmodified
+	Version int `sql:"not null;default:1" json:"-"`
+}
+
+// PostTopic narrows a list of posts to the posts with the tag named Tag and
+// in the category named Category or one nested in it, tags and categories
+// being those of the organization OrgId. Empty names don't narrow the list.
+type PostTopic struct {
+	OrgId    int
+	Tag      string
+	Category string
+}
+
+func (topic PostTopic) scope(tx *gorm.DB) *gorm.DB {
+	if topic.Tag != "" {
+		tagged := db.Table("post_tags").Select("post_tags.post_id").
+			Joins("JOIN tags ON tags.id = post_tags.tag_id").
+			Where("tags.org_id = ? AND tags.name = ?", topic.OrgId, topic.Tag).SubQuery()
+		tx = tx.Where("id IN (?)", tagged)
+	}
+	if topic.Category != "" {
+		id := GetOrgCategoryIdByName(topic.OrgId, topic.Category)
+		if id == 0 {
+			return tx.Where("1 = 0")
+		}
+		tx = tx.Where("category_id IN (?)", GetCategoryTree(id))
+	}
+
+	return tx
 }
 
 func ExistPostByID(id int) bool {
@@ -18,9 +67,11 @@ func ExistPostByID(id int) bool {
 	return false
 }
 
-func ExistPostByEmail(email string) bool {
+// ExistPostByTitle reports whether the user has a post titled title, titles
+// are unique per user
+func ExistPostByTitle(userId int, title string) bool {
 	var post Post
-	db.Select("id").Where("email = ?", email).First(&post)
+	db.Select("id").Where("user_id = ? AND title = ?", userId, title).First(&post)
 	if post.ID > 0 {
 		return true
 	}
@@ -28,38 +79,231 @@ func ExistPostByEmail(email string) bool {
 	return false
 }
 
+// migratePostTitles adds the unique index of titles to a database from before
+// it, posts sharing the title of an older post of their user get their id
+// appended to the title first
+func migratePostTitles(tx *gorm.DB) error {
+	if tx.Dialect().HasIndex("posts", "idx_user_title") {
+		return nil
+	}
+
+	var posts []Post
+	tx.Select("id, user_id, title").Order("id").Find(&posts)
+	seen := make(map[string]bool, len(posts))
+	for _, post := range posts {
+		// the index compares like the column, without case or trailing spaces
+		key := fmt.Sprintf("%d:%s", post.UserId, strings.ToLower(strings.TrimRight(post.Title, " ")))
+		if !seen[key] {
+			seen[key] = true
+			continue
+		}
+		title := fmt.Sprintf("%s (%d)", post.Title, post.ID)
+		if err := tx.Model(&Post{}).Where("id = ?", post.ID).UpdateColumn("title", title).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Model(&Post{}).AddUniqueIndex("idx_user_title", "user_id", "title").Error
+}
+
 func GetPostTotal(maps interface{}) (count int) {
 	db.Model(&Post{}).Where(maps).Count(&count)
 
 	return
 }
 
-func GetPosts() (posts []Post) {
-	db.Order("updated_at desc").Find(&posts)
+// PostFields are the fields lists of posts are filtered and sorted by
+var PostFields = util.Fields{
+	"id":         "id",
+	"title":      "title",
+	"status":     "status",
+	"publishAt":  "publish_at",
+	"categoryId": "category_id",
+	"createdAt":  "created_at",
+	"updatedAt":  "updated_at",
+}
+
+func GetPosts(q util.Query, maps map[string]interface{}, topic PostTopic) (posts []Post, page util.Pagination, err error) {
+	page, err = paginate(topic.scope(db.Where(maps)), q, &posts)
+	if err == nil {
+		loadPostTags(posts)
+	}
+
+	return
+}
+
+// GetOrgPosts lists the posts of the members of an organization
+func GetOrgPosts(orgId int, q util.Query, maps map[string]interface{}, topic PostTopic) (posts []Post, page util.Pagination, err error) {
+	members := db.Model(&OrgMember{}).Select("user_id").Where("org_id = ?", orgId).SubQuery()
+	page, err = paginate(topic.scope(db.Where(maps).Where("user_id IN (?)", members)), q, &posts)
+	if err == nil {
+		loadPostTags(posts)
+	}
 
 	return
 }
 
+// loadPostTags fills in the tags of a list of posts
+func loadPostTags(posts []Post) {
+	if len(posts) == 0 {
+		return
+	}
+	ids := make([]int, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+
+	var links []struct {
+		PostId int
+		Name   string
+	}
+	db.Table("post_tags").Select("post_tags.post_id, tags.name").
+		Joins("JOIN tags ON tags.id = post_tags.tag_id").
+		Where("post_tags.post_id IN (?)", ids).Order("tags.name").Scan(&links)
+	tags := make(map[int][]string)
+	for _, link := range links {
+		tags[link.PostId] = append(tags[link.PostId], link.Name)
+	}
+	for i := range posts {
+		posts[i].Tags = tags[posts[i].ID]
+		if posts[i].Tags == nil {
+			posts[i].Tags = []string{}
+		}
+	}
+}
+
 func GetPost(id int) (post Post) {
 	db.Where("id = ?", id).First(&post)
 
 	return
 }
 
-func AddPost(post Post) bool {
-	db.Create(&post)
+// GetUserPost returns a post of the user, an empty post if the user has no
+// such post
+func GetUserPost(userId int, id int) (post Post) {
+	db.Where("id = ? AND user_id = ?", id, userId).First(&post)
+
+	return
+}
+
+// GetPostOwner returns the user id of a post, 0 if there is no such post
+func GetPostOwner(id int) int {
+	var post Post
+	db.Select("user_id").Where("id = ?", id).First(&post)
+
+	return post.UserId
+}
+
+// AddPost creates a post with its first revision, post.Tags name tags of
+// the organization orgId
+func AddPost(post *Post, orgId int) bool {
+	tx := db.Begin()
+	if err := tx.Create(post).Error; err != nil {
+		tx.Rollback()
+		return false
+	}
+	if err := addPostRevision(tx, *post, post.UserId); err != nil {
+		tx.Rollback()
+		return false
+	}
+	if _, err := setPostTags(tx, post.ID, orgId, post.Tags); err != nil {
+		tx.Rollback()
+		return false
+	}
 
-	return true
+	return tx.Commit().Error == nil
 }
 
-func EditPost(id int, data interface{}) bool {
-	db.Model(&Post{}).Where("id = ?", id).Updates(data)
+// EditPost changes a post and keeps the result as a new revision made by
+// userId, unless the post was changed since its version version. tags
+// name tags of the organization orgId the post gets instead of its tags,
+// nil leaves them as they are. Posts from before revisions get the state
+// they are changed from as their first revision. Revisions hold the title,
+// desc and content, changes keeping them add no revision.
+func EditPost(id int, userId int, orgId int, version int, data map[string]interface{}, tags []string) error {
+	tx := db.Begin()
+	var post Post
+	tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", id).First(&post)
+	if post.ID == 0 {
+		tx.Rollback()
+		return gorm.ErrRecordNotFound
+	}
+	if version != 0 && post.Version != version {
+		tx.Rollback()
+		return ErrModified
+	}
+
+	if len(data) > 0 {
+		if err := tx.Model(&Post{}).Where("id = ?", id).Updates(data).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if tags != nil {
+		changed, err := setPostTags(tx, id, orgId, tags)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		// the tags are part of the post and of its ETag
+		if changed && len(data) == 0 {
+			if err := touchPosts(tx, []int{id}); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+	var edited Post
+	tx.Where("id = ?", id).First(&edited)
+	if edited.Title != post.Title || edited.Desc != post.Desc || edited.Content != post.Content {
+		var count int
+		tx.Model(&PostRevision{}).Where("post_id = ?", id).Count(&count)
+		if count == 0 {
+			if err := addPostRevision(tx, post, post.UserId); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		if err := addPostRevision(tx, edited, userId); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
 
-	return true
+	return tx.Commit().Error
 }
 
-func DeletePost(id int) bool {
-	db.Where("id = ?", id).Delete(Post{})
+// DeletePost deletes a post with its revisions and tags as long as its
+// version is still version, 0 deletes anyway
+func DeletePost(id int, version int) error {
+	tx := db.Begin()
+	remove := tx.Where("id = ?", id)
+	if version != 0 {
+		remove = remove.Where("version = ?", version)
+	}
+	result := remove.Delete(Post{})
+	if result.Error != nil {
+		tx.Rollback()
+		return result.Error
+	}
+	if version != 0 && result.RowsAffected == 0 {
+		tx.Rollback()
+		return ErrModified
+	}
+	if err := tx.Where("post_id = ?", id).Delete(PostRevision{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	var tagIds []int
+	tx.Model(&PostTag{}).Where("post_id = ?", id).Pluck("tag_id", &tagIds)
+	if err := tx.Where("post_id = ?", id).Delete(PostTag{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := countTagPosts(tx, tagIds); err != nil {
+		tx.Rollback()
+		return err
+	}
 
-	return true
+	return tx.Commit().Error
 }
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"github.com/jinzhu/gorm"
+
+	"github.com/Chalin-Shi/gout/libs/util"
+)
+
+// PostRevision is a snapshot of a post taken on every change of it, UserId
+// is who made the change. Revisions are never changed, restoring one adds a
+// new revision.
+type PostRevision struct {
+	Model
+	PostId  int    `sql:"not null" gorm:"unique_index:idx_post_revision" json:"postId"`
+	Number  int    `sql:"not null" gorm:"unique_index:idx_post_revision" json:"number"`
+	UserId  int    `sql:"not null" json:"userId"`
+	Title   string `sql:"not null" json:"title"`
+	Desc    string `sql:"not null" json:"desc"`
+	Content string `sql:"not null;type:text" json:"content"`
+}
+
+// RevisionFields are the fields lists of revisions are filtered and sorted
+// by
+var RevisionFields = util.Fields{
+	"id":        "id",
+	"number":    "number",
+	"userId":    "user_id",
+	"createdAt": "created_at",
+}
+
+func GetPostRevisions(postId int, q util.Query) (revisions []PostRevision, page util.Pagination, err error) {
+	page, err = paginate(db.Where("post_id = ?", postId), q, &revisions)
+
+	return
+}
+
+// GetPostRevision returns revision number of a post, the latest one for 0
+func GetPostRevision(postId int, number int) (revision PostRevision) {
+	if number == 0 {
+		db.Where("post_id = ?", postId).Order("number desc").First(&revision)
+	} else {
+		db.Where("post_id = ? AND number = ?", postId, number).First(&revision)
+	}
+
+	return
+}
+
+// addPostRevision snapshots a post as its next revision
+func addPostRevision(tx *gorm.DB, post Post, userId int) error {
+	var last PostRevision
+	tx.Select("number").Where("post_id = ?", post.ID).Order("number desc").First(&last)
+	revision := PostRevision{
+		PostId:  post.ID,
+		Number:  last.Number + 1,
+		UserId:  userId,
+		Title:   post.Title,
+		Desc:    post.Desc,
+		Content: post.Content,
+	}
+
+	return tx.Create(&revision).Error
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	PostDraft     = "draft"
+	PostReview    = "review"
+	PostScheduled = "scheduled"
+	PostPublished = "published"
+	PostArchived  = "archived"
+)
+
+var ErrPostTransition = errors.New("post can't move to that status")
+
+// postTransitions are the statuses a post may move to from its status. Who
+// may make a move is up to the casbin policies on the routes making it.
+var postTransitions = map[string][]string{
+	PostDraft:     {PostReview, PostArchived},
+	PostReview:    {PostDraft, PostScheduled, PostPublished},
+	PostScheduled: {PostDraft, PostPublished},
+	PostPublished: {PostArchived},
+	PostArchived:  {PostDraft},
+}
+
+// CanTransitPost reports whether a post may move from one status to another
+func CanTransitPost(from string, to string) bool {
+	for _, status := range postTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitPost moves a post from one status to another. publishAt is kept by
+// scheduled posts, published posts are stamped with the time they went live.
+// The move fails with ErrPostTransition when the post is no longer in the
+// from status, e.g. because the scheduler published it meanwhile.
+func TransitPost(id int, from string, to string, publishAt int64) error {
+	if !CanTransitPost(from, to) {
+		return ErrPostTransition
+	}
+
+	data := map[string]interface{}{"status": to}
+	switch to {
+	case PostScheduled:
+		data["publish_at"] = publishAt
+	case PostPublished:
+		data["published_at"] = time.Now().UnixNano() / 1000000
+	case PostDraft:
+		data["publish_at"] = 0
+	}
+	result := db.Model(&Post{}).Where("id = ? AND status = ?", id, from).Updates(data)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPostTransition
+	}
+
+	return nil
+}
+
+// PublishDuePosts publishes the scheduled posts whose time has come, several
+// instances may run it at once
+func PublishDuePosts() (int, error) {
+	now := time.Now().UnixNano() / 1000000
+	result := db.Model(&Post{}).Where("status = ? AND publish_at <= ?", PostScheduled, now).
+		Updates(map[string]interface{}{"status": PostPublished, "published_at": now})
+
+	return int(result.RowsAffected), result.Error
+}
+
+// migratePostStatus publishes the posts from before the workflow, they were
+// live from the moment they were created
+func migratePostStatus() error {
+	return db.Model(&Post{}).Where("status = ''").
+		Updates(map[string]interface{}{"status": PostPublished, "published_at": gorm.Expr("created_at")}).Error
+}
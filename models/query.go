@@ -0,0 +1,67 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/Chalin-Shi/gout/libs/util"
+)
+
+// paginate loads the page of q from tx into out, a pointer to a slice of
+// records, and counts the records matching the filters of q
+func paginate(tx *gorm.DB, q util.Query, out interface{}) (util.Pagination, error) {
+	for _, filter := range q.Filters {
+		tx = tx.Where(filter.Column+" "+filter.Op+" ?", filter.Value)
+	}
+
+	var total int
+	if err := tx.Model(out).Count(&total).Error; err != nil {
+		return util.Pagination{}, err
+	}
+
+	if q.UseCursor && q.Cursor > 0 {
+		op := " > ?"
+		if q.Desc {
+			op = " < ?"
+		}
+		tx = tx.Where(q.IdColumn+op, q.Cursor)
+	}
+	for _, order := range q.Order {
+		tx = tx.Order(order)
+	}
+	if err := tx.Limit(q.Limit).Offset(q.Start).Find(out).Error; err != nil {
+		return util.Pagination{}, err
+	}
+
+	list := reflect.Indirect(reflect.ValueOf(out))
+	lastId := 0
+	if list.Len() > 0 {
+		lastId = int(list.Index(list.Len() - 1).FieldByName("ID").Int())
+	}
+	return q.Paginate(total, list.Len(), lastId), nil
+}
+
+// ErrModified is returned by updates of a record that was changed since the
+// client read it
+var ErrModified = errors.New("record was modified")
+
+// updateIfUnmodified updates the record id of model with data as long as its
+// version is still version, the one a client saw. 0 updates anyway. Every
+// update counts the version up, so the row changes even when data doesn't.
+func updateIfUnmodified(tx *gorm.DB, model interface{}, id int, version int, data interface{}) error {
+	tx = tx.Model(model).Where("id = ?", id)
+	if version != 0 {
+		tx = tx.Where("version = ?", version)
+	}
+	result := tx.Updates(data)
+	if result.Error != nil {
+		return result.Error
+	}
+	if version != 0 && result.RowsAffected == 0 {
+		return ErrModified
+	}
+
+	return nil
+}
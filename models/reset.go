@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type PasswordReset struct {
+	Model
+	UserId    int    `sql:"not null" json:"userId"`
+	Email     string `sql:"not null" gorm:"index" json:"email"`
+	CodeHash  string `sql:"not null" json:"-"`
+	Attempts  int    `json:"attempts"`
+	ExpiresAt int64  `json:"expiresAt"`
+	UsedAt    int64  `json:"usedAt"`
+}
+
+func GetPasswordResetTotal(email string, since int64) (count int) {
+	db.Model(&PasswordReset{}).Where("email = ? AND created_at >= ?", email, since).Count(&count)
+
+	return
+}
+
+// AddPasswordReset stores a new code and invalidates the ones issued before it
+func AddPasswordReset(reset PasswordReset) bool {
+	nowTime := time.Now().UnixNano() / 1000000
+	tx := db.Begin()
+	if err := tx.Model(&PasswordReset{}).Where("email = ? AND used_at = 0", reset.Email).Update("used_at", nowTime).Error; err != nil {
+		tx.Rollback()
+		return false
+	}
+	if err := tx.Create(&reset).Error; err != nil {
+		tx.Rollback()
+		return false
+	}
+	tx.Commit()
+
+	return true
+}
+
+// GetActivePasswordReset returns the latest unused and unexpired code of email
+func GetActivePasswordReset(email string) (reset PasswordReset) {
+	nowTime := time.Now().UnixNano() / 1000000
+	db.Where("email = ? AND used_at = 0 AND expires_at > ?", email, nowTime).Order("id desc").First(&reset)
+
+	return
+}
+
+func AddPasswordResetAttempt(id int) bool {
+	db.Model(&PasswordReset{}).Where("id = ?", id).UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+
+	return true
+}
+
+// UsePasswordReset consumes a code, it reports false when the code was
+// consumed by a concurrent request
+func UsePasswordReset(id int) bool {
+	nowTime := time.Now().UnixNano() / 1000000
+	affected := db.Model(&PasswordReset{}).Where("id = ? AND used_at = 0", id).Update("used_at", nowTime).RowsAffected
+
+	return affected > 0
+}
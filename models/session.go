@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+)
+
+// Session is one login, it lives as long as its refresh token family
+type Session struct {
+	Model
+	UserId     int    `sql:"not null" gorm:"index" json:"userId"`
+	Family     string `sql:"not null" gorm:"unique_index" json:"-"`
+	UserAgent  string `gorm:"size:255" json:"userAgent"`
+	IP         string `json:"ip"`
+	LastSeenAt int64  `json:"lastSeenAt"`
+	ExpiresAt  int64  `json:"expiresAt"`
+	EndedAt    int64  `json:"endedAt"`
+}
+
+func AddSession(session Session) bool {
+	if err := db.Create(&session).Error; err != nil {
+		return false
+	}
+
+	return true
+}
+
+func GetSession(id int) (session Session) {
+	db.Where("id = ?", id).First(&session)
+
+	return
+}
+
+func GetSessionByFamily(family string) (session Session) {
+	db.Where("family = ?", family).First(&session)
+
+	return
+}
+
+// GetSessions returns the sessions of a user which have neither ended nor
+// expired, the most recently used first
+func GetSessions(userId int) (sessions []Session) {
+	nowTime := time.Now().UnixNano() / 1000000
+	db.Where("user_id = ? AND ended_at = 0 AND expires_at > ?", userId, nowTime).Order("last_seen_at desc").Find(&sessions)
+
+	return
+}
+
+// ExtendSession moves the expiry of a session along with its latest
+// refresh token
+func ExtendSession(family string, expiresAt int64) bool {
+	db.Model(&Session{}).Where("family = ? AND ended_at = 0", family).UpdateColumn("expires_at", expiresAt)
+
+	return true
+}
+
+// TouchSession records activity of a session, at most once a minute
+func TouchSession(id int) bool {
+	nowTime := time.Now().UnixNano() / 1000000
+	db.Model(&Session{}).Where("id = ? AND last_seen_at < ?", id, nowTime-60*1000).UpdateColumn("last_seen_at", nowTime)
+
+	return true
+}
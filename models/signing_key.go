@@ -0,0 +1,53 @@
+package models
+
+import (
+	"github.com/Chalin-Shi/gout/libs/util"
+)
+
+type SigningKey struct {
+	Model
+	Kid        string `sql:"not null" gorm:"unique_index" json:"kid"`
+	Alg        string `sql:"not null" json:"alg"`
+	PrivateKey string `sql:"not null;type:text" json:"-"`
+	RetiredAt  int64  `json:"retiredAt"`
+}
+
+// SigningKeyStore keeps the JWT signing keys in the database so that every
+// instance signs and verifies with the same key set
+type SigningKeyStore struct{}
+
+func (SigningKeyStore) LoadKeys() ([]util.StoredKey, error) {
+	var keys []SigningKey
+	if err := db.Order("created_at desc").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+
+	stored := make([]util.StoredKey, len(keys))
+	for i, key := range keys {
+		stored[i] = util.StoredKey{
+			Kid:        key.Kid,
+			Alg:        key.Alg,
+			PrivateKey: key.PrivateKey,
+			CreatedAt:  key.CreatedAt,
+			RetiredAt:  key.RetiredAt,
+		}
+	}
+	return stored, nil
+}
+
+func (SigningKeyStore) AddKey(key util.StoredKey) error {
+	return db.Create(&SigningKey{
+		Model:      Model{CreatedAt: key.CreatedAt},
+		Kid:        key.Kid,
+		Alg:        key.Alg,
+		PrivateKey: key.PrivateKey,
+	}).Error
+}
+
+func (SigningKeyStore) RetireKeys(except string, at int64) error {
+	return db.Model(&SigningKey{}).Where("kid <> ? AND retired_at = 0", except).Update("retired_at", at).Error
+}
+
+func (SigningKeyStore) PurgeKeys(retiredBefore int64) error {
+	return db.Where("retired_at > 0 AND retired_at < ?", retiredBefore).Delete(SigningKey{}).Error
+}
@@ -0,0 +1,233 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/Chalin-Shi/gout/libs/util"
+)
+
+var ErrTagMerge = errors.New("tag can't be merged into itself")
+
+// Tag labels posts of an organization, names are unique per organization.
+// PostCount is the number of posts the tag is on.
+type Tag struct {
+	Model
+	OrgId     int    `sql:"not null" gorm:"unique_index:idx_org_tag" json:"orgId"`
+	Name      string `sql:"not null" gorm:"unique_index:idx_org_tag" json:"name"`
+	PostCount int    `sql:"not null" json:"postCount"`
+}
+
+// PostTag puts a tag on a post, posts may have several tags
+type PostTag struct {
+	Model
+	PostId int `sql:"not null" gorm:"unique_index:idx_post_tag" json:"postId"`
+	TagId  int `sql:"not null" gorm:"unique_index:idx_post_tag;index" json:"tagId"`
+}
+
+// TagFields are the fields lists of tags are filtered and sorted by
+var TagFields = util.Fields{
+	"id":        "id",
+	"name":      "name",
+	"postCount": "post_count",
+	"createdAt": "created_at",
+	"updatedAt": "updated_at",
+}
+
+func GetTags(q util.Query, maps map[string]interface{}) (tags []Tag, page util.Pagination, err error) {
+	page, err = paginate(db.Where(maps), q, &tags)
+
+	return
+}
+
+func GetTag(id int) (tag Tag) {
+	db.Where("id = ?", id).First(&tag)
+
+	return
+}
+
+func GetOrgTagIdByName(orgId int, name string) int {
+	var tag Tag
+	db.Select("id").Where("org_id = ? AND name = ?", orgId, name).First(&tag)
+
+	return tag.ID
+}
+
+// GetPostTagNames returns the names of the tags of a post
+func GetPostTagNames(postId int) []string {
+	names := []string{}
+	db.Model(&Tag{}).Joins("JOIN post_tags ON post_tags.tag_id = tags.id").
+		Where("post_tags.post_id = ?", postId).Order("tags.name").Pluck("tags.name", &names)
+
+	return names
+}
+
+func AddTag(tag *Tag) error {
+	tag.PostCount = 0
+
+	return db.Create(tag).Error
+}
+
+// RenameTag renames a tag, the posts it is on change with it
+func RenameTag(id int, name string) error {
+	tx := db.Begin()
+	if err := tx.Model(&Tag{}).Where("id = ?", id).Updates(map[string]interface{}{"name": name}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := touchTagPosts(tx, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// MergeTag moves the posts of a tag to the tag into and deletes the tag
+func MergeTag(id int, into int) error {
+	if id == into {
+		return ErrTagMerge
+	}
+
+	tx := db.Begin()
+	var tag, target Tag
+	tx.Where("id = ?", id).First(&tag)
+	tx.Where("id = ?", into).First(&target)
+	if tag.ID == 0 || target.ID == 0 || tag.OrgId != target.OrgId {
+		tx.Rollback()
+		return gorm.ErrRecordNotFound
+	}
+
+	if err := touchTagPosts(tx, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	var postIds []int
+	tx.Model(&PostTag{}).Where("tag_id = ?", id).Order("post_id").Pluck("post_id", &postIds)
+	for _, postId := range postIds {
+		var link PostTag
+		if err := tx.Where(PostTag{PostId: postId, TagId: into}).FirstOrCreate(&link).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Where("tag_id = ?", id).Delete(PostTag{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("id = ?", id).Delete(Tag{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := countTagPosts(tx, []int{into}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// DeleteTag takes a tag off its posts and deletes it
+func DeleteTag(id int) error {
+	tx := db.Begin()
+	if err := touchTagPosts(tx, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("tag_id = ?", id).Delete(PostTag{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("id = ?", id).Delete(Tag{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// setPostTags replaces the tags of a post by the tags of the organization
+// named names and reports whether they changed, missing tags are created
+func setPostTags(tx *gorm.DB, postId int, orgId int, names []string) (bool, error) {
+	var old []int
+	tx.Model(&PostTag{}).Where("post_id = ?", postId).Pluck("tag_id", &old)
+	had := make(map[int]bool, len(old))
+	for _, id := range old {
+		had[id] = true
+	}
+
+	ids := make([]int, 0, len(names))
+	seen := make(map[int]bool)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		var tag Tag
+		if err := tx.Where(Tag{OrgId: orgId, Name: name}).FirstOrCreate(&tag).Error; err != nil {
+			return false, err
+		}
+		// names may differ in case only
+		if !seen[tag.ID] {
+			seen[tag.ID] = true
+			ids = append(ids, tag.ID)
+		}
+	}
+
+	// tags of other organizations stay on the post
+	remove := tx.Where("post_id = ? AND tag_id IN (?)", postId, tx.Model(&Tag{}).Select("id").Where("org_id = ?", orgId).SubQuery())
+	if len(ids) > 0 {
+		remove = remove.Where("tag_id NOT IN (?)", ids)
+	}
+	removed := remove.Delete(PostTag{})
+	if removed.Error != nil {
+		return false, removed.Error
+	}
+	changed := removed.RowsAffected > 0
+	for _, id := range ids {
+		if had[id] {
+			continue
+		}
+		link := PostTag{PostId: postId, TagId: id}
+		if err := tx.Create(&link).Error; err != nil {
+			return false, err
+		}
+		changed = true
+	}
+	if !changed {
+		return false, nil
+	}
+
+	return true, countTagPosts(tx, append(old, ids...))
+}
+
+// countTagPosts brings the post counts of tags up to date
+func countTagPosts(tx *gorm.DB, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return tx.Exec("UPDATE tags SET post_count = (SELECT COUNT(*) FROM post_tags WHERE post_tags.tag_id = tags.id) WHERE id IN (?)", ids).Error
+}
+
+// touchTagPosts marks the posts of a tag as changed
+func touchTagPosts(tx *gorm.DB, id int) error {
+	var postIds []int
+	tx.Model(&PostTag{}).Where("tag_id = ?", id).Pluck("post_id", &postIds)
+
+	return touchPosts(tx, postIds)
+}
+
+// touchPosts marks posts as changed, their tags or category are part of
+// them and of their ETag
+func touchPosts(tx *gorm.DB, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	nowTime := time.Now().UnixNano() / 1000000
+	return tx.Model(&Post{}).Where("id IN (?)", ids).Updates(map[string]interface{}{"updated_at": nowTime}).Error
+}
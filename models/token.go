@@ -0,0 +1,112 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type RefreshToken struct {
+	Model
+	UserId          int    `sql:"not null" json:"userId"`
+	Family          string `sql:"not null" gorm:"index" json:"family"`
+	TokenHash       string `sql:"not null" gorm:"unique_index" json:"-"`
+	AccessJti       string `json:"-"`
+	AccessExpiresAt int64  `json:"-"`
+	ExpiresAt       int64  `json:"expiresAt"`
+	RevokedAt       int64  `json:"revokedAt"`
+}
+
+type RevokedToken struct {
+	Model
+	Jti       string `sql:"not null" gorm:"unique_index" json:"jti"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+func AddRefreshToken(token RefreshToken) bool {
+	db.Create(&token)
+
+	return true
+}
+
+func GetRefreshTokenByHash(hash string) (token RefreshToken) {
+	db.Where("token_hash = ?", hash).First(&token)
+
+	return
+}
+
+// RevokeRefreshToken marks a single refresh token as used, it reports false
+// when the token had already been revoked by a concurrent request
+func RevokeRefreshToken(id int) bool {
+	nowTime := time.Now().UnixNano() / 1000000
+	affected := db.Model(&RefreshToken{}).Where("id = ? AND revoked_at = 0", id).Update("revoked_at", nowTime).RowsAffected
+
+	return affected > 0
+}
+
+// RevokeRefreshFamily revokes every refresh token of a family and denies the
+// access tokens issued alongside them which have not expired yet, which ends
+// the session of the family
+func RevokeRefreshFamily(family string) bool {
+	nowTime := time.Now().UnixNano() / 1000000
+	var tokens []RefreshToken
+	tx := db.Begin()
+	tx.Where("family = ? AND access_expires_at > ?", family, nowTime).Find(&tokens)
+	for _, token := range tokens {
+		if err := addRevokedToken(tx, token.AccessJti, token.AccessExpiresAt); err != nil {
+			tx.Rollback()
+			return false
+		}
+	}
+	if err := tx.Model(&RefreshToken{}).Where("family = ? AND revoked_at = 0", family).Update("revoked_at", nowTime).Error; err != nil {
+		tx.Rollback()
+		return false
+	}
+	if err := tx.Model(&Session{}).Where("family = ? AND ended_at = 0", family).UpdateColumn("ended_at", nowTime).Error; err != nil {
+		tx.Rollback()
+		return false
+	}
+	tx.Commit()
+
+	return true
+}
+
+// RevokeUserRefreshFamilies ends every login of a user
+func RevokeUserRefreshFamilies(userId int) bool {
+	return RevokeOtherRefreshFamilies(userId, "")
+}
+
+// RevokeOtherRefreshFamilies ends every login of a user but the one of family
+func RevokeOtherRefreshFamilies(userId int, family string) bool {
+	var families []string
+	db.Model(&RefreshToken{}).Where("user_id = ? AND revoked_at = 0 AND family <> ?", userId, family).Pluck("DISTINCT family", &families)
+	for _, family := range families {
+		if !RevokeRefreshFamily(family) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func AddRevokedToken(jti string, expiresAt int64) bool {
+	return addRevokedToken(db, jti, expiresAt) == nil
+}
+
+func ExistRevokedToken(jti string) bool {
+	var token RevokedToken
+	db.Select("id").Where("jti = ?", jti).First(&token)
+	if token.ID > 0 {
+		return true
+	}
+
+	return false
+}
+
+func addRevokedToken(tx *gorm.DB, jti string, expiresAt int64) error {
+	if jti == "" {
+		return nil
+	}
+	token := RevokedToken{Jti: jti, ExpiresAt: expiresAt}
+	return tx.Where(RevokedToken{Jti: jti}).Attrs(token).FirstOrCreate(&token).Error
+}
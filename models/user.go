@@ -1,5 +1,14 @@
 package models
 
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/Chalin-Shi/gout/libs/util"
+)
+
 type User struct {
 	Model
 	Posts []Post `json:"posts,omitempty"`
@@ -8,6 +17,18 @@ type User struct {
 	Username string `sql:"not null" json:"username"`
 	Password string `sql:"not null" json:"password,omitempty"`
 	GroupId  int    `json:"groupId,omitempty"`
+
+	MfaEnabled bool   `json:"mfaEnabled"`
+	MfaSecret  string `json:"-"`
+	MfaCounter int64  `json:"-"`
+
+	// Disabled users keep their account but can't log in or use tokens
+	Disabled bool `sql:"not null" json:"disabled"`
+	// DeletedAt marks a soft deleted user, gorm leaves them out of queries
+	DeletedAt *time.Time `sql:"index" json:"deletedAt,omitempty"`
+	// Version counts the changes of the user, its ETag and the condition
+	// of conditional changes, see updateIfUnmodified
+	Version int `sql:"not null;default:1" json:"-"`
 }
 
 func ExistUserByID(id int) bool {
@@ -20,9 +41,11 @@ func ExistUserByID(id int) bool {
 	return false
 }
 
+// ExistUserByEmail looks at soft deleted users as well, their email stays
+// taken until they are purged so they can be restored
 func ExistUserByEmail(email string) bool {
 	var user User
-	db.Select("id").Where("email = ?", email).First(&user)
+	db.Unscoped().Select("id").Where("email = ?", email).First(&user)
 	if user.ID > 0 {
 		return true
 	}
@@ -30,14 +53,32 @@ func ExistUserByEmail(email string) bool {
 	return false
 }
 
+func GetUserByEmail(email string) (user User) {
+	db.Where("email = ?", email).First(&user)
+
+	return
+}
+
+// CheckUser verifies the password of email and returns the user id, hashes
+// in a legacy or outdated format are upgraded on the way
 func CheckUser(email string, password string) int {
 	var user User
-	db.Select("id").Where("email = ? AND password = ? ", email, password).First(&user)
-	if user.ID > 0 {
-		return user.ID
+	db.Select("id, password").Where("email = ?", email).First(&user)
+	if user.ID == 0 {
+		return 0
+	}
+
+	ok, rehash := util.VerifyPassword(password, user.Password)
+	if !ok {
+		return 0
+	}
+	if rehash {
+		if encoded, err := util.HashPassword(password); err == nil {
+			db.Model(&User{}).Where("id = ?", user.ID).UpdateColumn("password", encoded)
+		}
 	}
 
-	return 0
+	return user.ID
 }
 
 func GetUserTotal(maps interface{}) (count int) {
@@ -46,8 +87,25 @@ func GetUserTotal(maps interface{}) (count int) {
 	return
 }
 
-func GetUsers() (users []User) {
-	db.Select("id, email, username, created_at, updated_at, group_id").Order("updated_at desc").Find(&users)
+// UserFields are the fields lists of users are filtered and sorted by
+var UserFields = util.Fields{
+	"id":        "users.id",
+	"email":     "users.email",
+	"username":  "users.username",
+	"groupId":   "users.group_id",
+	"disabled":  "users.disabled",
+	"createdAt": "users.created_at",
+	"updatedAt": "users.updated_at",
+}
+
+const userListColumns = "users.id, users.email, users.username, users.created_at, users.updated_at, users.group_id, users.mfa_enabled, users.disabled"
+
+// GetUsers returns a page of the members of an organization
+func GetUsers(orgId int, q util.Query) (users []User, page util.Pagination, err error) {
+	tx := db.Select(userListColumns).
+		Joins("JOIN org_members ON org_members.user_id = users.id").
+		Where("org_members.org_id = ?", orgId)
+	page, err = paginate(tx, q, &users)
 
 	return
 }
@@ -58,6 +116,19 @@ func GetUser(id int) (user User) {
 	return
 }
 
+// GetUserWithPosts returns a user with its posts, latest first, only the
+// published ones unless unpublished is set
+func GetUserWithPosts(id int, unpublished bool) (user User) {
+	db.Preload("Posts", func(db *gorm.DB) *gorm.DB {
+		if !unpublished {
+			db = db.Where("status = ?", PostPublished)
+		}
+		return db.Order("posts.updated_at desc")
+	}).Where("id = ?", id).First(&user)
+
+	return
+}
+
 func AddUser(user User) bool {
 	db.Create(&user)
 
@@ -70,10 +141,211 @@ func EditUser(id int, data interface{}) bool {
 	return true
 }
 
-func DeleteUser(id int) bool {
-	db.Where("id = ?", id).Delete(User{})
+// EditUserIfUnmodified changes a user unless it was changed since its
+// version, see updateIfUnmodified
+func EditUserIfUnmodified(id int, version int, data map[string]interface{}) error {
+	return updateIfUnmodified(db, &User{}, id, version, data)
+}
 
-	return true
+// IsUserActive reports whether the user exists, is not deleted and not
+// disabled
+func IsUserActive(id int) bool {
+	var user User
+	db.Select("id, disabled").Where("id = ?", id).First(&user)
+
+	return user.ID > 0 && !user.Disabled
+}
+
+// GetDeletedUser returns a soft deleted user
+func GetDeletedUser(id int) (user User) {
+	db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(&user)
+
+	return
+}
+
+// GetDeletedUsers returns a page of the soft deleted members of an
+// organization
+func GetDeletedUsers(orgId int, q util.Query) (users []User, page util.Pagination, err error) {
+	tx := db.Unscoped().Select(userListColumns+", users.deleted_at").
+		Joins("JOIN org_members ON org_members.user_id = users.id").
+		Where("org_members.org_id = ? AND users.deleted_at IS NOT NULL", orgId)
+	page, err = paginate(tx, q, &users)
+
+	return
+}
+
+// SetUserDisabled disables or enables a user. Disabled users lose their
+// grouping policies, enabling rebuilds them from their groups and
+// organizations.
+func SetUserDisabled(id int, disabled bool) error {
+	tx := db.Begin()
+	if err := tx.Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{"disabled": disabled}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	sync := restoreUserSubjects
+	if disabled {
+		sync = dropUserSubjects
+	}
+	if err := sync(tx, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := bumpPolicyRevision(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// DeleteUser soft deletes a user, its grouping policies are dropped while
+// its groups and organizations are kept for RestoreUser. The user is only
+// deleted while its version is still version, 0 deletes anyway.
+func DeleteUser(id int, version int) error {
+	tx := db.Begin()
+	remove := tx.Where("id = ?", id)
+	if version != 0 {
+		remove = remove.Where("version = ?", version)
+	}
+	result := remove.Delete(User{})
+	if result.Error != nil {
+		tx.Rollback()
+		return result.Error
+	}
+	if version != 0 && result.RowsAffected == 0 {
+		tx.Rollback()
+		return ErrModified
+	}
+	if err := dropUserSubjects(tx, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := bumpPolicyRevision(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// RestoreUser brings back a soft deleted user with its grouping policies,
+// unless it is disabled
+func RestoreUser(id int) error {
+	tx := db.Begin()
+	var user User
+	tx.Unscoped().Select("id, disabled").Where("id = ?", id).First(&user)
+	if err := tx.Unscoped().Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{"deleted_at": gorm.Expr("NULL")}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if !user.Disabled {
+		if err := restoreUserSubjects(tx, id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := bumpPolicyRevision(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// PurgeUser removes a user for good, together with its policies,
+// memberships, sessions, tokens and posts. The tags of its posts are counted
+// again.
+func PurgeUser(id int) error {
+	tx := db.Begin()
+	subject := fmt.Sprintf("u_%d", id)
+	if err := tx.Where("v0 = ?", subject).Delete(CasbinRule{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	posts := tx.Table("posts").Select("id").Where("user_id = ?", id).SubQuery()
+	if err := tx.Where("post_id IN (?)", posts).Delete(PostRevision{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	var tagIds []int
+	tx.Model(&PostTag{}).Where("post_id IN (?)", posts).Pluck("DISTINCT tag_id", &tagIds)
+	if err := tx.Where("post_id IN (?)", posts).Delete(PostTag{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := countTagPosts(tx, tagIds); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, model := range []interface{}{UserGroup{}, OrgMember{}, Session{}, RefreshToken{}, AccessToken{}, RecoveryCode{}, PasswordReset{}, OidcLink{}, Post{}} {
+		if err := tx.Where("user_id = ?", id).Delete(model).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Unscoped().Where("id = ?", id).Delete(User{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := bumpPolicyRevision(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// dropUserSubjects deletes the grouping policies of a user, its direct
+// policies stay until the user is purged
+func dropUserSubjects(tx *gorm.DB, id int) error {
+	return tx.Where("p_type = 'g' AND v0 = ?", fmt.Sprintf("u_%d", id)).Delete(CasbinRule{}).Error
+}
+
+// activeUser reports whether a user holds its grouping policies, which
+// disabled and deleted users don't
+func activeUser(tx *gorm.DB, id int) bool {
+	var user User
+	tx.Select("id, disabled").Where("id = ?", id).First(&user)
+
+	return user.ID > 0 && !user.Disabled
+}
+
+// restoreUserSubjects rebuilds the grouping policies of a user from its
+// groups and its organization admin roles
+func restoreUserSubjects(tx *gorm.DB, id int) error {
+	subject := fmt.Sprintf("u_%d", id)
+	var groups []Group
+	tx.Joins("JOIN user_groups ON user_groups.group_id = `groups`.id").
+		Where("user_groups.user_id = ?", id).Find(&groups)
+	for _, group := range groups {
+		rule := newCasbinRule("g", []string{subject, fmt.Sprintf("g_%d", group.ID), OrgDomain(group.OrgId)})
+		if err := tx.Where(&rule).FirstOrCreate(&rule).Error; err != nil {
+			return err
+		}
+	}
+
+	var admins []OrgMember
+	tx.Where("user_id = ? AND role = ?", id, OrgRoleAdmin).Find(&admins)
+	for _, member := range admins {
+		rule := newCasbinRule("g", []string{subject, OrgRoleAdmin, OrgDomain(member.OrgId)})
+		if err := tx.Where(&rule).FirstOrCreate(&rule).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsPrivilegedUser reports whether a user is root or the admin of an
+// organization
+func IsPrivilegedUser(user User) bool {
+	if user.Username == "root" {
+		return true
+	}
+	var member OrgMember
+	db.Select("id").Where("user_id = ? AND role = ?", user.ID, OrgRoleAdmin).First(&member)
+
+	return member.ID > 0
 }
 
 func GetUserPosts(id int) (user User) {
@@ -82,3 +354,12 @@ func GetUserPosts(id int) (user User) {
 
 	return
 }
+
+// CreateUser inserts user and fills in its id
+func CreateUser(user *User) bool {
+	if err := db.Create(user).Error; err != nil {
+		return false
+	}
+
+	return true
+}
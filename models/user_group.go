@@ -0,0 +1,305 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// maxGroupDepth keeps chains of nested groups within the hierarchy level of
+// the casbin role manager, the link from the user counts as well
+const maxGroupDepth = 9
+
+var (
+	ErrGroupCycle = errors.New("group would contain itself")
+	ErrGroupDepth = fmt.Errorf("groups nest at most %d deep", maxGroupDepth)
+	ErrGroupOrg   = errors.New("groups are in different organizations")
+)
+
+// UserGroup puts a user into a group, users may be in several groups. The
+// casbin grouping policy u_<id> -> g_<id> follows it.
+type UserGroup struct {
+	Model
+	UserId  int `sql:"not null" gorm:"unique_index:idx_user_group" json:"userId"`
+	GroupId int `sql:"not null" gorm:"unique_index:idx_user_group;index" json:"groupId"`
+}
+
+// GroupLink is a group of a user's chain, Via is the group it is inherited
+// through, 0 for groups the user is a direct member of
+type GroupLink struct {
+	Group
+	Via   int `json:"via"`
+	Depth int `json:"depth"`
+}
+
+func GetUserGroupIds(userId int) (ids []int) {
+	db.Model(&UserGroup{}).Where("user_id = ?", userId).Order("group_id").Pluck("group_id", &ids)
+
+	return
+}
+
+func IsGroupMember(groupId int, userId int) bool {
+	var member UserGroup
+	db.Select("id").Where("group_id = ? AND user_id = ?", groupId, userId).First(&member)
+
+	return member.ID > 0
+}
+
+// GetUserGroupChain returns the groups of a user in an organization, direct
+// ones first, then the groups they are nested in, level by level
+func GetUserGroupChain(userId int, orgId int) []GroupLink {
+	var direct []Group
+	db.Joins("JOIN user_groups ON user_groups.group_id = `groups`.id").
+		Where("user_groups.user_id = ? AND `groups`.org_id = ?", userId, orgId).Order("`groups`.id").Find(&direct)
+
+	chain := make([]GroupLink, 0, len(direct))
+	seen := make(map[int]bool)
+	for _, group := range direct {
+		seen[group.ID] = true
+		chain = append(chain, GroupLink{Group: group})
+	}
+	for i := 0; i < len(chain); i++ {
+		parentId := chain[i].ParentId
+		if parentId == 0 || seen[parentId] {
+			continue
+		}
+		seen[parentId] = true
+		parent := GetGroup(parentId)
+		if parent.ID == 0 {
+			continue
+		}
+		chain = append(chain, GroupLink{Group: parent, Via: chain[i].ID, Depth: chain[i].Depth + 1})
+	}
+
+	return chain
+}
+
+// UserRequiresMfa reports whether a group of the user, or a group one of them
+// is nested in, requires MFA
+func UserRequiresMfa(userId int) bool {
+	ids := GetUserGroupIds(userId)
+	seen := make(map[int]bool)
+	for len(ids) > 0 {
+		var groups []Group
+		db.Select("id, parent_id, require_mfa").Where("id IN (?)", ids).Find(&groups)
+		ids = nil
+		for _, group := range groups {
+			if group.RequireMfa {
+				return true
+			}
+			seen[group.ID] = true
+			if group.ParentId != 0 && !seen[group.ParentId] {
+				ids = append(ids, group.ParentId)
+			}
+		}
+	}
+
+	return false
+}
+
+// AddUserGroup puts a user into a group, which also makes the user a member
+// of the group's organization
+func AddUserGroup(userId int, groupId int) error {
+	tx := db.Begin()
+	if err := addUserGroup(tx, userId, groupId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := bumpPolicyRevision(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// RemoveUserGroup takes a user out of a group
+func RemoveUserGroup(userId int, groupId int) error {
+	tx := db.Begin()
+	if err := removeUserGroup(tx, userId, groupId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := bumpPolicyRevision(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// SetGroupParent nests a group into parentId, 0 makes it a top level group.
+// Members of the group inherit the policies of the parent and its parents.
+func SetGroupParent(groupId int, parentId int) error {
+	tx := db.Begin()
+	var group Group
+	tx.Where("id = ?", groupId).First(&group)
+	if group.ID == 0 {
+		tx.Rollback()
+		return gorm.ErrRecordNotFound
+	}
+	if err := setGroupParent(tx, group, parentId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := bumpPolicyRevision(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+func setGroupParent(tx *gorm.DB, group Group, parentId int) error {
+	if parentId != 0 {
+		var parent Group
+		tx.Where("id = ?", parentId).First(&parent)
+		if parent.ID == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if parent.OrgId != group.OrgId {
+			return ErrGroupOrg
+		}
+		// the group itself and the groups it would be nested in
+		depth := 1
+		for id := parentId; id != 0; {
+			if id == group.ID {
+				return ErrGroupCycle
+			}
+			if depth++; depth > maxGroupDepth {
+				return ErrGroupDepth
+			}
+			var ancestor Group
+			tx.Select("id, parent_id").Where("id = ?", id).First(&ancestor)
+			id = ancestor.ParentId
+		}
+		if depth+groupHeight(tx, group.ID) > maxGroupDepth {
+			return ErrGroupDepth
+		}
+	}
+
+	domain := OrgDomain(group.OrgId)
+	role := fmt.Sprintf("g_%d", group.ID)
+	if group.ParentId != 0 {
+		link := newCasbinRule("g", []string{role, fmt.Sprintf("g_%d", group.ParentId), domain})
+		if err := tx.Where(&link).Delete(CasbinRule{}).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Model(&Group{}).Where("id = ?", group.ID).Updates(map[string]interface{}{"parent_id": parentId}).Error; err != nil {
+		return err
+	}
+	if parentId != 0 {
+		link := newCasbinRule("g", []string{role, fmt.Sprintf("g_%d", parentId), domain})
+		return tx.Create(&link).Error
+	}
+	return nil
+}
+
+// groupHeight counts the levels of groups nested below a group
+func groupHeight(tx *gorm.DB, groupId int) int {
+	height := 0
+	ids := []int{groupId}
+	for len(ids) > 0 && height <= maxGroupDepth {
+		var children []int
+		tx.Model(&Group{}).Where("parent_id IN (?)", ids).Pluck("id", &children)
+		if len(children) > 0 {
+			height++
+		}
+		ids = children
+	}
+
+	return height
+}
+
+// addUserGroup makes a user a member of a group. Disabled and deleted users
+// get no grouping policy, restoreUserSubjects adds it when they come back.
+func addUserGroup(tx *gorm.DB, userId int, groupId int) error {
+	var group Group
+	tx.Select("id, org_id").Where("id = ?", groupId).First(&group)
+	if group.ID == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	var member UserGroup
+	if err := tx.Where(UserGroup{UserId: userId, GroupId: groupId}).FirstOrCreate(&member).Error; err != nil {
+		return err
+	}
+	if activeUser(tx, userId) {
+		rule := newCasbinRule("g", []string{fmt.Sprintf("u_%d", userId), fmt.Sprintf("g_%d", groupId), OrgDomain(group.OrgId)})
+		if err := tx.Where(&rule).FirstOrCreate(&rule).Error; err != nil {
+			return err
+		}
+	}
+	var orgMember OrgMember
+	if err := tx.Where(OrgMember{OrgId: group.OrgId, UserId: userId}).Attrs(OrgMember{Role: OrgRoleMember}).FirstOrCreate(&orgMember).Error; err != nil {
+		return err
+	}
+
+	// the first group of a user becomes its primary group
+	return tx.Model(&User{}).Where("id = ? AND group_id = 0", userId).Updates(map[string]interface{}{"group_id": groupId}).Error
+}
+
+func removeUserGroup(tx *gorm.DB, userId int, groupId int) error {
+	var group Group
+	tx.Select("id, org_id").Where("id = ?", groupId).First(&group)
+
+	if err := tx.Where("user_id = ? AND group_id = ?", userId, groupId).Delete(UserGroup{}).Error; err != nil {
+		return err
+	}
+	if group.ID != 0 {
+		rule := newCasbinRule("g", []string{fmt.Sprintf("u_%d", userId), fmt.Sprintf("g_%d", groupId), OrgDomain(group.OrgId)})
+		if err := tx.Where(&rule).Delete(CasbinRule{}).Error; err != nil {
+			return err
+		}
+	}
+
+	// a primary group the user left falls back to another group of the user
+	var next UserGroup
+	tx.Select("group_id").Where("user_id = ?", userId).Order("group_id").First(&next)
+	return tx.Model(&User{}).Where("id = ? AND group_id = ?", userId, groupId).Updates(map[string]interface{}{"group_id": next.GroupId}).Error
+}
+
+// migrateUserGroups fills user_groups from a database where users had a
+// single group_id and casbin held the only other links to groups
+func migrateUserGroups() error {
+	var count int
+	db.Model(&UserGroup{}).Count(&count)
+	if count > 0 {
+		return nil
+	}
+
+	tx := db.Begin()
+	var rules []CasbinRule
+	tx.Where("p_type = 'g' AND v0 LIKE 'u\\_%' AND v1 LIKE 'g\\_%'").Find(&rules)
+	for _, rule := range rules {
+		var userId, groupId int
+		if _, err := fmt.Sscanf(strings.TrimPrefix(rule.V0, "u_"), "%d", &userId); err != nil {
+			continue
+		}
+		if _, err := fmt.Sscanf(strings.TrimPrefix(rule.V1, "g_"), "%d", &groupId); err != nil {
+			continue
+		}
+		if err := addUserGroup(tx, userId, groupId); err != nil && err != gorm.ErrRecordNotFound {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	var users []User
+	tx.Select("id, group_id").Where("group_id > 0").Find(&users)
+	for _, user := range users {
+		if err := addUserGroup(tx, user.ID, user.GroupId); err != nil && err != gorm.ErrRecordNotFound {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := bumpPolicyRevision(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
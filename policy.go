@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/Chalin-Shi/gout/libs/util"
+	"github.com/Chalin-Shi/gout/models"
+)
+
+const policyUsage = `usage:
+  gout policy export [-format yaml|csv] [-o file]
+  gout policy import [-mode merge|replace] [-format yaml|csv] [-dry-run] file`
+
+// runPolicyCommand exports or imports the casbin rules, running servers pick
+// up an import on their next policy poll
+func runPolicyCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(policyUsage)
+	}
+
+	switch args[0] {
+	case "export":
+		flags := flag.NewFlagSet("export", flag.ExitOnError)
+		format := flags.String("format", "yaml", "yaml or csv")
+		output := flags.String("o", "", "write to file instead of stdout")
+		flags.Parse(args[1:])
+
+		data, err := util.MarshalPolicy(*format, models.GetPolicySet())
+		if err != nil {
+			return err
+		}
+		if *output == "" {
+			_, err = os.Stdout.Write(data)
+			return err
+		}
+		return ioutil.WriteFile(*output, data, 0644)
+
+	case "import":
+		flags := flag.NewFlagSet("import", flag.ExitOnError)
+		mode := flags.String("mode", "merge", "merge or replace")
+		format := flags.String("format", "", "yaml or csv, guessed from the file name by default")
+		dryRun := flags.Bool("dry-run", false, "only print the changes")
+		flags.Parse(args[1:])
+		if flags.NArg() != 1 || (*mode != "merge" && *mode != "replace") {
+			return errors.New(policyUsage)
+		}
+
+		name := flags.Arg(0)
+		if *format == "" {
+			*format = util.PolicyFormat(name)
+		}
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		desired, err := util.ParsePolicy(*format, data)
+		if err != nil {
+			return err
+		}
+
+		added, removed := util.DiffPolicy(models.GetPolicySet(), desired, *mode == "replace")
+		printPolicyDiff("+", added)
+		printPolicyDiff("-", removed)
+		fmt.Printf("%d to add, %d to remove\n", added.Len(), removed.Len())
+		if *dryRun || added.Len()+removed.Len() == 0 {
+			return nil
+		}
+		if err := models.ApplyPolicyDiff(added, removed); err != nil {
+			return err
+		}
+		models.AddAudit(models.Audit{
+			Action: "policy.import",
+			Detail: fmt.Sprintf("mode=%s added=%d removed=%d file=%s", *mode, added.Len(), removed.Len(), name),
+		})
+		return nil
+	}
+
+	return errors.New(policyUsage)
+}
+
+func printPolicyDiff(sign string, set util.PolicySet) {
+	for _, rule := range set.P {
+		fmt.Printf("%s p, %s\n", sign, strings.Join(rule, ", "))
+	}
+	for _, rule := range set.G {
+		fmt.Printf("%s g, %s\n", sign, strings.Join(rule, ", "))
+	}
+}
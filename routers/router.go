@@ -13,11 +13,15 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/Chalin-Shi/gout/controllers/groups"
+	"github.com/Chalin-Shi/gout/controllers/orgs"
 	"github.com/Chalin-Shi/gout/controllers/policy"
+	"github.com/Chalin-Shi/gout/controllers/posts"
 	"github.com/Chalin-Shi/gout/controllers/user"
 	"github.com/Chalin-Shi/gout/controllers/users"
+	"github.com/Chalin-Shi/gout/libs/logging"
 	"github.com/Chalin-Shi/gout/libs/setting"
 	"github.com/Chalin-Shi/gout/middlewares"
+	"github.com/Chalin-Shi/gout/models"
 )
 
 func InitRouter() *gin.Engine {
@@ -26,7 +30,8 @@ func InitRouter() *gin.Engine {
 
 	config := cors.DefaultConfig()
 	config.AllowAllOrigins = true
-	config.AllowHeaders = []string{"Origin", "Access", "Accept", "Authorization", "Content-Type"}
+	config.AllowHeaders = []string{"Origin", "Access", "Accept", "Authorization", "Content-Type", "If-Match", "If-None-Match", middlewares.OrgHeader}
+	config.ExposeHeaders = []string{"ETag"}
 	r.Use(cors.New(config))
 
 	// set run mode
@@ -55,21 +60,144 @@ func InitRouter() *gin.Engine {
 	logger, _ := zap.NewProduction()
 	r.Use(ginzap.Ginzap(logger, time.RFC3339, true))
 
+	// public keys of the token signing key set
+	r.GET("/.well-known/jwks.json", user.GetJWKS)
+
 	// set api prefix
 	api := r.Group("/api")
 	api.POST("/auth/login", user.AuthUser)
-	api.Use(middlewares.JWT(), middlewares.Authz(), middlewares.Formatter())
+	api.POST("/auth/refresh", user.RefreshToken)
+	api.POST("/auth/password/forgot", user.ForgotPassword)
+	api.POST("/auth/password/reset", user.ResetPassword)
+	api.POST("/auth/mfa", user.VerifyMfa)
+	api.POST("/auth/mfa/enroll", user.EnrollMfaPending)
+	api.GET("/auth/oidc/login", user.OidcLogin)
+	api.GET("/auth/oidc/callback", user.OidcCallback)
+	api.POST("/auth/logout", middlewares.JWT(), middlewares.RequireSession(), middlewares.Formatter(), user.Logout)
+
+	// current user, no policy needed
+	me := api.Group("/user", middlewares.JWT(), middlewares.RequireSession(), middlewares.Formatter())
+	{
+		me.GET("", user.GetUser)
+		me.PUT("/password", user.PutUserPassword)
+		me.POST("/mfa", user.EnrollMfa)
+		me.PUT("/mfa", user.ConfirmMfa)
+		me.DELETE("/mfa", user.DisableMfa)
+		me.POST("/mfa/recovery-codes", user.RegenerateRecoveryCodes)
+		me.GET("/tokens", user.GetAccessTokens)
+		me.POST("/tokens", user.AddAccessToken)
+		me.DELETE("/tokens/:id", user.DeleteAccessToken)
+		me.GET("/sessions", user.GetSessions)
+		me.DELETE("/sessions", user.DeleteOtherSessions)
+		me.DELETE("/sessions/:id", user.DeleteSession)
+		me.GET("/orgs", user.GetOrganizations)
+	}
+
+	// routes registered so far are not authorized by policies
+	public := r.Routes()
+
+	// ownership rules, checked on top of the policies
+	middlewares.Own("/api/users/:id/posts", "POST", middlewares.ParamIsCaller("id"))
+	middlewares.Own("/api/users/:id/posts/:postId", "(PUT)|(PATCH)|(DELETE)",
+		middlewares.ParamIsCaller("id"), middlewares.OwnedBy("postId", models.GetPostOwner))
+	// only authors move their posts in and out of the workflow, reviewers
+	// approve, reject and archive as the policies allow
+	middlewares.Own("/api/users/:id/posts/:postId/submit", "POST",
+		middlewares.ParamIsCaller("id"), middlewares.OwnedBy("postId", models.GetPostOwner))
+	middlewares.Own("/api/users/:id/posts/:postId/withdraw", "POST",
+		middlewares.ParamIsCaller("id"), middlewares.OwnedBy("postId", models.GetPostOwner))
+	middlewares.Own("/api/users/:id/posts/:postId/reopen", "POST",
+		middlewares.ParamIsCaller("id"), middlewares.OwnedBy("postId", models.GetPostOwner))
+	middlewares.Own("/api/users/:id/posts/:postId/revisions/:number/restore", "POST",
+		middlewares.ParamIsCaller("id"), middlewares.OwnedBy("postId", models.GetPostOwner))
+
+	api.Use(middlewares.JWT(), middlewares.Org(), middlewares.Authz(), middlewares.Formatter())
 	{
+		// organizations
+		api.GET("/orgs", orgs.GetOrganizations)
+		api.POST("/orgs", orgs.AddOrganization)
+		api.GET("/org/members", orgs.GetOrgMembers)
+		api.POST("/org/members", orgs.AddOrgMember)
+		api.PUT("/org/members/:userId", orgs.EditOrgMember)
+		api.DELETE("/org/members/:userId", orgs.DeleteOrgMember)
 		// users
 		api.GET("/users", users.GetUsers)
 		api.POST("/users", users.AddUser)
 		api.GET("/users/:id", users.GetUserById)
+		api.PUT("/users/:id", users.EditUser)
+		api.PATCH("/users/:id", users.EditUser)
+		api.DELETE("/users/:id", users.DeleteUser)
+		api.POST("/users/:id/deactivate", users.DeactivateUser)
+		api.POST("/users/:id/reactivate", users.ReactivateUser)
+		api.POST("/users/:id/restore", users.RestoreUser)
+		api.DELETE("/users/:id/purge", users.PurgeUser)
+		api.DELETE("/users/:id/lock", users.UnlockUser)
+		api.GET("/users/:id/sessions", users.GetUserSessions)
+		api.DELETE("/users/:id/sessions", users.DeleteUserSessions)
+		api.GET("/users/:id/groups", users.GetUserGroups)
+		// posts, gin wants the user wildcard named :id like the routes above
+		api.GET("/posts", posts.GetPosts)
+		api.GET("/users/:id/posts", posts.GetUserPosts)
+		api.POST("/users/:id/posts", posts.AddUserPost)
+		api.GET("/users/:id/posts/:postId", posts.GetUserPost)
+		api.PUT("/users/:id/posts/:postId", posts.EditUserPost)
+		api.PATCH("/users/:id/posts/:postId", posts.EditUserPost)
+		api.DELETE("/users/:id/posts/:postId", posts.DeleteUserPost)
+		api.POST("/users/:id/posts/:postId/submit", posts.SubmitPost)
+		api.POST("/users/:id/posts/:postId/withdraw", posts.WithdrawPost)
+		api.POST("/users/:id/posts/:postId/approve", posts.ApprovePost)
+		api.POST("/users/:id/posts/:postId/reject", posts.RejectPost)
+		api.POST("/users/:id/posts/:postId/archive", posts.ArchivePost)
+		api.POST("/users/:id/posts/:postId/reopen", posts.ReopenPost)
+		api.GET("/users/:id/posts/:postId/revisions", posts.GetPostRevisions)
+		api.GET("/users/:id/posts/:postId/revisions/:number", posts.GetPostRevision)
+		api.POST("/users/:id/posts/:postId/revisions/:number/restore", posts.RestorePostRevision)
+		api.GET("/users/:id/posts/:postId/diff", posts.GetPostDiff)
+		// tags and categories of posts
+		api.GET("/tags", posts.GetTags)
+		api.POST("/tags", posts.AddTag)
+		api.PUT("/tags/:tagId", posts.EditTag)
+		api.DELETE("/tags/:tagId", posts.DeleteTag)
+		api.POST("/tags/:tagId/merge", posts.MergeTag)
+		api.GET("/categories", posts.GetCategories)
+		api.POST("/categories", posts.AddCategory)
+		api.GET("/categories/:categoryId", posts.GetCategory)
+		api.PUT("/categories/:categoryId", posts.EditCategory)
+		api.DELETE("/categories/:categoryId", posts.DeleteCategory)
+		api.PUT("/categories/:categoryId/parent", posts.EditCategoryParent)
 		// groups
+		api.GET("/groups", groups.GetGroups)
+		api.POST("/groups", groups.AddGroup)
+		api.GET("/groups/:groupId", groups.GetGroup)
+		api.PUT("/groups/:groupId", groups.EditGroup)
+		api.DELETE("/groups/:groupId", groups.DeleteGroup)
+		api.GET("/groups/:groupId/users", groups.GetGroupUsers)
+		api.GET("/groups/:groupId/users/:id", groups.GetGroupUser)
 		api.POST("/groups/:groupId/users/:id", groups.AddGroupUser)
+		api.DELETE("/groups/:groupId/users/:id", groups.DeleteGroupUser)
+		api.PUT("/groups/:groupId/parent", groups.EditGroupParent)
 		//policy
+		api.GET("/policy", policy.GetPolicies)
 		api.POST("/policy", policy.AddPolicy)
 		api.DELETE("/policy", policy.DelPolicy)
+		api.POST("/policy/explain", policy.ExplainPolicy)
+		api.GET("/policy/export", policy.ExportPolicy)
+		api.POST("/policy/import", policy.ImportPolicy)
+		api.GET("/subjects/:sub/permissions", policy.GetSubjectPermissions)
+		api.GET("/permissions", policy.GetPermissions)
+	}
+
+	// permission catalog of the routes above, new groups get the defaults
+	middlewares.SetCatalog(r.Routes(), public)
+	permissions, unknown := middlewares.LookupPermissions(setting.AuthzDefaultPermissions)
+	for _, name := range unknown {
+		logging.Warn("unknown default group permission", name)
+	}
+	defaults := make([][]string, len(permissions))
+	for i, permission := range permissions {
+		defaults[i] = []string{permission.Path, permission.Method}
 	}
+	models.SetDefaultGroupPermissions(defaults)
 
 	return r
 }
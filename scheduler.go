@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/robfig/cron"
+
+	"github.com/Chalin-Shi/gout/libs/logging"
+	"github.com/Chalin-Shi/gout/libs/setting"
+	"github.com/Chalin-Shi/gout/models"
+)
+
+// startScheduler runs the background jobs, it is started before the server
+// since ListenAndServe blocks until the server is shut down
+func startScheduler() (*cron.Cron, error) {
+	c := cron.New()
+	if setting.PostPublishSchedule != "" {
+		if err := c.AddFunc(setting.PostPublishSchedule, publishDuePosts); err != nil {
+			return nil, err
+		}
+	}
+	c.Start()
+
+	return c, nil
+}
+
+// publishDuePosts publishes the scheduled posts that are due
+func publishDuePosts() {
+	count, err := models.PublishDuePosts()
+	if err != nil {
+		logging.Error("publish posts", err)
+		return
+	}
+	if count > 0 {
+		logging.Info("published posts", count)
+	}
+}